@@ -0,0 +1,222 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"pianpianino/ical"
+	"pianpianino/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Version is bumped whenever the layout of Document changes, Import keeps
+// accepting every version up to the current one.
+const Version = 1
+
+const (
+	ModeMerge   = "merge"
+	ModeReplace = "replace"
+)
+
+var ErrUnsupportedVersion = errors.New("unsupported backup version")
+
+// Document holds all the data of a user. It is decoupled from the models on
+// purpose, so that backups stay readable when the API changes.
+type Document struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	User       User      `json:"user"`
+	Tasks      []Task    `json:"tasks" validate:"dive"`
+}
+
+type User struct {
+	Username string `json:"username"`
+}
+
+// Task is a task of the document. UID identifies it across exports, it is
+// the UID of the task or, for tasks created without one, the UID the CalDAV
+// and iCalendar routes derive from its ID. DAVName keeps the resource name
+// CalDAV clients gave the task, TodoTxtUndated a todo.txt line without date.
+type Task struct {
+	ID              int64             `json:"id"`
+	Description     string            `json:"description" validate:"required,max=1000"`
+	Priority        models.Importance `json:"priority" validate:"importance"`
+	Completed       bool              `json:"completed"`
+	CompletedAt     time.Time         `json:"completed_at,omitzero"`
+	Projects        []string          `json:"projects,omitempty"`
+	Contexts        []string          `json:"contexts,omitempty"`
+	TodoTxtPriority string            `json:"todotxt_priority,omitempty"`
+	UID             string            `json:"uid,omitempty"`
+	DAVName         string            `json:"dav_name,omitempty"`
+	TodoTxtUndated  bool              `json:"todotxt_undated,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at" validate:"not_before=created_at"`
+}
+
+// Result reports what Import did. IDs maps the task IDs found in the
+// document onto the IDs the tasks were stored with.
+type Result struct {
+	Imported int             `json:"imported"`
+	Skipped  int             `json:"skipped"`
+	Deleted  int             `json:"deleted"`
+	IDs      map[int64]int64 `json:"ids"`
+}
+
+func Export(ctx context.Context, DB bun.IDB, userID int64) (*Document, error) {
+	user := new(models.User)
+	err := DB.NewSelect().
+		Model(user).
+		Where("id = ?", userID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]models.Task, 0)
+	err = DB.NewSelect().
+		Model(&tasks).
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		Version:    Version,
+		ExportedAt: time.Now().UTC(),
+		User:       User{Username: user.Username},
+		Tasks:      make([]Task, 0, len(tasks)),
+	}
+	for _, task := range tasks {
+		doc.Tasks = append(doc.Tasks, Task{
+			ID:              task.ID,
+			Description:     task.Description,
+			Priority:        task.Priority,
+			Completed:       task.Completed,
+			CompletedAt:     task.CompletedAt,
+			Projects:        task.Projects,
+			Contexts:        task.Contexts,
+			UID:             ical.UID(task),
+			TodoTxtPriority: task.TodoTxtPriority,
+			DAVName:         task.DAVName,
+			TodoTxtUndated:  task.TodoTxtUndated,
+			CreatedAt:       task.CreatedAt,
+			UpdatedAt:       task.UpdatedAt,
+		})
+	}
+	return doc, nil
+}
+
+// Import restores a document into the account of the user inside a single
+// transaction. ModeReplace deletes the existing tasks first, ModeMerge keeps
+// them and skips imported tasks the user already has, mapping their IDs onto
+// the existing tasks: importing a backup of the same account adds nothing.
+func Import(ctx context.Context, DB *bun.DB, userID int64, doc *Document, mode string) (*Result, error) {
+	if doc.Version < 1 || doc.Version > Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, doc.Version)
+	}
+	if mode != ModeMerge && mode != ModeReplace {
+		return nil, fmt.Errorf("unknown import mode: %q", mode)
+	}
+
+	result := &Result{IDs: make(map[int64]int64, len(doc.Tasks))}
+	err := DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		if mode == ModeReplace {
+			var ids []int64
+			err := tx.NewSelect().
+				Model((*models.Task)(nil)).
+				Column("id").
+				Where("user_id = ?", userID).
+				Scan(ctx, &ids)
+			if err != nil {
+				return err
+			}
+			_, err = tx.NewDelete().
+				Model((*models.Task)(nil)).
+				Where("user_id = ?", userID).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			if err := models.RecordChange(ctx, tx, userID, true, ids...); err != nil {
+				return err
+			}
+			result.Deleted = len(ids)
+		}
+
+		for _, t := range doc.Tasks {
+			if t.UID != "" {
+				existing, err := findTask(ctx, tx, userID, t.UID)
+				if err != nil {
+					return err
+				}
+				if existing != 0 {
+					result.Skipped++
+					result.IDs[t.ID] = existing
+					continue
+				}
+			}
+
+			task := &models.Task{
+				UserID:          userID,
+				Description:     t.Description,
+				Priority:        t.Priority,
+				Completed:       t.Completed,
+				CompletedAt:     t.CompletedAt,
+				Projects:        t.Projects,
+				Contexts:        t.Contexts,
+				UID:             t.UID,
+				TodoTxtPriority: t.TodoTxtPriority,
+				DAVName:         t.DAVName,
+				TodoTxtUndated:  t.TodoTxtUndated,
+				CreatedAt:       t.CreatedAt,
+				UpdatedAt:       t.UpdatedAt,
+			}
+			_, err := tx.NewInsert().
+				Model(task).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			if err := models.RecordChange(ctx, tx, userID, false, task.ID); err != nil {
+				return err
+			}
+			result.Imported++
+			result.IDs[t.ID] = task.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// findTask returns the ID of the task of the user with uid, 0 when there is
+// none. A task without UID of its own has the one derived from its ID.
+func findTask(ctx context.Context, tx bun.Tx, userID int64, uid string) (int64, error) {
+	taskID, ok := ical.TaskID(uid)
+	if !ok {
+		taskID = -1
+	}
+
+	var ids []int64
+	err := tx.NewSelect().
+		Model((*models.Task)(nil)).
+		Column("id").
+		Where("user_id = ?", userID).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("uid = ?", uid).
+				WhereOr("uid IS NULL AND id = ?", taskID)
+		}).
+		Limit(1).
+		Scan(ctx, &ids)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], nil
+}
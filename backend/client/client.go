@@ -0,0 +1,243 @@
+// Package client is a typed Go client for the PianPianino REST API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"pianpianino/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// refreshMargin is how long before its expiry a token is renewed.
+const refreshMargin = time.Minute
+
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// OnToken is called whenever a new token is obtained, e.g. to cache it
+	OnToken func(token string)
+
+	mu       sync.Mutex
+	token    string
+	username string
+	password string
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Token returns the token currently used to authenticate requests.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// SetToken reuses a token obtained earlier. Without credentials the client
+// cannot renew it, requests fail with ErrUnauthorized once it expires.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Register creates a new user, it does not log in.
+func (c *Client) Register(ctx context.Context, username, password string) error {
+	return c.do(ctx, http.MethodPost, "/register", credentials{username, password}, nil, false)
+}
+
+// Login obtains a token and remembers the credentials, so that the token is
+// renewed transparently when it is about to expire.
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	c.mu.Lock()
+	c.username, c.password = username, password
+	c.mu.Unlock()
+	return c.login(ctx)
+}
+
+func (c *Client) ListTasks(ctx context.Context) ([]models.Task, error) {
+	var res struct {
+		Tasks []models.Task `json:"tasks"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/v1/tasks", nil, &res, true)
+	return res.Tasks, err
+}
+
+func (c *Client) GetTask(ctx context.Context, id int64) (*models.Task, error) {
+	var res struct {
+		Task models.Task `json:"task"`
+	}
+	if err := c.do(ctx, http.MethodGet, taskPath(id), nil, &res, true); err != nil {
+		return nil, err
+	}
+	return &res.Task, nil
+}
+
+func (c *Client) CreateTask(ctx context.Context, description string, priority models.Importance) (*models.Task, error) {
+	req := struct {
+		Description string            `json:"description"`
+		Priority    models.Importance `json:"priority"`
+	}{description, priority}
+
+	var res struct {
+		Task models.Task `json:"task"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/tasks", req, &res, true); err != nil {
+		return nil, err
+	}
+	return &res.Task, nil
+}
+
+// TaskUpdate holds the fields to change, nil fields are left untouched.
+type TaskUpdate struct {
+	Description *string            `json:"description,omitempty"`
+	Priority    *models.Importance `json:"priority,omitempty"`
+}
+
+func (c *Client) UpdateTask(ctx context.Context, id int64, update TaskUpdate) (*models.Task, error) {
+	var res struct {
+		Task models.Task `json:"task"`
+	}
+	if err := c.do(ctx, http.MethodPatch, taskPath(id), update, &res, true); err != nil {
+		return nil, err
+	}
+	return &res.Task, nil
+}
+
+func (c *Client) ToggleTask(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodPatch, taskPath(id)+"/toggle", nil, nil, true)
+}
+
+func (c *Client) DeleteTask(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, taskPath(id), nil, nil, true)
+}
+
+func taskPath(id int64) string {
+	return "/api/v1/tasks/" + strconv.FormatInt(id, 10)
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (c *Client) login(ctx context.Context) error {
+	c.mu.Lock()
+	creds := credentials{c.username, c.password}
+	c.mu.Unlock()
+
+	var res struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/login", creds, &res, false); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.token = res.Token
+	onToken := c.OnToken
+	c.mu.Unlock()
+	if onToken != nil {
+		onToken(res.Token)
+	}
+	return nil
+}
+
+func (c *Client) canRefresh() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.username != ""
+}
+
+// expiresSoon reads the expiry of the token without verifying it,
+// the server remains the one checking the signature.
+func expiresSoon(token string) bool {
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	if err != nil {
+		return false
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return false
+	}
+	return time.Until(exp.Time) < refreshMargin
+}
+
+// do sends a JSON request and decodes the JSON response into out. Requests
+// that need a token renew it before it expires and retry once on a 401.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}, auth bool) error {
+	if auth && c.canRefresh() && (c.Token() == "" || expiresSoon(c.Token())) {
+		if err := c.login(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := c.send(ctx, method, path, in, out, auth)
+	if auth && errors.Is(err, ErrUnauthorized) && c.canRefresh() {
+		if err := c.login(ctx); err != nil {
+			return err
+		}
+		err = c.send(ctx, method, path, in, out, auth)
+	}
+	return err
+}
+
+func (c *Client) send(ctx context.Context, method, path string, in, out interface{}, auth bool) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := c.Token(); auth && token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 400 {
+		return newAPIError(res.StatusCode, data)
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	// ErrPreconditionFailed is returned when the task changed since it was read
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrServer             = errors.New("server error")
+)
+
+// FieldError is a field of the request that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIError is returned for every response with an error status. It is read
+// from the problem details of the server, or from the {"error": ...} body of
+// the endpoints that do not send them yet. It matches the sentinel errors
+// above with errors.Is.
+type APIError struct {
+	StatusCode int
+	// Code is the stable code of the problem, e.g. "task_not_found"
+	Code      string
+	Message   string
+	Fields    []FieldError
+	RequestID string
+}
+
+func newAPIError(status int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: status}
+	var payload struct {
+		Title     string       `json:"title"`
+		Detail    string       `json:"detail"`
+		Code      string       `json:"code"`
+		RequestID string       `json:"request_id"`
+		Errors    []FieldError `json:"errors"`
+		Error     string       `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		apiErr.Code = payload.Code
+		apiErr.Fields = payload.Errors
+		apiErr.RequestID = payload.RequestID
+		apiErr.Message = firstNonEmpty(payload.Detail, payload.Error, payload.Title)
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(status)
+	}
+	return apiErr
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+	return false
+}
@@ -1,27 +1,98 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"pianpianino/config"
 	"pianpianino/database"
 	"pianpianino/handlers"
-	"pianpianino/helpers"
 	"pianpianino/models"
+	"pianpianino/repository"
 	"pianpianino/routes"
+	"pianpianino/rpc"
+	"pianpianino/server"
+	"pianpianino/service"
+	"syscall"
 
 	"github.com/labstack/echo/v4"
 )
 
 func main() {
-	db := database.InitDB()
+	if len(os.Args) > 1 && os.Args[1] == "todotxt" {
+		runTodoTxt(os.Args[2:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	db := database.InitDB(cfg.DatabaseDSN)
 	models.Migrate()
 	e := echo.New()
 
-	authHandler := &handlers.AuthHandler{
-		DB:        database.GetDB(),
-		JWTSecret: helpers.LoadConfig("JWT_SECRET"),
+	users := service.NewUserService(repository.NewBunUsers(db), cfg.JWTSecret)
+	users.TokenTTL = cfg.TokenTTL
+	routes.SetupRoutes(e, cfg, routes.Handlers{
+		Auth: &handlers.AuthHandler{
+			DB:        db,
+			JWTSecret: cfg.JWTSecret,
+			Users:     users,
+		},
+		Task: handlers.NewTaskHandler(db),
+		Calendar: &handlers.CalendarHandler{
+			DB:        db,
+			JWTSecret: cfg.JWTSecret,
+		},
+		CalDAV:  handlers.NewCalDAVHandler(db),
+		TodoTxt: &handlers.TodoTxtHandler{DB: db},
+		Backup:  &handlers.BackupHandler{DB: db},
+		Import:  &handlers.ImportHandler{DB: db},
+	})
+
+	// gRPC clients get the auth and task services on their own port
+	lis, err := net.Listen("tcp", cfg.GRPCAddress())
+	if err != nil {
+		e.Logger.Fatal(err)
 	}
+	grpcService := &rpc.Service{Server: rpc.NewServer(db, cfg), Listener: lis}
 
-	taskHandler := &handlers.TaskHandler{DB: db}
+	srv, err := server.New(cfg, e)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	ln, err := server.Listen(cfg)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// SIGINT or SIGTERM drains the requests in flight, a second one kills
+	// the server right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	cancelNotice := context.AfterFunc(ctx, func() {
+		stop()
+		log.Printf("shutting down, waiting up to %s for the requests in flight", cfg.ShutdownTimeout)
+	})
 
-	routes.SetupRoutes(e, authHandler, taskHandler)
-	e.Logger.Fatal(e.Start(":1323"))
+	log.Printf("serving the REST API on %s", server.URL(cfg, ln))
+	err = server.Run(ctx, srv, ln, cfg.ShutdownTimeout, grpcService)
+	// a failure is not announced as a shutdown
+	cancelNotice()
+	stop()
+	if closeErr := db.Close(); closeErr != nil {
+		log.Printf("failed to close the database: %v", closeErr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("server stopped")
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pianpianino/client"
+	"pianpianino/models"
+)
+
+var errSessionExpired = errors.New("the session has expired, run: pianpianino login")
+
+// client returns an API client authenticated with the cached token. The
+// password is not stored, so an expired token means logging in again.
+func (s *session) client() *client.Client {
+	c := client.New(s.Server)
+	c.SetToken(s.Token)
+	return c
+}
+
+// apiError turns a rejected token into a hint on how to log in again.
+func apiError(err error) error {
+	if errors.Is(err, client.ErrUnauthorized) {
+		return errSessionExpired
+	}
+	return err
+}
+
+func listTasks(s *session) ([]models.Task, error) {
+	tasks, err := s.client().ListTasks(context.Background())
+	return tasks, apiError(err)
+}
+
+func findTask(s *session, id int64) (*models.Task, error) {
+	task, err := s.client().GetTask(context.Background(), id)
+	if errors.Is(err, client.ErrNotFound) {
+		return nil, fmt.Errorf("task %d not found", id)
+	}
+	return task, apiError(err)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"pianpianino/client"
+	"pianpianino/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+func newFlagSet(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: pianpianino %s [flags] %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parse allows flags after the positional arguments, as in "edit 3 -p high",
+// which the flag package alone stops parsing at.
+func parse(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func outputFlag(flags *flag.FlagSet) *string {
+	return flags.String("o", "table", "output format: table or json")
+}
+
+func runLogin(args []string) error {
+	flags := newFlagSet("login", "")
+	server := flags.String("server", envOr("PIANPIANINO_SERVER", defaultServer), "URL of the PianPianino server")
+	username := flags.String("u", "", "username")
+	flags.Parse(args)
+
+	in := bufio.NewReader(os.Stdin)
+	if *username == "" {
+		fmt.Fprint(os.Stderr, "Username: ")
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		*username = strings.TrimSpace(line)
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	var password string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		data, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		password = string(data)
+	} else {
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	s := &session{Server: *server, Username: *username}
+	c := client.New(s.Server)
+	if err := c.Login(context.Background(), *username, password); err != nil {
+		return err
+	}
+
+	s.Token = c.Token()
+	if err := s.save(); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Logged in as", *username)
+	return nil
+}
+
+func runLogout(args []string) error {
+	newFlagSet("logout", "").Parse(args)
+	return removeSession()
+}
+
+func runAdd(args []string) error {
+	flags := newFlagSet("add", "<description>")
+	priority := flags.String("p", "", "priority: low, normal or high")
+	output := outputFlag(flags)
+	description := strings.Join(parse(flags, args), " ")
+	if description == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	importance, err := models.ParseImportance(*priority)
+	if err != nil {
+		return err
+	}
+
+	s, err := loadSession()
+	if err != nil {
+		return err
+	}
+
+	task, err := s.client().CreateTask(context.Background(), description, importance)
+	if err != nil {
+		return apiError(err)
+	}
+	return printTasks(*output, []models.Task{*task})
+}
+
+func runList(args []string) error {
+	flags := newFlagSet("ls", "")
+	done := flags.Bool("done", false, "only show completed tasks")
+	todo := flags.Bool("todo", false, "only show tasks still to do")
+	priority := flags.String("p", "", "only show tasks with this priority")
+	search := flags.String("q", "", "only show tasks whose description contains this text")
+	sortBy := flags.String("sort", "created", "sort by created or priority")
+	output := outputFlag(flags)
+	flags.Parse(args)
+
+	if *done && *todo {
+		return errors.New("-done and -todo cannot be used together")
+	}
+	var importance models.Importance
+	if *priority != "" {
+		var err error
+		if importance, err = models.ParseImportance(*priority); err != nil {
+			return err
+		}
+	}
+
+	s, err := loadSession()
+	if err != nil {
+		return err
+	}
+	tasks, err := listTasks(s)
+	if err != nil {
+		return err
+	}
+
+	filtered := make([]models.Task, 0, len(tasks))
+	for _, task := range tasks {
+		switch {
+		case *done && !task.Completed, *todo && task.Completed:
+			continue
+		case *priority != "" && task.Priority != importance:
+			continue
+		case *search != "" && !strings.Contains(strings.ToLower(task.Description), strings.ToLower(*search)):
+			continue
+		}
+		filtered = append(filtered, task)
+	}
+
+	switch *sortBy {
+	case "created":
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return filtered[i].CreatedAt.Before(filtered[j].CreatedAt)
+		})
+	case "priority":
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return filtered[i].Priority > filtered[j].Priority
+		})
+	default:
+		return fmt.Errorf("cannot sort by %q", *sortBy)
+	}
+
+	return printTasks(*output, filtered)
+}
+
+func runDone(args []string) error {
+	return setCompleted("done", args, true)
+}
+
+func runUndo(args []string) error {
+	return setCompleted("undo", args, false)
+}
+
+// setCompleted only toggles tasks that are not in the wanted state yet,
+// so running done twice does not reopen a task.
+func setCompleted(name string, args []string, completed bool) error {
+	flags := newFlagSet(name, "<id>")
+	id, err := taskIDArg(flags, parse(flags, args))
+	if err != nil {
+		return err
+	}
+
+	s, err := loadSession()
+	if err != nil {
+		return err
+	}
+	task, err := findTask(s, id)
+	if err != nil {
+		return err
+	}
+	if task.Completed == completed {
+		return nil
+	}
+	return apiError(s.client().ToggleTask(context.Background(), id))
+}
+
+func runRemove(args []string) error {
+	flags := newFlagSet("rm", "<id>")
+	id, err := taskIDArg(flags, parse(flags, args))
+	if err != nil {
+		return err
+	}
+
+	s, err := loadSession()
+	if err != nil {
+		return err
+	}
+	// the task is looked up first, so that only tasks of the user can be removed
+	if _, err := findTask(s, id); err != nil {
+		return err
+	}
+	return apiError(s.client().DeleteTask(context.Background(), id))
+}
+
+func runEdit(args []string) error {
+	flags := newFlagSet("edit", "<id>")
+	description := flags.String("d", "", "new description")
+	priority := flags.String("p", "", "new priority: notset, low, normal or high")
+	output := outputFlag(flags)
+	id, err := taskIDArg(flags, parse(flags, args))
+	if err != nil {
+		return err
+	}
+
+	var update client.TaskUpdate
+	if *description != "" {
+		update.Description = description
+	}
+	if *priority != "" {
+		importance, err := models.ParseImportance(*priority)
+		if err != nil {
+			return err
+		}
+		update.Priority = &importance
+	}
+	if update.Description == nil && update.Priority == nil {
+		return errors.New("nothing to change, use -d or -p")
+	}
+
+	s, err := loadSession()
+	if err != nil {
+		return err
+	}
+	task, err := s.client().UpdateTask(context.Background(), id, update)
+	if err != nil {
+		return apiError(err)
+	}
+	return printTasks(*output, []models.Task{*task})
+}
+
+func taskIDArg(flags *flag.FlagSet, args []string) (int64, error) {
+	if len(args) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid task ID %q", args[0])
+	}
+	return id, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
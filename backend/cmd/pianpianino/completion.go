@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const bashCompletion = `_pianpianino() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "%[1]s" -- "$cur"))
+    elif [ "${COMP_WORDS[1]}" = completion ]; then
+        COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+    elif [ "${COMP_WORDS[COMP_CWORD-1]}" = -p ]; then
+        COMPREPLY=($(compgen -W "notset low normal high" -- "$cur"))
+    elif [ "${COMP_WORDS[COMP_CWORD-1]}" = -o ]; then
+        COMPREPLY=($(compgen -W "table json" -- "$cur"))
+    fi
+}
+complete -F _pianpianino pianpianino
+`
+
+const zshCompletion = `#compdef pianpianino
+_pianpianino() {
+    if (( CURRENT == 2 )); then
+        compadd %[1]s
+    elif [[ ${words[2]} == completion ]]; then
+        compadd bash zsh fish
+    elif [[ ${words[CURRENT-1]} == -p ]]; then
+        compadd notset low normal high
+    elif [[ ${words[CURRENT-1]} == -o ]]; then
+        compadd table json
+    fi
+}
+compdef _pianpianino pianpianino
+`
+
+const fishCompletion = `complete -c pianpianino -f
+complete -c pianpianino -n __fish_use_subcommand -a "%[1]s"
+complete -c pianpianino -n "__fish_seen_subcommand_from completion" -a "bash zsh fish"
+complete -c pianpianino -s p -x -a "notset low normal high"
+complete -c pianpianino -s o -x -a "table json"
+`
+
+// runCompletion prints a script to be sourced by the shell, e.g.
+// source <(pianpianino completion bash)
+func runCompletion(args []string) error {
+	flags := newFlagSet("completion", "bash|zsh|fish")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("a shell is required")
+	}
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var script string
+	switch flags.Arg(0) {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return fmt.Errorf("unsupported shell %q", flags.Arg(0))
+	}
+	fmt.Printf(script, strings.Join(names, " "))
+	return nil
+}
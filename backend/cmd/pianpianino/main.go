@@ -0,0 +1,63 @@
+// Command pianpianino manages your PianPianino tasks from the terminal,
+// talking to the REST API of a running server.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: pianpianino <command> [flags] [arguments]
+
+commands:
+  login                 log in and cache the token
+  logout                forget the cached token
+  add <description>     create a task
+  ls                    list tasks
+  done <id>             mark a task as completed
+  undo <id>             mark a task as not completed
+  rm <id>               delete a task
+  edit <id>             change the description or priority of a task
+  tui                   manage tasks in an interactive terminal UI
+  completion <shell>    print the completion script for bash, zsh or fish
+
+run "pianpianino <command> -h" for the flags of a command.
+`
+
+type command func(args []string) error
+
+var commands map[string]command
+
+// commands is filled in init because completion lists the commands itself
+func init() {
+	commands = map[string]command{
+		"login":      runLogin,
+		"logout":     runLogout,
+		"add":        runAdd,
+		"ls":         runList,
+		"done":       runDone,
+		"undo":       runUndo,
+		"rm":         runRemove,
+		"edit":       runEdit,
+		"tui":        runTUI,
+		"completion": runCompletion,
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		fmt.Print(usage)
+		return
+	}
+
+	run, found := commands[os.Args[1]]
+	if !found {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
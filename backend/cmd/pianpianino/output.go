@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"pianpianino/models"
+	"text/tabwriter"
+)
+
+func printTasks(format string, tasks []models.Task) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tasks)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDONE\tPRIORITY\tCREATED\tDESCRIPTION")
+		for _, task := range tasks {
+			done := "[ ]"
+			if task.Completed {
+				done = "[x]"
+			}
+			priority, _ := task.Priority.MarshalJSON()
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+				task.ID, done, priority[1:len(priority)-1], task.CreatedAt.Local().Format("2006-01-02 15:04"), task.Description)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
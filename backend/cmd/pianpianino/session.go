@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const defaultServer = "http://localhost:1323"
+
+// session is cached between invocations so that only login asks for a password.
+type session struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+var errNotLoggedIn = errors.New("not logged in, run: pianpianino login")
+
+func sessionPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pianpianino", "session.json"), nil
+}
+
+func loadSession() (*session, error) {
+	path, err := sessionPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNotLoggedIn
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(session)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Token == "" {
+		return nil, errNotLoggedIn
+	}
+	if server := os.Getenv("PIANPIANINO_SERVER"); server != "" {
+		s.Server = server
+	}
+	return s, nil
+}
+
+// save writes the token readable by the current user only, the same way
+// ssh and other CLIs protect their credentials.
+func (s *session) save() error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func removeSession() error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"pianpianino/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	ansiClear   = "\x1b[H\x1b[2J"
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiReverse = "\x1b[7m"
+	ansiStrike  = "\x1b[9m"
+	ansiHide    = "\x1b[?25l"
+	ansiShow    = "\x1b[?25h"
+	ansiAltOn   = "\x1b[?1049h"
+	ansiAltOff  = "\x1b[?1049l"
+)
+
+// priorityColors follow the tags of the web dashboard: red, yellow and green.
+var priorityColors = map[models.Importance]string{
+	models.High:   "\x1b[31m",
+	models.Medium: "\x1b[33m",
+	models.Low:    "\x1b[32m",
+	models.NotSet: "\x1b[37m",
+}
+
+type tuiMode int
+
+const (
+	modeList tuiMode = iota
+	modeAdd
+	modeFilter
+	modeConfirmDelete
+)
+
+type tui struct {
+	session  *session
+	tasks    []models.Task
+	visible  []models.Task
+	cursor   int
+	offset   int
+	mode     tuiMode
+	input    string
+	filter   string
+	priority models.Importance // NotSet shows every priority
+	status   string
+	updated  time.Time
+}
+
+func runTUI(args []string) error {
+	flags := newFlagSet("tui", "")
+	refresh := flags.Duration("refresh", 5*time.Second, "how often the task list is reloaded")
+	flags.Parse(args)
+
+	s, err := loadSession()
+	if err != nil {
+		return err
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("tui needs an interactive terminal")
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	fmt.Print(ansiAltOn + ansiHide)
+	defer func() {
+		fmt.Print(ansiShow + ansiAltOff)
+		term.Restore(fd, state)
+	}()
+
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 32)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- string(buf[:n])
+		}
+	}()
+
+	ticker := time.NewTicker(*refresh)
+	defer ticker.Stop()
+
+	t := &tui{session: s}
+	t.reload()
+	for {
+		t.draw()
+		select {
+		case key, ok := <-keys:
+			if !ok || !t.handleKey(key) {
+				return nil
+			}
+		case <-ticker.C:
+			// do not move the list under the user while they are typing
+			if t.mode == modeList {
+				t.reload()
+			}
+		}
+	}
+}
+
+func (t *tui) reload() {
+	tasks, err := listTasks(t.session)
+	if err != nil {
+		t.status = "error: " + err.Error()
+		return
+	}
+	t.tasks = tasks
+	t.updated = time.Now()
+	t.applyFilter()
+}
+
+func (t *tui) applyFilter() {
+	var selected int64
+	if t.cursor < len(t.visible) {
+		selected = t.visible[t.cursor].ID
+	}
+
+	t.visible = t.visible[:0]
+	for _, task := range t.tasks {
+		if t.priority != models.NotSet && task.Priority != t.priority {
+			continue
+		}
+		if t.filter != "" && !strings.Contains(strings.ToLower(task.Description), strings.ToLower(t.filter)) {
+			continue
+		}
+		t.visible = append(t.visible, task)
+	}
+	// open tasks first, then by priority and age, like the dashboard
+	sort.SliceStable(t.visible, func(i, j int) bool {
+		a, b := t.visible[i], t.visible[j]
+		if a.Completed != b.Completed {
+			return !a.Completed
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+
+	// keep the cursor on the same task across reloads
+	t.cursor = min(t.cursor, max(len(t.visible)-1, 0))
+	for i, task := range t.visible {
+		if task.ID == selected {
+			t.cursor = i
+		}
+	}
+}
+
+// handleKey returns false when the TUI should quit.
+func (t *tui) handleKey(key string) bool {
+	switch t.mode {
+	case modeAdd, modeFilter:
+		return t.handleInput(key)
+	case modeConfirmDelete:
+		if key == "y" || key == "Y" {
+			t.deleteSelected()
+		} else {
+			t.status = "delete cancelled"
+		}
+		t.mode = modeList
+		return true
+	}
+
+	t.status = ""
+	switch key {
+	case "q", "\x03":
+		return false
+	case "j", "\x1b[B":
+		if t.cursor < len(t.visible)-1 {
+			t.cursor++
+		}
+	case "k", "\x1b[A":
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case "g", "\x1b[H":
+		t.cursor = 0
+	case "G", "\x1b[F":
+		t.cursor = max(len(t.visible)-1, 0)
+	case " ", "\r", "x":
+		t.toggleSelected()
+	case "d", "\x1b[3~":
+		if len(t.visible) > 0 {
+			t.mode = modeConfirmDelete
+		}
+	case "a":
+		t.mode = modeAdd
+		t.input = ""
+	case "/":
+		t.mode = modeFilter
+		t.input = t.filter
+	case "p":
+		// cycle through all, high, normal and low
+		switch t.priority {
+		case models.NotSet:
+			t.priority = models.High
+		case models.Low:
+			t.priority = models.NotSet
+		default:
+			t.priority--
+		}
+		t.applyFilter()
+	case "r":
+		t.reload()
+		t.status = "refreshed"
+	case "\x1b":
+		t.filter = ""
+		t.priority = models.NotSet
+		t.applyFilter()
+	}
+	return true
+}
+
+func (t *tui) handleInput(key string) bool {
+	switch {
+	case key == "\x03":
+		return false
+	case key == "\x1b":
+		t.mode = modeList
+	case key == "\r":
+		if t.mode == modeAdd {
+			t.add(t.input)
+		} else {
+			t.filter = t.input
+			t.applyFilter()
+		}
+		t.mode = modeList
+	case key == "\x7f" || key == "\b":
+		if t.input != "" {
+			_, size := utf8.DecodeLastRuneInString(t.input)
+			t.input = t.input[:len(t.input)-size]
+		}
+	case strings.HasPrefix(key, "\x1b"):
+		// ignore arrows and other escape sequences while typing
+	default:
+		t.input += key
+	}
+
+	if t.mode == modeFilter {
+		t.filter = t.input
+		t.applyFilter()
+	}
+	return true
+}
+
+// add reads a leading !, !! or !!! as a low, normal or high priority,
+// so that a task can be added without leaving the input line.
+func (t *tui) add(text string) {
+	priority := models.NotSet
+	switch {
+	case strings.HasPrefix(text, "!!!"):
+		priority, text = models.High, text[3:]
+	case strings.HasPrefix(text, "!!"):
+		priority, text = models.Medium, text[2:]
+	case strings.HasPrefix(text, "!"):
+		priority, text = models.Low, text[1:]
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	_, err := t.session.client().CreateTask(context.Background(), text, priority)
+	if err != nil {
+		err = apiError(err)
+		t.status = "error: " + err.Error()
+		return
+	}
+	t.status = "added " + strconv.Quote(text)
+	t.reload()
+}
+
+func (t *tui) toggleSelected() {
+	if len(t.visible) == 0 {
+		return
+	}
+	task := t.visible[t.cursor]
+	err := apiError(t.session.client().ToggleTask(context.Background(), task.ID))
+	if err != nil {
+		t.status = "error: " + err.Error()
+		return
+	}
+	t.reload()
+}
+
+func (t *tui) deleteSelected() {
+	if len(t.visible) == 0 {
+		return
+	}
+	task := t.visible[t.cursor]
+	err := apiError(t.session.client().DeleteTask(context.Background(), task.ID))
+	if err != nil {
+		t.status = "error: " + err.Error()
+		return
+	}
+	t.status = "deleted " + strconv.Quote(task.Description)
+	t.reload()
+}
+
+func (t *tui) draw() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width == 0 || height == 0 {
+		width, height = 80, 24
+	}
+	// header, filter bar, separator, status and help lines
+	rows := max(height-5, 1)
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	}
+	if t.cursor >= t.offset+rows {
+		t.offset = t.cursor - rows + 1
+	}
+
+	var b strings.Builder
+	b.WriteString(ansiClear)
+
+	open := 0
+	for _, task := range t.tasks {
+		if !task.Completed {
+			open++
+		}
+	}
+	b.WriteString(line(width, ansiBold+"PianPianino"+ansiReset+ansiDim+
+		fmt.Sprintf("  %s  %d to do, %d tasks  updated %s", t.session.Username, open, len(t.tasks), t.updated.Format("15:04:05"))+ansiReset))
+
+	filter := "filter: " + t.filter
+	if t.mode == modeFilter {
+		filter = "filter: " + t.input + "▏"
+	}
+	priority := "all"
+	if t.priority != models.NotSet {
+		name, _ := t.priority.MarshalJSON()
+		priority = strings.Trim(string(name), `"`)
+	}
+	b.WriteString(line(width, filter+ansiDim+"   priority: "+ansiReset+priorityColors[t.priority]+priority+ansiReset))
+	b.WriteString(line(width, ansiDim+strings.Repeat("─", width)+ansiReset))
+
+	for i := t.offset; i < t.offset+rows; i++ {
+		if i >= len(t.visible) {
+			if i == 0 {
+				b.WriteString(line(width, ansiDim+"  no tasks"+ansiReset))
+			} else {
+				b.WriteString("\r\n")
+			}
+			continue
+		}
+		b.WriteString(t.taskLine(t.visible[i], i == t.cursor, width))
+	}
+
+	switch t.mode {
+	case modeAdd:
+		b.WriteString(line(width, "new task (prefix !, !! or !!! for low, normal, high): "+t.input+"▏"))
+	case modeConfirmDelete:
+		b.WriteString(line(width, "delete "+strconv.Quote(t.visible[t.cursor].Description)+"? [y/N]"))
+	default:
+		b.WriteString(line(width, t.status))
+	}
+	b.WriteString(ansiDim + "↑/↓ move  space toggle  a add  d delete  / filter  p priority  esc clear  r refresh  q quit" + ansiReset)
+
+	fmt.Print(b.String())
+}
+
+func (t *tui) taskLine(task models.Task, selected bool, width int) string {
+	check := "[ ]"
+	description := task.Description
+	if task.Completed {
+		check = "[x]"
+		description = ansiStrike + ansiDim + description + ansiReset
+	}
+	name, _ := task.Priority.MarshalJSON()
+	priority := fmt.Sprintf("%-6s", strings.Trim(string(name), `"`))
+
+	cursor := "  "
+	prefix := ""
+	if selected {
+		cursor = "> "
+		prefix = ansiReverse
+	}
+	return line(width, prefix+cursor+check+" "+ansiReset+priorityColors[task.Priority]+"●"+ansiReset+" "+
+		priority+" "+description)
+}
+
+// line ends a row of the screen, truncated to the terminal width. The width is
+// counted in runes, without the escape sequences.
+func line(width int, s string) string {
+	var b strings.Builder
+	visible := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				inEscape = false
+			}
+		default:
+			if visible >= width {
+				continue
+			}
+			visible++
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + ansiReset + "\r\n"
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"pianpianino/config"
+	"pianpianino/database"
+	"pianpianino/models"
+	"pianpianino/todotxt"
+)
+
+const todoTxtUsage = `usage:
+  go run ./cmd/ todotxt import -user <username> <file>
+  go run ./cmd/ todotxt export -user <username> [file]`
+
+// runTodoTxt imports or exports the tasks of a user straight from the
+// database, without going through the REST API.
+func runTodoTxt(args []string) {
+	if len(args) == 0 || (args[0] != "import" && args[0] != "export") {
+		log.Fatal(todoTxtUsage)
+	}
+
+	flags := flag.NewFlagSet("todotxt "+args[0], flag.ExitOnError)
+	username := flags.String("user", "", "owner of the tasks")
+	flags.Parse(args[1:])
+	if *username == "" {
+		log.Fatal(todoTxtUsage)
+	}
+
+	// the settings come from the environment, .env and the YAML file
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	db := database.InitDB(cfg.DatabaseDSN)
+	models.Migrate()
+	ctx := context.Background()
+
+	user := new(models.User)
+	err = db.NewSelect().
+		Model(user).
+		Where("username = ?", *username).
+		Scan(ctx)
+	if err != nil {
+		log.Fatalf("user %q not found", *username)
+	}
+
+	switch args[0] {
+	case "import":
+		if flags.NArg() != 1 {
+			log.Fatal(todoTxtUsage)
+		}
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+
+		imported, err := todotxt.Import(ctx, db, user.ID, file)
+		if err != nil {
+			log.Fatalf("failed to import tasks: %v", err)
+		}
+		fmt.Printf("imported %d tasks\n", imported)
+	case "export":
+		var out io.Writer = os.Stdout
+		if flags.NArg() == 1 {
+			file, err := os.Create(flags.Arg(0))
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			out = file
+		}
+
+		err := todotxt.Export(ctx, db, user.ID, out)
+		if err != nil {
+			log.Fatalf("failed to export tasks: %v", err)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+// Package config loads the settings of the server once, at startup. Each
+// setting is taken from the first of these sources that has it:
+//
+//  1. the command-line flags
+//  2. the environment
+//  3. the .env file, in the working directory or its parent
+//  4. the YAML or TOML file named by -config or PIANPIANINO_CONFIG
+//  5. the defaults
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvFile names the variable, of the environment or of .env, pointing to
+// the configuration file.
+const EnvFile = "PIANPIANINO_CONFIG"
+
+type Config struct {
+	// Host is the interface both servers listen on, all of them when empty
+	Host string `yaml:"host" toml:"host"`
+	// Port serves the REST API, GRPCPort the gRPC services
+	Port     int `yaml:"port" toml:"port"`
+	GRPCPort int `yaml:"grpc_port" toml:"grpc_port"`
+	// Socket is a Unix socket the REST API listens on instead of Host:Port,
+	// for a reverse proxy on the same machine
+	Socket string `yaml:"socket" toml:"socket"`
+	// TLSCert and TLSKey are the files of the certificate of the REST API,
+	// TLSSelfSigned generates one at startup for development instead
+	TLSCert       string `yaml:"tls_cert" toml:"tls_cert"`
+	TLSKey        string `yaml:"tls_key" toml:"tls_key"`
+	TLSSelfSigned bool   `yaml:"tls_self_signed" toml:"tls_self_signed"`
+	// HTTP2 is negotiated with TLS, or spoken in clear text to the clients
+	// that know the server supports it, such as reverse proxies
+	HTTP2 bool `yaml:"http2" toml:"http2"`
+	// the timeouts of the REST API, zero meaning none
+	ReadTimeout  time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// ShutdownTimeout is how long the requests in flight can take to finish
+	// once the server is asked to stop
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// DatabaseDSN picks the database, see database.Open
+	DatabaseDSN string `yaml:"database_dsn" toml:"database_dsn"`
+	// JWTSecret signs the tokens and the calendar feed URLs
+	JWTSecret string `yaml:"jwt_secret" toml:"jwt_secret"`
+	// CORSOrigins are the origins of the browsers allowed to call the API
+	CORSOrigins []string `yaml:"cors_origins" toml:"cors_origins"`
+	// TokenTTL is how long a token returned by /login is valid
+	TokenTTL time.Duration `yaml:"token_ttl" toml:"token_ttl"`
+}
+
+// Default has everything but the database and the secret, which have no
+// sensible default.
+func Default() *Config {
+	return &Config{
+		Port:            1323,
+		GRPCPort:        1324,
+		HTTP2:           true,
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    time.Minute,
+		IdleTimeout:     2 * time.Minute,
+		ShutdownTimeout: 15 * time.Second,
+		CORSOrigins:     []string{"http://localhost:5173", "http://localhost:1323"},
+		TokenTTL:        2 * time.Hour,
+	}
+}
+
+// variables maps the environment variables to the settings.
+var variables = map[string]func(c *Config, value string) error{
+	"HOST":             func(c *Config, v string) error { c.Host = v; return nil },
+	"PORT":             func(c *Config, v string) error { return parsePort(&c.Port, v) },
+	"GRPC_PORT":        func(c *Config, v string) error { return parsePort(&c.GRPCPort, v) },
+	"SOCKET":           func(c *Config, v string) error { c.Socket = v; return nil },
+	"TLS_CERT":         func(c *Config, v string) error { c.TLSCert = v; return nil },
+	"TLS_KEY":          func(c *Config, v string) error { c.TLSKey = v; return nil },
+	"TLS_SELF_SIGNED":  func(c *Config, v string) error { return parseBool(&c.TLSSelfSigned, v) },
+	"HTTP2":            func(c *Config, v string) error { return parseBool(&c.HTTP2, v) },
+	"READ_TIMEOUT":     func(c *Config, v string) error { return parseDuration(&c.ReadTimeout, v) },
+	"WRITE_TIMEOUT":    func(c *Config, v string) error { return parseDuration(&c.WriteTimeout, v) },
+	"IDLE_TIMEOUT":     func(c *Config, v string) error { return parseDuration(&c.IdleTimeout, v) },
+	"SHUTDOWN_TIMEOUT": func(c *Config, v string) error { return parseDuration(&c.ShutdownTimeout, v) },
+	"DATABASE_DSN":     func(c *Config, v string) error { c.DatabaseDSN = v; return nil },
+	"JWT_SECRET":       func(c *Config, v string) error { c.JWTSecret = v; return nil },
+	"CORS_ORIGINS":     func(c *Config, v string) error { c.CORSOrigins = splitList(v); return nil },
+	"TOKEN_TTL":        func(c *Config, v string) error { return parseDuration(&c.TokenTTL, v) },
+}
+
+// flags override the variables of the same name. The secret has none, it
+// would show in the list of processes.
+var flags = []struct {
+	name, variable, usage string
+	boolean               bool
+}{
+	{"host", "HOST", "interface to listen on, all of them by default", false},
+	{"port", "PORT", "port of the REST API", false},
+	{"grpc-port", "GRPC_PORT", "port of the gRPC services", false},
+	{"socket", "SOCKET", "Unix socket serving the REST API instead of the port", false},
+	{"tls-cert", "TLS_CERT", "certificate file of the REST API", false},
+	{"tls-key", "TLS_KEY", "key file of the certificate", false},
+	{"tls-self-signed", "TLS_SELF_SIGNED", "serve HTTPS with a certificate generated at startup, for development", true},
+	{"http2", "HTTP2", "serve HTTP/2 along with HTTP/1.1", true},
+	{"read-timeout", "READ_TIMEOUT", "time to read a request, e.g. 30s", false},
+	{"write-timeout", "WRITE_TIMEOUT", "time to write a response", false},
+	{"idle-timeout", "IDLE_TIMEOUT", "time a kept-alive connection waits for the next request", false},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "time the requests in flight have to finish on shutdown", false},
+	{"database-dsn", "DATABASE_DSN", "database to connect to", false},
+	{"cors-origins", "CORS_ORIGINS", "comma separated origins allowed by CORS", false},
+	{"token-ttl", "TOKEN_TTL", "lifetime of the login tokens, e.g. 2h", false},
+}
+
+// Load reads the configuration for the command-line arguments args, which
+// exclude the program name, and validates it. A missing .env is not an
+// error, a missing configuration file is.
+func Load(args []string) (*Config, error) {
+	set := flag.NewFlagSet("pianpianino", flag.ContinueOnError)
+	file := set.String("config", "", "configuration file, TOML if its extension is .toml and YAML otherwise")
+	variableOf := map[string]string{}
+	for _, f := range flags {
+		if f.boolean {
+			set.Bool(f.name, false, f.usage)
+		} else {
+			set.String(f.name, "", f.usage)
+		}
+		variableOf[f.name] = f.variable
+	}
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+	flagged := map[string]string{}
+	set.Visit(func(f *flag.Flag) {
+		if variable, ok := variableOf[f.Name]; ok {
+			flagged[variable] = f.Value.String()
+		}
+	})
+
+	dotenv, err := readDotenv()
+	if err != nil {
+		return nil, err
+	}
+	if *file == "" {
+		*file = os.Getenv(EnvFile)
+	}
+	if *file == "" {
+		*file = dotenv[EnvFile]
+	}
+
+	c := Default()
+	if *file != "" {
+		if err := c.readFile(*file); err != nil {
+			return nil, err
+		}
+	}
+	sources := []struct {
+		name   string
+		lookup func(name string) (string, bool)
+	}{
+		{".env", lookupIn(dotenv)},
+		{"environment", os.LookupEnv},
+		{"flags", lookupIn(flagged)},
+	}
+	for _, source := range sources {
+		if err := c.apply(source.lookup, source.name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, not %d", c.Port))
+	}
+	if c.GRPCPort < 1 || c.GRPCPort > 65535 {
+		errs = append(errs, fmt.Errorf("grpc_port must be between 1 and 65535, not %d", c.GRPCPort))
+	}
+	if c.Port == c.GRPCPort {
+		errs = append(errs, fmt.Errorf("port and grpc_port must differ, both are %d", c.Port))
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, errors.New("tls_cert and tls_key must be set together"))
+	}
+	if c.TLSSelfSigned && c.TLSCert != "" {
+		errs = append(errs, errors.New("tls_self_signed excludes tls_cert and tls_key"))
+	}
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_timeout", c.ReadTimeout}, {"write_timeout", c.WriteTimeout}, {"idle_timeout", c.IdleTimeout},
+	} {
+		if timeout.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, not %s", timeout.name, timeout.value))
+		}
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown_timeout must be positive, not %s", c.ShutdownTimeout))
+	}
+	if c.DatabaseDSN == "" {
+		errs = append(errs, errors.New("database_dsn is required"))
+	}
+	if c.JWTSecret == "" {
+		errs = append(errs, errors.New("jwt_secret is required"))
+	}
+	for _, origin := range c.CORSOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "" || u.Path != "") {
+			errs = append(errs, fmt.Errorf("cors_origins: %q is not an origin like https://example.com", origin))
+		}
+	}
+	if c.TokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("token_ttl must be positive, not %s", c.TokenTTL))
+	}
+	return errors.Join(errs...)
+}
+
+// TLS tells if the REST API is served over HTTPS.
+func (c *Config) TLS() bool {
+	return c.TLSCert != "" || c.TLSSelfSigned
+}
+
+// Address is the Host:Port of the REST API.
+func (c *Config) Address() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// GRPCAddress is the Host:GRPCPort of the gRPC services.
+func (c *Config) GRPCAddress() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.GRPCPort))
+}
+
+// readFile decodes a TOML file when path ends in .toml, a YAML file
+// otherwise.
+func (c *Config) readFile(path string) error {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return c.readTOML(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// a misspelled setting would be silently ignored otherwise
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) readTOML(path string) error {
+	meta, err := toml.DecodeFile(path, c)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	// as in YAML, a misspelled setting is an error
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("%s: unknown setting %s", path, undecoded[0])
+	}
+	return nil
+}
+
+// apply sets the settings whose variable lookup finds, source naming where
+// they come from in the errors.
+func (c *Config) apply(lookup func(name string) (string, bool), source string) error {
+	for name, set := range variables {
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := set(c, value); err != nil {
+			return fmt.Errorf("%s: %s: %w", source, name, err)
+		}
+	}
+	return nil
+}
+
+// readDotenv returns the variables of .env without adding them to the
+// environment, which keeps precedence over them.
+func readDotenv() (map[string]string, error) {
+	for _, path := range []string{".env", "../.env"} {
+		vars, err := godotenv.Read(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return vars, nil
+	}
+	return map[string]string{}, nil
+}
+
+func lookupIn(vars map[string]string) func(name string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func parsePort(port *int, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", value)
+	}
+	*port = n
+	return nil
+}
+
+func parseBool(b *bool, value string) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", value)
+	}
+	*b = parsed
+	return nil
+}
+
+func parseDuration(d *time.Duration, value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,48 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"pianpianino/problem"
+)
+
+var (
+	errInvalidToken  = problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token")
+	errInvalidTaskID = problem.New(http.StatusBadRequest, problem.CodeInvalidID, "Invalid task ID")
+	errMissingUser   = errors.New("the owner of a task does not exist")
+)
+
+// queryError carries the code of a problem into the extensions of a GraphQL
+// error, so that clients can rely on the same codes as with the REST routes.
+type queryError struct {
+	problem *problem.Problem
+}
+
+func (e *queryError) Error() string {
+	return e.problem.Error()
+}
+
+func (e *queryError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{
+		"code":   e.problem.Code,
+		"status": e.problem.Status,
+	}
+	if len(e.problem.Errors) > 0 {
+		extensions["errors"] = e.problem.Errors
+	}
+	return extensions
+}
+
+func wrap(err error) error {
+	return &queryError{problem: problem.From(err)}
+}
+
+// fail logs the cause of internal errors, which clients do not see.
+func fail(ctx context.Context, err error) error {
+	p := problem.From(err)
+	if cause := errors.Unwrap(p); cause != nil {
+		requestFrom(ctx).logger.Error(cause)
+	}
+	return wrap(p)
+}
@@ -0,0 +1,48 @@
+// Package gql serves the tasks and the users through GraphQL, next to the
+// REST routes and with the same rules: validation, versions and change log.
+package gql
+
+import (
+	"context"
+	_ "embed"
+	"pianpianino/service"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed schema.graphql
+var schemaSource string
+
+// MaxDepth bounds the nesting of a query, since task { user { tasks { … } } }
+// can otherwise go on forever.
+const MaxDepth = 8
+
+// Params is the body of a GraphQL request.
+type Params struct {
+	Query         string                 `json:"query" validate:"required"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type Schema struct {
+	resolver *resolver
+	schema   *graphql.Schema
+}
+
+// NewSchema parses the schema once, it panics if the schema and the
+// resolvers do not match.
+func NewSchema(tasks *service.TaskService, users *service.UserService) *Schema {
+	r := &resolver{tasks: tasks, users: users}
+	return &Schema{
+		resolver: r,
+		schema:   graphql.MustParseSchema(schemaSource, r, graphql.MaxDepth(MaxDepth)),
+	}
+}
+
+// Exec runs a query on behalf of the user, internal errors are logged to
+// logger.
+func (s *Schema) Exec(ctx context.Context, userID int64, logger echo.Logger, params Params) *graphql.Response {
+	ctx = context.WithValue(ctx, requestKey{}, newRequest(s.resolver, userID, logger))
+	return s.schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+}
@@ -0,0 +1,109 @@
+package gql
+
+import (
+	"context"
+	"sync"
+)
+
+// loader batches the queries of a single request, in the way of DataLoader:
+// the keys queued with Prime are fetched together by the first Load that
+// misses the cache, so that resolving a field on every item of a list costs
+// one query instead of one per item.
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	cache   map[K]V
+	// fetching holds the batches being fetched by the keys they contain
+	fetching map[K]*batch[K, V]
+}
+
+// batch is a fetch in progress, done is closed once values or err is set.
+type batch[K comparable, V any] struct {
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, cache: make(map[K]V), fetching: make(map[K]*batch[K, V])}
+}
+
+// Prime queues keys that are about to be loaded.
+func (l *loader[K, V]) Prime(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if _, ok := l.cache[key]; !ok {
+			l.pending = append(l.pending, key)
+		}
+	}
+}
+
+// Load returns the value of key, fetching it along with the queued keys.
+// A key the fetch function did not return has the zero value. The lock is
+// not held during the fetch, the loads of keys being fetched wait for it.
+func (l *loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	if value, ok := l.cache[key]; ok {
+		l.mu.Unlock()
+		return value, nil
+	}
+	if b, ok := l.fetching[key]; ok {
+		l.mu.Unlock()
+		return b.wait(ctx, key)
+	}
+
+	keys := unique(append(l.pending, key))
+	l.pending = nil
+	b := &batch[K, V]{done: make(chan struct{})}
+	for _, k := range keys {
+		l.fetching[k] = b
+	}
+	l.mu.Unlock()
+
+	b.values, b.err = l.fetch(ctx, keys)
+
+	l.mu.Lock()
+	for _, k := range keys {
+		delete(l.fetching, k)
+		if b.err == nil {
+			l.cache[k] = b.values[k]
+		}
+	}
+	l.mu.Unlock()
+	close(b.done)
+	return b.wait(ctx, key)
+}
+
+func (b *batch[K, V]) wait(ctx context.Context, key K) (V, error) {
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return *new(V), ctx.Err()
+	}
+	if b.err != nil {
+		return *new(V), b.err
+	}
+	return b.values[key], nil
+}
+
+// Clear forgets key, after a mutation changed its value.
+func (l *loader[K, V]) Clear(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.cache, key)
+}
+
+func unique[K comparable](keys []K) []K {
+	seen := make(map[K]bool, len(keys))
+	out := keys[:0:0]
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	return out
+}
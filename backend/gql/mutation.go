@@ -0,0 +1,109 @@
+package gql
+
+import (
+	"context"
+	"pianpianino/models"
+	"pianpianino/service"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+// The inputs carry the names of the schema, the services check the rules.
+type createTaskInput struct {
+	Description string
+	Priority    *string
+}
+
+type updateTaskInput struct {
+	Description *string
+	Priority    *string
+}
+
+func (r *resolver) CreateTask(ctx context.Context, args struct{ Input createTaskInput }) (*taskResolver, error) {
+	priority, err := parsePriority(args.Input.Priority)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	req := requestFrom(ctx)
+	task, err := r.tasks.Create(ctx, req.userID, service.NewTask{
+		Description: args.Input.Description,
+		Priority:    priority,
+	})
+	if err != nil {
+		return nil, fail(ctx, err)
+	}
+
+	req.tasks.Clear(req.userID)
+	return &taskResolver{task: *task}, nil
+}
+
+type updateTaskArgs struct {
+	ID      graphql.ID
+	Input   updateTaskInput
+	Version *int32
+}
+
+func (r *resolver) UpdateTask(ctx context.Context, args updateTaskArgs) (*taskResolver, error) {
+	patch := service.TaskPatch{Description: args.Input.Description}
+	if args.Input.Priority != nil {
+		priority, err := parsePriority(args.Input.Priority)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		patch.Priority = &priority
+	}
+
+	return r.change(ctx, args.ID, func(userID, id int64) (*models.Task, error) {
+		return r.tasks.Update(ctx, userID, id, patch, version(args.Version))
+	})
+}
+
+type taskArgs struct {
+	ID      graphql.ID
+	Version *int32
+}
+
+func (r *resolver) ToggleTask(ctx context.Context, args taskArgs) (*taskResolver, error) {
+	return r.change(ctx, args.ID, func(userID, id int64) (*models.Task, error) {
+		return r.tasks.Toggle(ctx, userID, id, version(args.Version))
+	})
+}
+
+func (r *resolver) DeleteTask(ctx context.Context, args taskArgs) (graphql.ID, error) {
+	_, err := r.change(ctx, args.ID, func(userID, id int64) (*models.Task, error) {
+		return nil, r.tasks.Delete(ctx, userID, id, version(args.Version))
+	})
+	if err != nil {
+		return "", err
+	}
+	return args.ID, nil
+}
+
+// change runs a change to the task with the given ID and forgets the tasks
+// loaded so far, which it made stale.
+func (r *resolver) change(ctx context.Context, taskID graphql.ID, apply func(userID, id int64) (*models.Task, error)) (*taskResolver, error) {
+	req := requestFrom(ctx)
+	id, err := parseID(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := apply(req.userID, id)
+	if err != nil {
+		return nil, fail(ctx, err)
+	}
+
+	req.tasks.Clear(req.userID)
+	if task == nil {
+		return nil, nil
+	}
+	return &taskResolver{task: *task}, nil
+}
+
+func version(v *int32) service.Precondition {
+	if v == nil {
+		return nil
+	}
+	return service.Version(int64(*v))
+}
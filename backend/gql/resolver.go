@@ -0,0 +1,347 @@
+package gql
+
+import (
+	"context"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/service"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/labstack/echo/v4"
+)
+
+type resolver struct {
+	tasks *service.TaskService
+	users *service.UserService
+}
+
+// request holds the state of one GraphQL request, loaders included, so that
+// nothing is cached across requests.
+type request struct {
+	userID int64
+	logger echo.Logger
+	users  *loader[int64, *models.User]
+	tasks  *loader[int64, []models.Task]
+}
+
+type requestKey struct{}
+
+func newRequest(r *resolver, userID int64, logger echo.Logger) *request {
+	return &request{
+		userID: userID,
+		logger: logger,
+		users: newLoader(func(ctx context.Context, ids []int64) (map[int64]*models.User, error) {
+			users, err := r.users.Get(ctx, ids...)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int64]*models.User, len(users))
+			for i := range users {
+				byID[users[i].ID] = &users[i]
+			}
+			return byID, nil
+		}),
+		tasks: newLoader(func(ctx context.Context, userIDs []int64) (map[int64][]models.Task, error) {
+			tasks, err := r.tasks.ListByUsers(ctx, userIDs)
+			if err != nil {
+				return nil, err
+			}
+			byUser := make(map[int64][]models.Task, len(userIDs))
+			for _, task := range tasks {
+				byUser[task.UserID] = append(byUser[task.UserID], task)
+			}
+			return byUser, nil
+		}),
+	}
+}
+
+func requestFrom(ctx context.Context) *request {
+	return ctx.Value(requestKey{}).(*request)
+}
+
+type taskFilter struct {
+	Completed *bool
+	Priority  *string
+}
+
+func (f taskFilter) match(task models.Task) bool {
+	if f.Completed != nil && task.Completed != *f.Completed {
+		return false
+	}
+	return f.Priority == nil || priorityName(task.Priority) == *f.Priority
+}
+
+func (r *resolver) Me(ctx context.Context) (*userResolver, error) {
+	req := requestFrom(ctx)
+	user, err := req.users.Load(ctx, req.userID)
+	if err != nil {
+		return nil, fail(ctx, err)
+	}
+	if user == nil {
+		return nil, wrap(errInvalidToken)
+	}
+	return &userResolver{user: user}, nil
+}
+
+func (r *resolver) Tasks(ctx context.Context, args taskFilter) ([]*taskResolver, error) {
+	return userTasks(ctx, requestFrom(ctx).userID, args)
+}
+
+func (r *resolver) Task(ctx context.Context, args struct{ ID graphql.ID }) (*taskResolver, error) {
+	req := requestFrom(ctx)
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := req.tasks.Load(ctx, req.userID)
+	if err != nil {
+		return nil, fail(ctx, err)
+	}
+	for _, task := range tasks {
+		if task.ID == id {
+			req.users.Prime(task.UserID)
+			return &taskResolver{task: task}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *resolver) Projects(ctx context.Context) ([]*projectResolver, error) {
+	req := requestFrom(ctx)
+	tasks, err := req.tasks.Load(ctx, req.userID)
+	if err != nil {
+		return nil, fail(ctx, err)
+	}
+
+	byName := make(map[string][]models.Task)
+	for _, task := range tasks {
+		for _, name := range task.Projects {
+			byName[name] = append(byName[name], task)
+		}
+	}
+	projects := make([]*projectResolver, 0, len(byName))
+	for name, tasks := range byName {
+		projects = append(projects, &projectResolver{name: name, tasks: tasks})
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].name < projects[j].name })
+	return projects, nil
+}
+
+func (r *resolver) Stats(ctx context.Context) (*statsResolver, error) {
+	return userStats(ctx, requestFrom(ctx).userID)
+}
+
+func userTasks(ctx context.Context, userID int64, filter taskFilter) ([]*taskResolver, error) {
+	req := requestFrom(ctx)
+	tasks, err := req.tasks.Load(ctx, userID)
+	if err != nil {
+		return nil, fail(ctx, err)
+	}
+
+	resolvers := make([]*taskResolver, 0, len(tasks))
+	for _, task := range tasks {
+		if filter.match(task) {
+			req.users.Prime(task.UserID)
+			resolvers = append(resolvers, &taskResolver{task: task})
+		}
+	}
+	return resolvers, nil
+}
+
+func userStats(ctx context.Context, userID int64) (*statsResolver, error) {
+	tasks, err := requestFrom(ctx).tasks.Load(ctx, userID)
+	if err != nil {
+		return nil, fail(ctx, err)
+	}
+	return &statsResolver{tasks: tasks}, nil
+}
+
+type userResolver struct {
+	user *models.User
+}
+
+func (u *userResolver) ID() graphql.ID {
+	return formatID(u.user.ID)
+}
+
+func (u *userResolver) Username() string {
+	return u.user.Username
+}
+
+func (u *userResolver) Tasks(ctx context.Context, args taskFilter) ([]*taskResolver, error) {
+	return userTasks(ctx, u.user.ID, args)
+}
+
+func (u *userResolver) Stats(ctx context.Context) (*statsResolver, error) {
+	return userStats(ctx, u.user.ID)
+}
+
+type taskResolver struct {
+	task models.Task
+}
+
+func (t *taskResolver) ID() graphql.ID {
+	return formatID(t.task.ID)
+}
+
+func (t *taskResolver) Description() string {
+	return t.task.Description
+}
+
+func (t *taskResolver) Priority() string {
+	return priorityName(t.task.Priority)
+}
+
+func (t *taskResolver) Completed() bool {
+	return t.task.Completed
+}
+
+func (t *taskResolver) Projects() []string {
+	return nonNil(t.task.Projects)
+}
+
+func (t *taskResolver) Contexts() []string {
+	return nonNil(t.task.Contexts)
+}
+
+func (t *taskResolver) UID() *string {
+	if t.task.UID == "" {
+		return nil
+	}
+	return &t.task.UID
+}
+
+func (t *taskResolver) Version() int32 {
+	return int32(t.task.Version)
+}
+
+func (t *taskResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: t.task.CreatedAt}
+}
+
+func (t *taskResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: t.task.UpdatedAt}
+}
+
+func (t *taskResolver) User(ctx context.Context) (*userResolver, error) {
+	user, err := requestFrom(ctx).users.Load(ctx, t.task.UserID)
+	if err != nil {
+		return nil, fail(ctx, err)
+	}
+	if user == nil {
+		return nil, fail(ctx, problem.Internal("Failed to fetch user", errMissingUser))
+	}
+	return &userResolver{user: user}, nil
+}
+
+// projectResolver is a project with the tasks of the user that belong to it.
+type projectResolver struct {
+	name  string
+	tasks []models.Task
+}
+
+func (p *projectResolver) Name() string {
+	return p.name
+}
+
+func (p *projectResolver) Tasks(ctx context.Context, args taskFilter) []*taskResolver {
+	req := requestFrom(ctx)
+	resolvers := make([]*taskResolver, 0, len(p.tasks))
+	for _, task := range p.tasks {
+		if args.match(task) {
+			req.users.Prime(task.UserID)
+			resolvers = append(resolvers, &taskResolver{task: task})
+		}
+	}
+	return resolvers
+}
+
+func (p *projectResolver) Stats() *statsResolver {
+	return &statsResolver{tasks: p.tasks}
+}
+
+type statsResolver struct {
+	tasks []models.Task
+}
+
+func (s *statsResolver) Total() int32 {
+	return int32(len(s.tasks))
+}
+
+func (s *statsResolver) Completed() int32 {
+	var completed int32
+	for _, task := range s.tasks {
+		if task.Completed {
+			completed++
+		}
+	}
+	return completed
+}
+
+func (s *statsResolver) Open() int32 {
+	return s.Total() - s.Completed()
+}
+
+func (s *statsResolver) ByPriority() []*priorityCountResolver {
+	counts := make([]*priorityCountResolver, 0, models.High+1)
+	for p := models.NotSet; p <= models.High; p++ {
+		count := &priorityCountResolver{priority: p}
+		for _, task := range s.tasks {
+			if task.Priority == p {
+				count.count++
+			}
+		}
+		counts = append(counts, count)
+	}
+	return counts
+}
+
+type priorityCountResolver struct {
+	priority models.Importance
+	count    int32
+}
+
+func (p *priorityCountResolver) Priority() string {
+	return priorityName(p.priority)
+}
+
+func (p *priorityCountResolver) Count() int32 {
+	return p.count
+}
+
+// priorityName is the GraphQL enum value of a priority, the JSON name in
+// upper case.
+func priorityName(i models.Importance) string {
+	name, _ := i.MarshalJSON()
+	return strings.ToUpper(strings.Trim(string(name), `"`))
+}
+
+func parsePriority(name *string) (models.Importance, error) {
+	if name == nil {
+		return models.NotSet, nil
+	}
+	return models.ParseImportance(*name)
+}
+
+// nonNil makes a list that is never null, as the schema wants.
+func nonNil(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
+
+func formatID(id int64) graphql.ID {
+	return graphql.ID(strconv.FormatInt(id, 10))
+}
+
+func parseID(id graphql.ID) (int64, error) {
+	parsed, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil {
+		return 0, wrap(errInvalidTaskID)
+	}
+	return parsed, nil
+}
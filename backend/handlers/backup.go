@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pianpianino/backup"
+	"pianpianino/problem"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+)
+
+type BackupHandler struct {
+	DB *bun.DB
+}
+
+func (h *BackupHandler) Export(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return problem.Write(c, errInvalidToken)
+	}
+
+	doc, err := backup.Export(c.Request().Context(), h.DB, int64(userID))
+	if err != nil {
+		return problem.Write(c, problem.Internal("Failed to export data", err))
+	}
+
+	filename := "pianpianino-" + time.Now().Format("2006-01-02") + ".json"
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.JSON(http.StatusOK, doc)
+}
+
+// Import restores a document produced by Export, the ?mode= query parameter
+// selects between "merge" (the default) and "replace".
+func (h *BackupHandler) Import(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return problem.Write(c, errInvalidToken)
+	}
+
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = backup.ModeMerge
+	}
+	if mode != backup.ModeMerge && mode != backup.ModeReplace {
+		return problem.Write(c, problem.Validation().Field("mode", problem.FieldInvalid, "Mode must be merge or replace"))
+	}
+
+	var doc backup.Document
+	if err := c.Bind(&doc); err != nil {
+		return problem.Write(c, problem.InvalidBody(err))
+	}
+	// the whole document is checked before anything is deleted or inserted
+	if err := validate(c, &doc); err != nil {
+		return problem.Write(c, err)
+	}
+
+	result, err := backup.Import(c.Request().Context(), h.DB, int64(userID), &doc, mode)
+	if errors.Is(err, backup.ErrUnsupportedVersion) {
+		return problem.Write(c, problem.Validation().Field("version", problem.FieldInvalid,
+			"Unsupported backup version "+strconv.Itoa(doc.Version)))
+	}
+	if err != nil {
+		return problem.Write(c, problem.Internal("Failed to import data", err))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Data imported successfully",
+		"result":  result,
+	})
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/service"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// BatchAtomic applies every operation or none of them
+	BatchAtomic = "atomic"
+	// BatchBestEffort applies the operations that succeed and reports the others
+	BatchBestEffort = "best_effort"
+)
+
+const (
+	OpCreate   = "create"
+	OpUpdate   = "update"
+	OpToggle   = "toggle"
+	OpComplete = "complete"
+	OpDelete   = "delete"
+	OpMove     = "move"
+	// OpPrioritize is another name of OpMove
+	OpPrioritize = "prioritize"
+)
+
+// BatchRequest is limited to 100 operations, which keeps the transaction of
+// an atomic batch short.
+type BatchRequest struct {
+	Mode       string           `json:"mode,omitempty" validate:"omitempty,oneof=atomic best_effort"`
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,max=100,dive"`
+}
+
+// BatchOperation is one change to a task. ID is needed by every operation
+// but create, Description by create and Priority by move, which moves the
+// task to another priority and changes nothing else. Like If-Match, a
+// Version makes the operation fail if the task has another version.
+type BatchOperation struct {
+	Op          string             `json:"op" validate:"required,oneof=create update toggle complete delete move prioritize"`
+	ID          int64              `json:"id,omitempty" validate:"required_unless=Op create"`
+	Version     int64              `json:"version,omitempty"`
+	Description *string            `json:"description,omitempty" validate:"required_if=Op create,omitnil,min=1,max=1000"`
+	Priority    *models.Importance `json:"priority,omitempty" validate:"required_if=Op move,required_if=Op prioritize,omitnil,importance"`
+}
+
+// BatchResult is the outcome of the operation at Index, Status being the
+// status code the operation would have had on its own route.
+type BatchResult struct {
+	Index  int              `json:"index"`
+	Op     string           `json:"op"`
+	ID     int64            `json:"id,omitempty"`
+	Status int              `json:"status"`
+	Task   *models.Task     `json:"task,omitempty"`
+	Error  *problem.Problem `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode      string        `json:"mode"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// Batch applies a list of task operations in order. In atomic mode, the
+// default, they share one transaction and the first failure rolls all of
+// them back; in best effort mode each one is committed on its own.
+func (h *TaskHandler) Batch(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return problem.Write(c, errInvalidToken)
+	}
+
+	var req BatchRequest
+	if err := c.Bind(&req); err != nil {
+		return problem.Write(c, problem.InvalidBody(err))
+	}
+
+	if err := validate(c, &req); err != nil {
+		return problem.Write(c, err)
+	}
+	if req.Mode == "" {
+		req.Mode = BatchAtomic
+	}
+
+	ctx := c.Request().Context()
+	response := BatchResponse{Mode: req.Mode, Results: make([]BatchResult, 0, len(req.Operations))}
+
+	tasks := h.Tasks
+	if req.Mode == BatchBestEffort {
+		// every operation is written on its own
+		for i, op := range req.Operations {
+			response.add(c, applyOperation(ctx, tasks, int64(userID), i, op))
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+
+	var failed *BatchResult
+	err = tasks.Atomic(ctx, func(ctx context.Context, tasks *service.TaskService) error {
+		for i, op := range req.Operations {
+			result := applyOperation(ctx, tasks, int64(userID), i, op)
+			if result.Error != nil {
+				failed = &result
+				return result.Error
+			}
+			response.Results = append(response.Results, result)
+		}
+		return nil
+	})
+	if failed != nil {
+		if cause := errors.Unwrap(failed.Error); cause != nil {
+			c.Logger().Error(cause)
+		}
+		p := problem.New(failed.Status, problem.CodeBatchFailed,
+			"Operation "+strconv.Itoa(failed.Index)+" failed, no change was made")
+		return problem.Write(c, p.Field(
+			"operations["+strconv.Itoa(failed.Index)+"]", string(failed.Error.Code), failed.Error.Detail))
+	}
+	if err != nil {
+		return problem.Write(c, problem.Internal("Failed to apply operations", err))
+	}
+
+	response.Succeeded = len(response.Results)
+	return c.JSON(http.StatusOK, response)
+}
+
+func (r *BatchResponse) add(c echo.Context, result BatchResult) {
+	if result.Error == nil {
+		r.Succeeded++
+	} else {
+		r.Failed++
+		if cause := errors.Unwrap(result.Error); cause != nil {
+			c.Logger().Error(cause)
+		}
+	}
+	r.Results = append(r.Results, result)
+}
+
+func applyOperation(ctx context.Context, tasks *service.TaskService, userID int64, index int, op BatchOperation) BatchResult {
+	if op.Op == OpCreate {
+		input := service.NewTask{Description: *op.Description}
+		if op.Priority != nil {
+			input.Priority = *op.Priority
+		}
+		task, err := tasks.Create(ctx, userID, input)
+		if err != nil {
+			return failedOperation(index, op, problem.From(err))
+		}
+		return BatchResult{Index: index, Op: op.Op, ID: task.ID, Status: http.StatusCreated, Task: task}
+	}
+
+	cond := service.Version(op.Version)
+	if op.Op == OpDelete {
+		if err := tasks.Delete(ctx, userID, op.ID, cond); err != nil {
+			return failedOperation(index, op, problem.From(err))
+		}
+		return BatchResult{Index: index, Op: op.Op, ID: op.ID, Status: http.StatusOK}
+	}
+
+	var task *models.Task
+	var err error
+	switch op.Op {
+	case OpUpdate:
+		task, err = tasks.Update(ctx, userID, op.ID, service.TaskPatch{Description: op.Description, Priority: op.Priority}, cond)
+	case OpMove, OpPrioritize:
+		task, err = tasks.Update(ctx, userID, op.ID, service.TaskPatch{Priority: op.Priority}, cond)
+	case OpToggle:
+		task, err = tasks.Toggle(ctx, userID, op.ID, cond)
+	case OpComplete:
+		completed := true
+		task, err = tasks.Update(ctx, userID, op.ID, service.TaskPatch{Completed: &completed}, cond)
+	}
+	if err != nil {
+		return failedOperation(index, op, problem.From(err))
+	}
+	return BatchResult{Index: index, Op: op.Op, ID: task.ID, Status: http.StatusOK, Task: task}
+}
+
+func failedOperation(index int, op BatchOperation, p *problem.Problem) BatchResult {
+	return BatchResult{Index: index, Op: op.Op, ID: op.ID, Status: p.Status, Error: p}
+}
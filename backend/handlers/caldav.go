@@ -0,0 +1,525 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"pianpianino/ical"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/repository"
+	"pianpianino/service"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	CalDAVRoot       = "/caldav/"
+	CalDAVCollection = "/caldav/tasks/"
+
+	headerETag       = "ETag"
+	caldavUserKey    = "caldav_user_id"
+	calendarDataMIME = "text/calendar; charset=utf-8; component=VTODO"
+)
+
+// CalDAVHandler implements the subset of WebDAV and CalDAV (RFC 4918, RFC 4791)
+// needed by reminder apps to sync the tasks of a user as a single VTODO calendar.
+// The tasks are read from DB and written through Tasks.
+type CalDAVHandler struct {
+	DB    *bun.DB
+	Tasks *service.TaskService
+}
+
+// NewCalDAVHandler serves the tasks of DB through a TaskService.
+func NewCalDAVHandler(DB *bun.DB) *CalDAVHandler {
+	return &CalDAVHandler{DB: DB, Tasks: service.NewTaskService(repository.NewBunTasks(DB))}
+}
+
+// Authenticate checks HTTP Basic credentials against the users table,
+// since CalDAV clients cannot obtain a JWT through /login.
+func (h *CalDAVHandler) Authenticate(username, password string, c echo.Context) (bool, error) {
+	user := new(models.User)
+	err := h.DB.NewSelect().
+		Model(user).
+		Where("username = ?", username).
+		Scan(c.Request().Context())
+	if err != nil {
+		return false, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		return false, nil
+	}
+
+	c.Set(caldavUserKey, int(user.ID))
+	return true, nil
+}
+
+func (h *CalDAVHandler) Options(c echo.Context) error {
+	c.Response().Header().Set("DAV", "1, 3, calendar-access")
+	c.Response().Header().Set(echo.HeaderAllow, "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	return c.NoContent(http.StatusOK)
+}
+
+// PropfindRoot answers principal and calendar home discovery, both of which
+// point back at the root since every user has exactly one task calendar.
+func (h *CalDAVHandler) PropfindRoot(c echo.Context) error {
+	responses := []davResponse{{
+		href: CalDAVRoot,
+		props: []string{
+			"<d:resourcetype><d:collection/></d:resourcetype>",
+			"<d:displayname>PianPianino</d:displayname>",
+			"<d:current-user-principal><d:href>" + CalDAVRoot + "</d:href></d:current-user-principal>",
+			"<d:principal-URL><d:href>" + CalDAVRoot + "</d:href></d:principal-URL>",
+			"<c:calendar-home-set><d:href>" + CalDAVRoot + "</d:href></c:calendar-home-set>",
+		},
+	}}
+
+	if c.Request().Header.Get("Depth") != "0" {
+		tasks, err := h.userTasks(c)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch tasks"})
+		}
+		responses = append(responses, collectionResponse(tasks))
+	}
+
+	return writeMultistatus(c, responses)
+}
+
+func (h *CalDAVHandler) PropfindCollection(c echo.Context) error {
+	tasks, err := h.userTasks(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch tasks"})
+	}
+
+	responses := []davResponse{collectionResponse(tasks)}
+	if c.Request().Header.Get("Depth") != "0" {
+		for _, task := range tasks {
+			responses = append(responses, resourceResponse(task, false))
+		}
+	}
+
+	return writeMultistatus(c, responses)
+}
+
+func (h *CalDAVHandler) PropfindResource(c echo.Context) error {
+	task, err := h.findResource(c)
+	if err != nil {
+		return resourceError(c, err)
+	}
+
+	return writeMultistatus(c, []davResponse{resourceResponse(*task, false)})
+}
+
+// Report supports calendar-query, which returns every task, and
+// calendar-multiget, which returns the tasks listed by href.
+func (h *CalDAVHandler) Report(c echo.Context) error {
+	report, err := parseReport(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid REPORT body"})
+	}
+
+	tasks, err := h.userTasks(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch tasks"})
+	}
+
+	responses := make([]davResponse, 0)
+	switch report.name {
+	case "calendar-query":
+		if !report.wantsTodos() {
+			break
+		}
+		for _, task := range tasks {
+			responses = append(responses, resourceResponse(task, report.calendarData))
+		}
+	case "calendar-multiget":
+		// hrefs are compared unescaped, clients do not agree on what to escape
+		byPath := make(map[string]models.Task, len(tasks))
+		for _, task := range tasks {
+			byPath[CalDAVCollection+taskResource(task)+".ics"] = task
+		}
+		for _, href := range report.hrefs {
+			path := href
+			if u, err := url.Parse(href); err == nil {
+				path = u.Path
+			}
+			task, found := byPath[path]
+			if !found {
+				responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+				continue
+			}
+			responses = append(responses, resourceResponse(task, report.calendarData))
+		}
+	default:
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "Unsupported report"})
+	}
+
+	return writeMultistatus(c, responses)
+}
+
+func (h *CalDAVHandler) GetResource(c echo.Context) error {
+	task, err := h.findResource(c)
+	if err != nil {
+		return resourceError(c, err)
+	}
+
+	data := renderTodo(*task)
+	c.Response().Header().Set(headerETag, etag(data))
+	return c.Blob(http.StatusOK, calendarDataMIME, data)
+}
+
+// PutResource creates or replaces a task, honoring If-Match and If-None-Match
+// so that concurrent edits from different devices are not lost.
+func (h *CalDAVHandler) PutResource(c echo.Context) error {
+	userID := int64(c.Get(caldavUserKey).(int))
+
+	existing, err := h.findResource(c)
+	if errors.Is(err, sql.ErrNoRows) {
+		existing = nil
+	} else if err != nil {
+		return resourceError(c, err)
+	}
+	if !preconditionsHold(c, existing) {
+		return c.JSON(http.StatusPreconditionFailed, echo.Map{"error": "Task has been modified"})
+	}
+
+	todo, err := ical.ParseTodo(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid calendar data"})
+	}
+
+	ctx := c.Request().Context()
+	var task *models.Task
+	status := http.StatusNoContent
+	if existing == nil {
+		name := resourceName(c)
+		uid := todo.UID
+		if uid == "" {
+			uid = name
+		}
+		// a UID names a single resource of the collection, RFC 4791 5.3.2.1
+		taken, err := h.uidTaken(c, uid)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to save task"})
+		}
+		if taken {
+			return c.JSON(http.StatusConflict, echo.Map{"error": "A task with this UID exists under another name"})
+		}
+		task, err = h.Tasks.Create(ctx, userID, service.NewTask{
+			Description: todo.Summary,
+			Priority:    ical.Importance(todo.Priority),
+			Completed:   todo.Completed,
+			UID:         uid,
+			DAVName:     name,
+		})
+		status = http.StatusCreated
+	} else {
+		priority := ical.Importance(todo.Priority)
+		patch := service.TaskPatch{Description: &todo.Summary, Priority: &priority, Completed: &todo.Completed}
+		task, err = h.Tasks.Update(ctx, userID, existing.ID, patch, h.unchanged(c))
+	}
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	// reload the task so the ETag reflects what the database stored
+	task, err = h.Tasks.Get(ctx, userID, task.ID)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	c.Response().Header().Set(headerETag, etag(renderTodo(*task)))
+	return c.NoContent(status)
+}
+
+func (h *CalDAVHandler) DeleteResource(c echo.Context) error {
+	task, err := h.findResource(c)
+	if err != nil {
+		return resourceError(c, err)
+	}
+	if !preconditionsHold(c, task) {
+		return c.JSON(http.StatusPreconditionFailed, echo.Map{"error": "Task has been modified"})
+	}
+
+	err = h.Tasks.Delete(c.Request().Context(), task.UserID, task.ID, h.unchanged(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// unchanged checks the preconditions again against the task the service
+// loads, which another request may have changed since findResource.
+func (h *CalDAVHandler) unchanged(c echo.Context) service.Precondition {
+	return func(task *models.Task) bool {
+		return task != nil && preconditionsHold(c, task)
+	}
+}
+
+func (h *CalDAVHandler) userTasks(c echo.Context) ([]models.Task, error) {
+	tasks := make([]models.Task, 0)
+	err := h.DB.NewSelect().
+		Model(&tasks).
+		Where("user_id = ?", c.Get(caldavUserKey).(int)).
+		Order("id ASC").
+		Scan(c.Request().Context())
+	return tasks, err
+}
+
+// findResource looks a task up by its resource name: the name it was
+// created at through CalDAV or else its path-escaped UID, followed by ".ics".
+func (h *CalDAVHandler) findResource(c echo.Context) (*models.Task, error) {
+	name := resourceName(c)
+	taskID, ok := ical.TaskID(name)
+	if !ok {
+		taskID = -1
+	}
+
+	task := new(models.Task)
+	err := h.DB.NewSelect().
+		Model(task).
+		Where("user_id = ?", c.Get(caldavUserKey).(int)).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("dav_name = ?", name).
+				WhereOr("dav_name IS NULL AND uid = ?", name).
+				WhereOr("dav_name IS NULL AND uid IS NULL AND id = ?", taskID)
+		}).
+		Scan(c.Request().Context())
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// uidTaken tells whether a task of the user already has uid, whatever its
+// resource name.
+func (h *CalDAVHandler) uidTaken(c echo.Context, uid string) (bool, error) {
+	taskID, ok := ical.TaskID(uid)
+	if !ok {
+		taskID = -1
+	}
+
+	return h.DB.NewSelect().
+		Model((*models.Task)(nil)).
+		Where("user_id = ?", c.Get(caldavUserKey).(int)).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("uid = ?", uid).
+				WhereOr("uid IS NULL AND id = ?", taskID)
+		}).
+		Exists(c.Request().Context())
+}
+
+// resourceError answers 404 when findResource found no task.
+func resourceError(c echo.Context, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Task not found"})
+	}
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch task"})
+}
+
+// serviceError answers with the status of a failure of the TaskService.
+func serviceError(c echo.Context, err error) error {
+	p := problem.From(err)
+	if cause := errors.Unwrap(p); cause != nil {
+		c.Logger().Error(cause)
+	}
+	return c.JSON(p.Status, echo.Map{"error": p.Error()})
+}
+
+func resourceName(c echo.Context) string {
+	name := c.Param("name")
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return strings.TrimSuffix(name, ".ics")
+}
+
+func resourceHref(task models.Task) string {
+	return CalDAVCollection + url.PathEscape(taskResource(task)) + ".ics"
+}
+
+// taskResource is the resource name of task, without .ics.
+func taskResource(task models.Task) string {
+	if task.DAVName != "" {
+		return task.DAVName
+	}
+	return ical.UID(task)
+}
+
+func preconditionsHold(c echo.Context, existing *models.Task) bool {
+	ifMatch := c.Request().Header.Get("If-Match")
+	ifNoneMatch := c.Request().Header.Get("If-None-Match")
+
+	if ifNoneMatch == "*" && existing != nil {
+		return false
+	}
+	if ifMatch == "" {
+		return true
+	}
+	if existing == nil {
+		return false
+	}
+	return ifMatch == "*" || ifMatch == etag(renderTodo(*existing))
+}
+
+func renderTodo(task models.Task) []byte {
+	var buf bytes.Buffer
+	// writing to a bytes.Buffer cannot fail
+	_ = ical.WriteTodo(&buf, task)
+	return buf.Bytes()
+}
+
+func etag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// ctag changes whenever any task of the collection changes, letting
+// clients skip a full sync when nothing happened.
+func ctag(tasks []models.Task) string {
+	hash := sha256.New()
+	for _, task := range tasks {
+		hash.Write([]byte(resourceHref(task) + etag(renderTodo(task))))
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+type davResponse struct {
+	href   string
+	status int
+	// props are already rendered XML elements, all of them found
+	props []string
+}
+
+func collectionResponse(tasks []models.Task) davResponse {
+	return davResponse{
+		href: CalDAVCollection,
+		props: []string{
+			"<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>",
+			"<d:displayname>PianPianino</d:displayname>",
+			`<c:supported-calendar-component-set><c:comp name="VTODO"/></c:supported-calendar-component-set>`,
+			"<d:current-user-privilege-set><d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege></d:current-user-privilege-set>",
+			"<cs:getctag>" + ctag(tasks) + "</cs:getctag>",
+		},
+	}
+}
+
+func resourceResponse(task models.Task, withData bool) davResponse {
+	data := renderTodo(task)
+	props := []string{
+		"<d:resourcetype/>",
+		"<d:getcontenttype>" + calendarDataMIME + "</d:getcontenttype>",
+		"<d:getetag>" + escapeXML(etag(data)) + "</d:getetag>",
+	}
+	if withData {
+		props = append(props, "<c:calendar-data>"+escapeXML(string(data))+"</c:calendar-data>")
+	}
+	return davResponse{href: resourceHref(task), props: props}
+}
+
+func writeMultistatus(c echo.Context, responses []davResponse) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	for _, r := range responses {
+		b.WriteString("<d:response><d:href>" + escapeXML(r.href) + "</d:href>")
+		if r.status != 0 {
+			b.WriteString("<d:status>HTTP/1.1 " + strconv.Itoa(r.status) + " " + http.StatusText(r.status) + "</d:status>")
+		} else {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, prop := range r.props {
+				b.WriteString(prop)
+			}
+			b.WriteString("</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	b.WriteString("</d:multistatus>")
+
+	return c.Blob(http.StatusMultiStatus, echo.MIMEApplicationXMLCharsetUTF8, []byte(b.String()))
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+type davReport struct {
+	name         string
+	hrefs        []string
+	components   []string
+	calendarData bool
+}
+
+// wantsTodos reports whether the calendar-query filter can match VTODOs,
+// clients often query for VEVENTs first and those must come back empty.
+func (r davReport) wantsTodos() bool {
+	for _, comp := range r.components {
+		if comp != "VCALENDAR" && comp != "VTODO" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseReport(body io.Reader) (davReport, error) {
+	var report davReport
+	decoder := xml.NewDecoder(body)
+	var inHref bool
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if report.name == "" {
+				report.name = t.Name.Local
+			}
+			switch t.Name.Local {
+			case "href":
+				inHref = true
+				report.hrefs = append(report.hrefs, "")
+			case "calendar-data":
+				report.calendarData = true
+			case "comp-filter":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "name" {
+						report.components = append(report.components, strings.ToUpper(attr.Value))
+					}
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "href" {
+				inHref = false
+			}
+		case xml.CharData:
+			if inHref {
+				report.hrefs[len(report.hrefs)-1] += strings.TrimSpace(string(t))
+			}
+		}
+	}
+
+	if report.name == "" {
+		return report, errors.New("empty REPORT body")
+	}
+	return report, nil
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"pianpianino/ical"
+	"pianpianino/models"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+)
+
+type CalendarHandler struct {
+	DB        *bun.DB
+	JWTSecret string
+}
+
+// The feed token is signed with the JWT secret, so calendar apps can subscribe
+// without sending an Authorization header and without the token ever expiring.
+func (h *CalendarHandler) feedToken(userID int) string {
+	id := strconv.Itoa(userID)
+	mac := hmac.New(sha256.New, []byte(h.JWTSecret))
+	mac.Write([]byte("ical:" + id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *CalendarHandler) userIDFromFeedToken(token string) (int, bool) {
+	id, _, found := strings.Cut(token, ".")
+	if !found {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, false
+	}
+	if !hmac.Equal([]byte(token), []byte(h.feedToken(userID))) {
+		return 0, false
+	}
+	return userID, true
+}
+
+func (h *CalendarHandler) GetFeedURL(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token"})
+	}
+
+	path := "/calendar/" + h.feedToken(userID) + ".ics"
+	return c.JSON(http.StatusOK, echo.Map{
+		"url": c.Scheme() + "://" + c.Request().Host + path,
+	})
+}
+
+func (h *CalendarHandler) Feed(c echo.Context) error {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+	userID, ok := h.userIDFromFeedToken(token)
+	if !ok {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Calendar not found"})
+	}
+
+	tasks := make([]models.Task, 0)
+	err := h.DB.NewSelect().
+		Model(&tasks).
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Scan(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch tasks"})
+	}
+
+	var buf bytes.Buffer
+	if err := ical.WriteCalendar(&buf, "PianPianino", tasks); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to render calendar"})
+	}
+
+	return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
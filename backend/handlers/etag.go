@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"pianpianino/models"
+	"pianpianino/service"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// taskETag is derived from the version of the task, which changes with every
+// write. A CalDAV ETag is instead derived from the iCalendar rendering.
+func taskETag(task *models.Task) string {
+	return `"` + strconv.FormatInt(task.Version, 10) + `"`
+}
+
+// listETag changes whenever a task is added to, changed in or removed from
+// the list.
+func listETag(tasks []models.Task) string {
+	hash := sha256.New()
+	for _, task := range tasks {
+		hash.Write([]byte(strconv.FormatInt(task.ID, 10) + ":" + strconv.FormatInt(task.Version, 10) + ","))
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:8]) + `"`
+}
+
+// ifMatch reports whether the If-Match header of the request, if any, lets
+// the task be changed. A missing task matches no ETag, not even "*".
+func ifMatch(c echo.Context, task *models.Task) bool {
+	header := c.Request().Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	if task == nil {
+		return false
+	}
+	// If-Match uses the strong comparison, weak ETags never match
+	return matchETag(header, taskETag(task), false)
+}
+
+// ifMatchCondition lets the task service check If-Match.
+func ifMatchCondition(c echo.Context) service.Precondition {
+	return func(task *models.Task) bool {
+		return ifMatch(c, task)
+	}
+}
+
+// notModified reports whether the If-None-Match header of the request
+// already names etag.
+func notModified(c echo.Context, etag string) bool {
+	header := c.Request().Header.Get("If-None-Match")
+	return header != "" && matchETag(header, etag, true)
+}
+
+func matchETag(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"pianpianino/gql"
+	"pianpianino/problem"
+
+	"github.com/labstack/echo/v4"
+)
+
+type GraphQLHandler struct {
+	Schema *gql.Schema
+}
+
+// Query runs a GraphQL query or mutation. As usual with GraphQL, errors of
+// the query itself are answered with a 200 and listed in "errors", with the
+// problem code in their extensions.
+func (h *GraphQLHandler) Query(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return problem.Write(c, errInvalidToken)
+	}
+
+	var params gql.Params
+	if err := c.Bind(&params); err != nil {
+		return problem.Write(c, problem.InvalidBody(err))
+	}
+
+	if err := validate(c, &params); err != nil {
+		return problem.Write(c, err)
+	}
+
+	response := h.Schema.Exec(c.Request().Context(), int64(userID), c.Logger(), params)
+	return c.JSON(http.StatusOK, response)
+}
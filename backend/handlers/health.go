@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"pianpianino/database"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/version"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+)
+
+// readyTimeout bounds the checks of Readyz, a database that does not answer
+// in time is not ready.
+const readyTimeout = 3 * time.Second
+
+// HealthHandler answers the probes of load balancers and orchestrators. Its
+// routes are public and their queries are not logged.
+type HealthHandler struct {
+	DB *bun.DB
+}
+
+// Healthz tells that the process is alive, without touching the database.
+func (h *HealthHandler) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+}
+
+// Readyz tells whether the server can take requests: the database answers
+// and has every table and column of this release.
+func (h *HealthHandler) Readyz(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(database.Quiet(c.Request().Context()), readyTimeout)
+	defer cancel()
+
+	if err := h.DB.PingContext(ctx); err != nil {
+		return problem.Write(c, problem.New(http.StatusServiceUnavailable, problem.CodeNotReady, "The database is unreachable"))
+	}
+	pending, err := models.Pending(ctx, h.DB)
+	if err != nil {
+		return problem.Write(c, problem.New(http.StatusServiceUnavailable, problem.CodeNotReady, "The database schema could not be read"))
+	}
+	if len(pending) > 0 {
+		return problem.Write(c, problem.New(http.StatusServiceUnavailable, problem.CodeNotReady,
+			"The database is not migrated, missing "+strings.Join(pending, ", ")))
+	}
+	return c.JSON(http.StatusOK, echo.Map{"status": "ready"})
+}
+
+// Version describes the build of the server.
+func (h *HealthHandler) Version(c echo.Context) error {
+	return c.JSON(http.StatusOK, version.Get())
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"pianpianino/importers"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+)
+
+// ImportHandler brings in tasks from files produced by other tools. Every
+// import can be previewed with dry_run=true before anything is stored.
+type ImportHandler struct {
+	DB *bun.DB
+}
+
+// CSV expects a multipart form with the "file" to import, an optional
+// "mapping" of task fields to column names as JSON and an optional "dry_run".
+func (h *ImportHandler) CSV(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token"})
+	}
+
+	mapping := importers.DefaultCSVMapping
+	if raw := c.FormValue("mapping"); raw != "" {
+		mapping = importers.CSVMapping{}
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid column mapping"})
+		}
+	}
+
+	file, err := openUpload(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "A file is required"})
+	}
+	defer file.Close()
+
+	report, err := importers.ParseCSV(file, mapping)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return h.commit(c, int64(userID), report)
+}
+
+func (h *ImportHandler) Todoist(c echo.Context) error {
+	return h.importFile(c, importers.ParseTodoist)
+}
+
+func (h *ImportHandler) MicrosoftToDo(c echo.Context) error {
+	return h.importFile(c, importers.ParseMicrosoftToDo)
+}
+
+func (h *ImportHandler) GoogleTasks(c echo.Context) error {
+	return h.importFile(c, importers.ParseGoogleTasks)
+}
+
+func (h *ImportHandler) importFile(c echo.Context, parse func(io.Reader) (*importers.Report, error)) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token"})
+	}
+
+	file, err := openUpload(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "A file is required"})
+	}
+	defer file.Close()
+
+	report, err := parse(file)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return h.commit(c, int64(userID), report)
+}
+
+func (h *ImportHandler) commit(c echo.Context, userID int64, report *importers.Report) error {
+	if dryRun, _ := strconv.ParseBool(c.FormValue("dry_run")); dryRun {
+		return c.JSON(http.StatusOK, echo.Map{
+			"dry_run": true,
+			"report":  report,
+		})
+	}
+
+	err := importers.Commit(c.Request().Context(), h.DB, userID, report)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to import tasks"})
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{
+		"message":  "Tasks imported successfully",
+		"imported": len(report.Accepted),
+		"report":   report,
+	})
+}
+
+func openUpload(c echo.Context) (io.ReadCloser, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	return header.Open()
+}
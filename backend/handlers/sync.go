@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"pianpianino/problem"
+	"pianpianino/tasksync"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SyncPushRequest struct {
+	Mutations []tasksync.Mutation `json:"mutations" validate:"required,min=1,max=500,dive"`
+}
+
+// PullChanges answers with the tasks changed and deleted since the ?since=
+// cursor, omitted for a full sync, at most ?limit= of them.
+func (h *TaskHandler) PullChanges(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return problem.Write(c, errInvalidToken)
+	}
+
+	since, err := queryInt(c, "since")
+	if err != nil || since < 0 {
+		return problem.Write(c, problem.Validation().
+			Field("since", problem.FieldInvalid, "since must be a cursor returned by a previous sync"))
+	}
+	limit, err := queryInt(c, "limit")
+	if err != nil || limit < 0 || limit > tasksync.MaxPull {
+		return problem.Write(c, problem.Validation().
+			Field("limit", problem.FieldInvalid, "limit must be between 1 and "+strconv.Itoa(tasksync.MaxPull)))
+	}
+
+	delta, err := tasksync.Pull(c.Request().Context(), h.DB, int64(userID), since, int(limit))
+	if err != nil {
+		return problem.Write(c, problem.Internal("Failed to fetch changes", err))
+	}
+	return c.JSON(http.StatusOK, delta)
+}
+
+// PushChanges applies the mutations queued by an offline client and reports
+// the conflicts, which the client resolves before pushing them again.
+func (h *TaskHandler) PushChanges(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return problem.Write(c, errInvalidToken)
+	}
+
+	var req SyncPushRequest
+	if err := c.Bind(&req); err != nil {
+		return problem.Write(c, problem.InvalidBody(err))
+	}
+
+	if err := validate(c, &req); err != nil {
+		return problem.Write(c, err)
+	}
+
+	outcomes, err := tasksync.Push(c.Request().Context(), h.DB, int64(userID), req.Mutations)
+	if err != nil {
+		return problem.Write(c, problem.Internal("Failed to apply changes", err))
+	}
+	return c.JSON(http.StatusOK, echo.Map{"results": outcomes})
+}
+
+// queryInt reads an optional integer query parameter, 0 when it is missing.
+func queryInt(c echo.Context, name string) (int64, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
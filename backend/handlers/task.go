@@ -3,6 +3,9 @@ package handlers
 import (
 	"net/http"
 	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/repository"
+	"pianpianino/service"
 	"strconv"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -10,37 +13,65 @@ import (
 	"github.com/uptrace/bun"
 )
 
+// TaskHandler adapts the TaskService to HTTP. The sync routes use DB
+// directly.
 type TaskHandler struct {
-	DB *bun.DB
+	DB    *bun.DB
+	Tasks *service.TaskService
 }
 
-type TaskRequest struct {
-	Description string            `json:"description" validate:"required"`
-	Priority    models.Importance `json:"priority"`
+// NewTaskHandler serves the tasks of DB through a TaskService.
+func NewTaskHandler(DB *bun.DB) *TaskHandler {
+	return &TaskHandler{DB: DB, Tasks: service.NewTaskService(repository.NewBunTasks(DB))}
+}
+
+var (
+	errInvalidToken  = problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token")
+	errInvalidTaskID = problem.New(http.StatusBadRequest, problem.CodeInvalidID, "Invalid task ID")
+)
+
+// TaskUpdateRequest only changes the fields that are present in the body, the
+// rules are those of service.TaskPatch
+type TaskUpdateRequest struct {
+	Description *string            `json:"description" validate:"omitnil,min=1,max=1000"`
+	Priority    *models.Importance `json:"priority" validate:"omitnil,importance"`
 }
 
 // Helper function to get user ID from JWT token
 func getUserIDFromToken(c echo.Context) (int, error) {
-	user := c.Get("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-	userID := claims["user_id"].(float64)
+	user, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return 0, errInvalidToken
+	}
+	claims, ok := user.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, errInvalidToken
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errInvalidToken
+	}
 	return int(userID), nil
 }
 
+// GetAllTasks answers with the tasks of the user and an ETag of the whole
+// list, a client sending it back in If-None-Match gets a 304 until a task
+// changes.
 func (h *TaskHandler) GetAllTasks(c echo.Context) error {
 	userID, err := getUserIDFromToken(c)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token"})
+		return problem.Write(c, errInvalidToken)
 	}
 
-	tasks := make([]models.Task, 0)
-
-	err = h.DB.NewSelect().
-		Model(&tasks).
-		Where("user_id = ?", userID).
-		Scan(c.Request().Context())
+	tasks, err := h.Tasks.List(c.Request().Context(), int64(userID))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch tasks"})
+		return problem.Write(c, err)
+	}
+
+	etag := listETag(tasks)
+	c.Response().Header().Set(headerETag, etag)
+	if notModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
@@ -49,92 +80,113 @@ func (h *TaskHandler) GetAllTasks(c echo.Context) error {
 	})
 }
 
-func (h *TaskHandler) InsertTask(c echo.Context) error {
-	userID, err := getUserIDFromToken(c)
+func (h *TaskHandler) GetTask(c echo.Context) error {
+	userID, taskID, err := taskParams(c)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token"})
+		return problem.Write(c, err)
 	}
 
-	var req TaskRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	task, err := h.Tasks.Get(c.Request().Context(), userID, taskID)
+	if err != nil {
+		return problem.Write(c, err)
 	}
 
-	if req.Description == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Description is required"})
+	etag := taskETag(task)
+	c.Response().Header().Set(headerETag, etag)
+	if notModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
-	task := models.Task{
-		UserID:      int64(userID),
-		Description: req.Description,
-		Priority:    req.Priority,
-		Completed:   false,
+	return c.JSON(http.StatusOK, echo.Map{"task": task})
+}
+
+func (h *TaskHandler) InsertTask(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return problem.Write(c, errInvalidToken)
 	}
 
-	_, err = h.DB.NewInsert().
-		Model(&task).
-		Exec(c.Request().Context())
+	var req service.NewTask
+	if err := c.Bind(&req); err != nil {
+		return problem.Write(c, problem.InvalidBody(err))
+	}
+
+	task, err := h.Tasks.Create(c.Request().Context(), int64(userID), req)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create task"})
+		return problem.Write(c, err)
 	}
 
+	c.Response().Header().Set(headerETag, taskETag(task))
 	return c.JSON(http.StatusCreated, echo.Map{
 		"message": "Task created successfully",
 		"task":    task,
 	})
 }
 
+// DeleteTask honors If-Match, so that a task changed on another device is
+// not deleted unseen.
 func (h *TaskHandler) DeleteTask(c echo.Context) error {
-	taskIDString := c.Param("id")
-	taskID, err := strconv.Atoi(taskIDString)
+	userID, taskID, err := taskParams(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid task ID"})
+		return problem.Write(c, err)
 	}
 
-	task := new(models.Task)
-	_, err = h.DB.NewDelete().
-		Model(task).
-		Where("id = ?", taskID).
-		Exec(c.Request().Context())
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Could not delete task"})
+	if err := h.Tasks.Delete(c.Request().Context(), userID, taskID, ifMatchCondition(c)); err != nil {
+		return problem.Write(c, err)
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{"message": "Task deleted successfully"})
 }
 
 func (h *TaskHandler) ToggleTaskCompleted(c echo.Context) error {
-	userID, err := getUserIDFromToken(c)
+	userID, taskID, err := taskParams(c)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token"})
+		return problem.Write(c, err)
 	}
 
-	taskIDStr := c.Param("id")
-	taskID, err := strconv.Atoi(taskIDStr)
+	task, err := h.Tasks.Toggle(c.Request().Context(), userID, taskID, ifMatchCondition(c))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid task ID"})
+		return problem.Write(c, err)
 	}
 
-	task := new(models.Task)
+	c.Response().Header().Set(headerETag, taskETag(task))
+	return c.JSON(http.StatusOK, echo.Map{"message": "Task completion toggled"})
+}
+
+func (h *TaskHandler) UpdateTask(c echo.Context) error {
+	var req TaskUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return problem.Write(c, problem.InvalidBody(err))
+	}
 
-	err = h.DB.NewSelect().
-		Model(task).
-		Where("id = ? AND user_id = ?", taskID, userID).
-		Scan(c.Request().Context())
+	userID, taskID, err := taskParams(c)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "Task not found"})
+		return problem.Write(c, err)
 	}
 
-	task.Completed = !task.Completed
+	patch := service.TaskPatch{Description: req.Description, Priority: req.Priority}
+	task, err := h.Tasks.Update(c.Request().Context(), userID, taskID, patch, ifMatchCondition(c))
+	if err != nil {
+		return problem.Write(c, err)
+	}
 
-	_, err = h.DB.NewUpdate().
-		Model(task).
-		Column("completed").
-		Where("id = ?", taskID).
-		Exec(c.Request().Context())
+	c.Response().Header().Set(headerETag, taskETag(task))
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Task updated successfully",
+		"task":    task,
+	})
+}
+
+// taskParams reads the :id parameter and the user of the token.
+func taskParams(c echo.Context) (userID, taskID int64, err error) {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to toggle task completion"})
+		return 0, 0, errInvalidTaskID
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{"message": "Task completion toggled"})
+	user, err := getUserIDFromToken(c)
+	if err != nil {
+		return 0, 0, errInvalidToken
+	}
+	return int64(user), int64(id), nil
 }
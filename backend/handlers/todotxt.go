@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"pianpianino/problem"
+	"pianpianino/todotxt"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+)
+
+type TodoTxtHandler struct {
+	DB *bun.DB
+}
+
+// Import accepts the todo.txt file either as a multipart "file" field
+// or as the raw request body. The lines that cannot be imported are listed
+// in the errors of a validation problem.
+func (h *TodoTxtHandler) Import(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return problem.Write(c, errInvalidToken)
+	}
+
+	var body io.Reader = c.Request().Body
+	if file, err := c.FormFile("file"); err == nil {
+		src, err := file.Open()
+		if err != nil {
+			return problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeInvalidBody, "Invalid file"))
+		}
+		defer src.Close()
+		body = src
+	}
+
+	imported, err := todotxt.Import(c.Request().Context(), h.DB, int64(userID), body)
+	var invalid todotxt.InvalidLines
+	if errors.As(err, &invalid) {
+		p := problem.Validation()
+		p.Detail = "The file has lines that cannot be imported"
+		for _, line := range invalid {
+			p.Field("line "+strconv.Itoa(line.Line), problem.FieldInvalid, line.Reason)
+		}
+		return problem.Write(c, p)
+	}
+	if err != nil {
+		return problem.Write(c, problem.Internal("Failed to import tasks", err))
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{
+		"message":  "Tasks imported successfully",
+		"imported": imported,
+	})
+}
+
+func (h *TodoTxtHandler) Export(c echo.Context) error {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		return problem.Write(c, errInvalidToken)
+	}
+
+	var buf bytes.Buffer
+	err = todotxt.Export(c.Request().Context(), h.DB, int64(userID), &buf)
+	if err != nil {
+		return problem.Write(c, problem.Internal("Failed to export tasks", err))
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="todo.txt"`)
+	return c.Blob(http.StatusOK, echo.MIMETextPlainCharsetUTF8, buf.Bytes())
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"errors"
+	"pianpianino/validation"
+
+	"github.com/labstack/echo/v4"
+)
+
+// validate runs the validator registered on echo, falling back to the default
+// one so that handlers created with a bare echo.New() validate all the same.
+func validate(c echo.Context, req interface{}) error {
+	err := c.Validate(req)
+	if errors.Is(err, echo.ErrValidatorNotRegistered) {
+		err = validation.Default.Validate(req)
+	}
+	return err
+}
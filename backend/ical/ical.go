@@ -0,0 +1,167 @@
+package ical
+
+import (
+	"fmt"
+	"io"
+	"pianpianino/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	productID = "-//PianPianino//Tasks//EN"
+	// RFC 5545 recommends folding content lines longer than 75 octets
+	maxLineLength = 75
+	timeLayout    = "20060102T150405Z"
+)
+
+// Priority maps an Importance onto the RFC 5545 PRIORITY scale,
+// where 1 is the highest, 9 the lowest and 0 means undefined.
+func Priority(i models.Importance) int {
+	switch i {
+	case models.High:
+		return 1
+	case models.Medium:
+		return 5
+	case models.Low:
+		return 9
+	default:
+		return 0
+	}
+}
+
+// Importance maps an RFC 5545 PRIORITY back onto an Importance.
+func Importance(priority int) models.Importance {
+	switch {
+	case priority >= 1 && priority <= 4:
+		return models.High
+	case priority == 5:
+		return models.Medium
+	case priority >= 6 && priority <= 9:
+		return models.Low
+	default:
+		return models.NotSet
+	}
+}
+
+// UID returns the stable identifier used for a task in calendar data.
+// Tasks created through CalDAV keep the UID chosen by the client.
+func UID(task models.Task) string {
+	if task.UID != "" {
+		return task.UID
+	}
+	return "task-" + strconv.FormatInt(task.ID, 10) + "@pianpianino"
+}
+
+// TaskID extracts the task ID from a UID generated by UID, it returns false
+// for UIDs chosen by a client.
+func TaskID(uid string) (int64, bool) {
+	id, found := strings.CutPrefix(uid, "task-")
+	if !found {
+		return 0, false
+	}
+	id, found = strings.CutSuffix(id, "@pianpianino")
+	if !found {
+		return 0, false
+	}
+	taskID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return taskID, true
+}
+
+// WriteCalendar renders the tasks as a VCALENDAR containing one VTODO each.
+func WriteCalendar(w io.Writer, name string, tasks []models.Task) error {
+	lw := &lineWriter{w: w}
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:" + productID)
+	lw.line("CALSCALE:GREGORIAN")
+	if name != "" {
+		lw.line("X-WR-CALNAME:" + escapeText(name))
+	}
+	for _, task := range tasks {
+		writeTodo(lw, task)
+	}
+	lw.line("END:VCALENDAR")
+	return lw.err
+}
+
+// WriteTodo renders a single task as a VCALENDAR resource, as served by CalDAV.
+func WriteTodo(w io.Writer, task models.Task) error {
+	lw := &lineWriter{w: w}
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:" + productID)
+	writeTodo(lw, task)
+	lw.line("END:VCALENDAR")
+	return lw.err
+}
+
+func writeTodo(lw *lineWriter, task models.Task) {
+	lw.line("BEGIN:VTODO")
+	lw.line("UID:" + UID(task))
+	lw.line("DTSTAMP:" + formatTime(task.UpdatedAt))
+	lw.line("CREATED:" + formatTime(task.CreatedAt))
+	lw.line("LAST-MODIFIED:" + formatTime(task.UpdatedAt))
+	lw.line("SUMMARY:" + escapeText(task.Description))
+	if p := Priority(task.Priority); p != 0 {
+		lw.line("PRIORITY:" + strconv.Itoa(p))
+	}
+	if task.Completed {
+		lw.line("STATUS:COMPLETED")
+		// tasks completed before CompletedAt existed have no such time
+		completed := task.CompletedAt
+		if completed.IsZero() {
+			completed = task.UpdatedAt
+		}
+		lw.line("COMPLETED:" + formatTime(completed))
+		lw.line("PERCENT-COMPLETE:100")
+	} else {
+		lw.line("STATUS:NEEDS-ACTION")
+	}
+	lw.line("END:VTODO")
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format(timeLayout)
+}
+
+func escapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// lineWriter writes CRLF terminated content lines, folding them when needed.
+type lineWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (lw *lineWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+	var b strings.Builder
+	limit := maxLineLength
+	for len(s) > limit {
+		cut := limit
+		// never split a multi-byte UTF-8 sequence
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// continuation lines start with a space, which counts towards the limit
+		limit = maxLineLength - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	_, lw.err = fmt.Fprint(lw.w, b.String())
+}
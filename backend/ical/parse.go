@@ -0,0 +1,110 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Todo holds the VTODO properties PianPianino keeps track of.
+type Todo struct {
+	UID       string
+	Summary   string
+	Priority  int
+	Completed bool
+}
+
+var ErrNoTodo = errors.New("ical: no VTODO component found")
+
+// ParseTodo reads the first VTODO component of a VCALENDAR object.
+func ParseTodo(r io.Reader) (*Todo, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var todo *Todo
+	depth := 0
+	for _, line := range lines {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		// drop property parameters, e.g. SUMMARY;LANGUAGE=it:...
+		name, _, _ = strings.Cut(name, ";")
+		name = strings.ToUpper(name)
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VTODO") && todo == nil:
+			todo = &Todo{}
+			depth = 1
+			continue
+		case todo == nil || depth == 0:
+			continue
+		case name == "BEGIN":
+			// nested components such as VALARM are skipped
+			depth++
+			continue
+		case name == "END":
+			depth--
+			if depth == 0 {
+				return todo, nil
+			}
+			continue
+		case depth > 1:
+			continue
+		}
+
+		switch name {
+		case "UID":
+			todo.UID = value
+		case "SUMMARY":
+			todo.Summary = unescapeText(value)
+		case "PRIORITY":
+			todo.Priority, _ = strconv.Atoi(strings.TrimSpace(value))
+		case "STATUS":
+			todo.Completed = strings.EqualFold(value, "COMPLETED")
+		case "COMPLETED":
+			todo.Completed = true
+		}
+	}
+
+	if todo == nil {
+		return nil, ErrNoTodo
+	}
+	return nil, errors.New("ical: unterminated VTODO component")
+}
+
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
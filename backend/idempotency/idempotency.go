@@ -0,0 +1,236 @@
+// Package idempotency makes retries of POST, PUT, PATCH and DELETE requests
+// safe, following the IETF draft on the Idempotency-Key header: the first
+// response to a key is stored and replayed to the retries of the request.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+)
+
+// DefaultTTL is how long a response is kept, a retry after that applies the
+// request again.
+const DefaultTTL = 24 * time.Hour
+
+// reservationTTL is how long a request in flight holds its key. It frees the
+// key of a request whose server died before storing the response.
+const reservationTTL = 10 * time.Minute
+
+const maxKeyLength = 255
+
+var (
+	errInvalidKey = problem.New(http.StatusBadRequest, problem.CodeInvalidKey,
+		"The Idempotency-Key header must have 1 to 255 characters")
+	errKeyInUse = problem.New(http.StatusConflict, problem.CodeKeyInUse,
+		"A request with this Idempotency-Key is still being processed")
+	errKeyReused = problem.New(http.StatusUnprocessableEntity, problem.CodeKeyReused,
+		"This Idempotency-Key was already used for a different request")
+)
+
+// Middleware stores the responses of the requests that carry an
+// Idempotency-Key, per user. It runs after authentication. Requests without
+// the header, and other methods, are passed through.
+func Middleware(DB *bun.DB, ttl time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key, present := req.Header[http.CanonicalHeaderKey(HeaderKey)]
+			if !present || !mutates(req.Method) {
+				return next(c)
+			}
+			if len(key[0]) == 0 || len(key[0]) > maxKeyLength {
+				return problem.Write(c, errInvalidKey)
+			}
+			userID, ok := userIDFromToken(c)
+			if !ok {
+				return next(c)
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return problem.Write(c, problem.InvalidBody(err))
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := req.Context()
+			record := &models.IdempotencyKey{
+				UserID:      userID,
+				Key:         key[0],
+				Fingerprint: fingerprint(req, body),
+				ExpiresAt:   time.Now().Add(reservationTTL),
+			}
+			stored, err := reserve(ctx, DB, record)
+			if err != nil {
+				return problem.Write(c, problem.Internal("Failed to check the Idempotency-Key", err))
+			}
+			if stored != nil {
+				return replay(c, record, stored)
+			}
+
+			// a handler that panics does not keep the key reserved
+			finished := false
+			defer func() {
+				if !finished {
+					DB.NewDelete().Model(record).WherePK().Exec(context.WithoutCancel(ctx))
+				}
+			}()
+
+			// the response is written through a copy, errors included
+			before := c.Response().Header().Clone()
+			recorder := &recorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			c.Response().Writer = recorder.ResponseWriter
+			finished = true
+
+			// a failure of the server is not stored, so that a retry can succeed
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				_, err = DB.NewDelete().Model(record).WherePK().Exec(context.WithoutCancel(ctx))
+			} else {
+				record.Status = status
+				record.ContentType = c.Response().Header().Get(echo.HeaderContentType)
+				record.Header = handlerHeader(before, c.Response().Header())
+				record.Body = recorder.body.Bytes()
+				record.ExpiresAt = time.Now().Add(ttl)
+				_, err = DB.NewUpdate().
+					Model(record).
+					Column("status", "content_type", "header", "body", "expires_at").
+					WherePK().
+					Exec(context.WithoutCancel(ctx))
+			}
+			if err != nil {
+				c.Logger().Error(err)
+			}
+			return nil
+		}
+	}
+}
+
+// reserve inserts record as a request in flight and returns nil, or returns
+// the unexpired record already stored for its key.
+func reserve(ctx context.Context, DB *bun.DB, record *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	now := time.Now()
+	_, err := DB.NewDelete().
+		Model((*models.IdempotencyKey)(nil)).
+		Where("expires_at < ?", now).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := DB.NewInsert().Model(record).Ignore().Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if inserted, err := res.RowsAffected(); err != nil || inserted == 1 {
+		return nil, err
+	}
+
+	stored := new(models.IdempotencyKey)
+	err = DB.NewSelect().
+		Model(stored).
+		Where("user_id = ? AND ? = ?", record.UserID, bun.Ident("key"), record.Key).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		// deleted in the meantime by a request that failed, try again
+		return reserve(ctx, DB, record)
+	}
+	return stored, err
+}
+
+func replay(c echo.Context, record, stored *models.IdempotencyKey) error {
+	if stored.Fingerprint != record.Fingerprint {
+		return problem.Write(c, errKeyReused)
+	}
+	if stored.Status == 0 {
+		return problem.Write(c, errKeyInUse)
+	}
+	header := c.Response().Header()
+	for name, values := range stored.Header {
+		header[name] = values
+	}
+	header.Set(HeaderReplayed, "true")
+	return c.Blob(stored.Status, stored.ContentType, stored.Body)
+}
+
+// handlerHeader returns the headers set after before was taken, by the
+// handler: those of the middleware running first are set again on a replay.
+func handlerHeader(before, after http.Header) http.Header {
+	header := make(http.Header)
+	for name, values := range after {
+		if name == echo.HeaderContentType || name == echo.HeaderContentLength {
+			continue
+		}
+		if !slices.Equal(before[name], values) {
+			header[name] = values
+		}
+	}
+	return header
+}
+
+func mutates(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// fingerprint tells apart the requests sent with the same key.
+func fingerprint(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, req.Method+" "+req.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func userIDFromToken(c echo.Context) (int64, bool) {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return 0, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	userID, ok := claims["user_id"].(float64)
+	return int64(userID), ok
+}
+
+type recorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the connection.
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
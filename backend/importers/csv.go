@@ -0,0 +1,177 @@
+package importers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"pianpianino/models"
+	"strings"
+	"time"
+)
+
+// CSVMapping tells which column, by header name, holds each task field.
+// Only Description is required, empty fields are not imported.
+type CSVMapping struct {
+	Description string `json:"description"`
+	Priority    string `json:"priority"`
+	Completed   string `json:"completed"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	CompletedAt string `json:"completed_at"`
+}
+
+// DefaultCSVMapping expects headers named after the JSON fields of a task.
+var DefaultCSVMapping = CSVMapping{
+	Description: "description",
+	Priority:    "priority",
+	Completed:   "completed",
+	CreatedAt:   "created_at",
+	UpdatedAt:   "updated_at",
+	CompletedAt: "completed_at",
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02/01/2006",
+}
+
+// ParseCSV validates every row of a CSV file with a header line. Items in the
+// report are numbered by the line their row starts on, so the header is line
+// 1. A completed row without completed_at is completed at its updated_at, or
+// else at the time of the import.
+func ParseCSV(r io.Reader, mapping CSVMapping) (*Report, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	index := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, found := columns[strings.ToLower(name)]
+		if !found {
+			return -1, fmt.Errorf("column %q not found", name)
+		}
+		return i, nil
+	}
+
+	if mapping.Description == "" {
+		return nil, errors.New("the description column is required")
+	}
+	var cols [6]int
+	for i, name := range []string{mapping.Description, mapping.Priority, mapping.Completed, mapping.CreatedAt, mapping.UpdatedAt, mapping.CompletedAt} {
+		if cols[i], err = index(name); err != nil {
+			// the default mapping only picks up the optional columns that exist
+			if mapping == DefaultCSVMapping && i > 0 {
+				cols[i] = -1
+				continue
+			}
+			return nil, err
+		}
+	}
+
+	report := newReport()
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			report.reject(parseErr.StartLine, err.Error())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(col int) string {
+			if col < 0 || col >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[col])
+		}
+
+		var task models.Task
+		var reasons []string
+
+		task.Description = field(cols[0])
+		if task.Description == "" {
+			reasons = append(reasons, "description is required")
+		}
+		if task.Priority, err = models.ParseImportance(field(cols[1])); err != nil {
+			reasons = append(reasons, err.Error())
+		}
+		completed, err := parseCompleted(field(cols[2]))
+		if err != nil {
+			reasons = append(reasons, err.Error())
+		}
+		if task.CreatedAt, err = parseDate(field(cols[3])); err != nil {
+			reasons = append(reasons, "created_at: "+err.Error())
+		}
+		if task.UpdatedAt, err = parseDate(field(cols[4])); err != nil {
+			reasons = append(reasons, "updated_at: "+err.Error())
+		}
+		completionDate, err := parseDate(field(cols[5]))
+		if err != nil {
+			reasons = append(reasons, "completed_at: "+err.Error())
+		}
+		if !task.CreatedAt.IsZero() && !task.UpdatedAt.IsZero() && task.UpdatedAt.Before(task.CreatedAt) {
+			reasons = append(reasons, "updated_at is before created_at")
+		}
+		if !completionDate.IsZero() && !completed {
+			reasons = append(reasons, "completed_at is set on a task that is not completed")
+		}
+		if completed {
+			task.SetCompleted(true, completedAt(completionDate, task.UpdatedAt))
+		}
+
+		if len(reasons) > 0 {
+			report.reject(line, reasons...)
+			continue
+		}
+		report.accept(line, task, nil)
+	}
+
+	return report, nil
+}
+
+func parseCompleted(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "", "0", "false", "no", "n", "todo", "open":
+		return false, nil
+	case "1", "true", "yes", "y", "x", "done", "completed":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid completed value: %s", s)
+	}
+}
+
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %s", s)
+}
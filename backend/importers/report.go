@@ -0,0 +1,94 @@
+package importers
+
+import (
+	"context"
+	"database/sql"
+	"pianpianino/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/uptrace/bun"
+)
+
+// Report describes, item by item, what an importer could translate.
+// Nothing is written to the database until the report is committed,
+// which lets clients preview an import first.
+type Report struct {
+	Accepted []Accepted `json:"accepted"`
+	Rejected []Rejected `json:"rejected"`
+}
+
+// Accepted is an item that became a task. Warnings list the parts of
+// the item that PianPianino has no place for and were dropped.
+type Accepted struct {
+	Item     int         `json:"item"`
+	Task     models.Task `json:"task"`
+	Warnings []string    `json:"warnings,omitempty"`
+}
+
+// Rejected is an item that could not be imported at all.
+type Rejected struct {
+	Item    int      `json:"item"`
+	Reasons []string `json:"reasons"`
+}
+
+func newReport() *Report {
+	return &Report{
+		Accepted: make([]Accepted, 0),
+		Rejected: make([]Rejected, 0),
+	}
+}
+
+// accept rejects the item instead when its description does not fit in a
+// task, so that a single item cannot fail the whole import.
+func (r *Report) accept(item int, task models.Task, warnings []string) {
+	if utf8.RuneCountInString(task.Description) > models.MaxDescription {
+		r.reject(item, "description is longer than "+strconv.Itoa(models.MaxDescription)+" characters")
+		return
+	}
+	r.Accepted = append(r.Accepted, Accepted{Item: item, Task: task, Warnings: warnings})
+}
+
+func (r *Report) reject(item int, reasons ...string) {
+	r.Rejected = append(r.Rejected, Rejected{Item: item, Reasons: reasons})
+}
+
+// completedAt is the completion time of an item, the first of times that is
+// known or else the time of the import.
+func completedAt(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// tag turns the name of a list, project or label into a project or context
+// of a task, a single word as in todo.txt.
+func tag(name string) string {
+	return strings.Join(strings.Fields(name), "-")
+}
+
+// Commit stores the accepted tasks for the user in a single transaction and
+// updates the report with the IDs they were given.
+func Commit(ctx context.Context, DB *bun.DB, userID int64, report *Report) error {
+	return DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		for i := range report.Accepted {
+			task := &report.Accepted[i].Task
+			task.UserID = userID
+			_, err := tx.NewInsert().
+				Model(task).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			if err := models.RecordChange(ctx, tx, userID, false, task.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,177 @@
+package importers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"pianpianino/models"
+	"strings"
+	"time"
+)
+
+// Microsoft To Do has no export of its own, the JSON of its Graph API is what
+// migration tools produce: either a single {"value": [...]} page of tasks or
+// every list with its tasks. Lists other than the default one become the
+// project of their tasks.
+type microsoftTask struct {
+	Title                string `json:"title"`
+	Status               string `json:"status"`
+	Importance           string `json:"importance"`
+	CreatedDateTime      string `json:"createdDateTime"`
+	LastModifiedDateTime string `json:"lastModifiedDateTime"`
+	Body                 *struct {
+		Content string `json:"content"`
+	} `json:"body"`
+	DueDateTime *struct {
+		DateTime string `json:"dateTime"`
+	} `json:"dueDateTime"`
+	CompletedDateTime *struct {
+		DateTime string `json:"dateTime"`
+	} `json:"completedDateTime"`
+	Recurrence json.RawMessage `json:"recurrence"`
+}
+
+type microsoftExport struct {
+	Value []microsoftTask `json:"value"`
+	Lists []struct {
+		DisplayName string          `json:"displayName"`
+		Tasks       []microsoftTask `json:"tasks"`
+	} `json:"lists"`
+}
+
+func ParseMicrosoftToDo(r io.Reader) (*Report, error) {
+	var export microsoftExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("not a Microsoft To Do export: %w", err)
+	}
+
+	report := newReport()
+	item := 0
+	add := func(list string, t microsoftTask) {
+		item++
+		if strings.TrimSpace(t.Title) == "" {
+			report.reject(item, "task has no title")
+			return
+		}
+
+		task := models.Task{
+			Description: strings.TrimSpace(t.Title),
+			CreatedAt:   parseTimestamp(t.CreatedDateTime),
+			UpdatedAt:   parseTimestamp(t.LastModifiedDateTime),
+		}
+		if strings.EqualFold(t.Status, "completed") {
+			var completed time.Time
+			if t.CompletedDateTime != nil {
+				completed = parseTimestamp(t.CompletedDateTime.DateTime)
+			}
+			task.SetCompleted(true, completedAt(completed, task.UpdatedAt))
+		}
+		if list != "" && list != "Tasks" {
+			task.Projects = []string{tag(list)}
+		}
+
+		var warnings []string
+		switch strings.ToLower(t.Importance) {
+		case "high":
+			task.Priority = models.High
+		case "normal":
+			task.Priority = models.Medium
+		case "low":
+			task.Priority = models.Low
+		case "":
+		default:
+			warnings = append(warnings, "unknown importance "+t.Importance+" dropped")
+		}
+		if t.Body != nil && strings.TrimSpace(t.Body.Content) != "" {
+			warnings = append(warnings, "notes dropped")
+		}
+		if t.DueDateTime != nil && t.DueDateTime.DateTime != "" {
+			warnings = append(warnings, "due date "+t.DueDateTime.DateTime+" dropped")
+		}
+		if len(t.Recurrence) > 0 && string(t.Recurrence) != "null" {
+			warnings = append(warnings, "recurrence dropped")
+		}
+		report.accept(item, task, warnings)
+	}
+
+	for _, t := range export.Value {
+		add("", t)
+	}
+	for _, list := range export.Lists {
+		for _, t := range list.Tasks {
+			add(list.DisplayName, t)
+		}
+	}
+
+	return report, nil
+}
+
+// Google Takeout stores every task list in a single Tasks.json file.
+type googleTakeout struct {
+	Items []struct {
+		Title string `json:"title"`
+		Items []struct {
+			Title     string `json:"title"`
+			Notes     string `json:"notes"`
+			Status    string `json:"status"`
+			Due       string `json:"due"`
+			Created   string `json:"created"`
+			Updated   string `json:"updated"`
+			Completed string `json:"completed"`
+			Deleted   bool   `json:"deleted"`
+			Parent    string `json:"parent"`
+		} `json:"items"`
+	} `json:"items"`
+}
+
+// ParseGoogleTasks reads the Tasks.json file of a Google Takeout. Google Tasks
+// has no priorities, so every task is imported without one. Lists other than
+// the default one become the project of their tasks.
+func ParseGoogleTasks(r io.Reader) (*Report, error) {
+	var takeout googleTakeout
+	if err := json.NewDecoder(r).Decode(&takeout); err != nil {
+		return nil, fmt.Errorf("not a Google Tasks takeout: %w", err)
+	}
+
+	report := newReport()
+	item := 0
+	for _, list := range takeout.Items {
+		for _, t := range list.Items {
+			item++
+			if t.Deleted {
+				report.reject(item, "task was deleted")
+				continue
+			}
+			if strings.TrimSpace(t.Title) == "" {
+				report.reject(item, "task has no title")
+				continue
+			}
+
+			task := models.Task{
+				Description: strings.TrimSpace(t.Title),
+				CreatedAt:   parseTimestamp(firstNonEmpty(t.Created, t.Updated)),
+				UpdatedAt:   parseTimestamp(firstNonEmpty(t.Completed, t.Updated)),
+			}
+			if t.Status == "completed" {
+				task.SetCompleted(true, completedAt(parseTimestamp(t.Completed), task.UpdatedAt))
+			}
+			if list.Title != "" && list.Title != "My Tasks" {
+				task.Projects = []string{tag(list.Title)}
+			}
+
+			var warnings []string
+			if strings.TrimSpace(t.Notes) != "" {
+				warnings = append(warnings, "notes dropped")
+			}
+			if t.Due != "" {
+				warnings = append(warnings, "due date "+t.Due+" dropped")
+			}
+			if t.Parent != "" {
+				warnings = append(warnings, "sub-task imported as a top level task")
+			}
+			report.accept(item, task, warnings)
+		}
+	}
+
+	return report, nil
+}
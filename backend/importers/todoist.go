@@ -0,0 +1,240 @@
+package importers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"pianpianino/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Todoist has four priority levels, p1 being the most urgent. The CSV export
+// writes p1 as 1 while the JSON backup, like the Todoist API, writes it as 4.
+func todoistImportance(p int) models.Importance {
+	switch p {
+	case 1:
+		return models.High
+	case 2:
+		return models.Medium
+	case 3:
+		return models.Low
+	default:
+		return models.NotSet
+	}
+}
+
+// ParseTodoist accepts both the CSV export of a project and the JSON backup,
+// telling them apart by their first character.
+func ParseTodoist(r io.Reader) (*Report, error) {
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, errors.New("the file is empty")
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		_ = reader.UnreadByte()
+		if b == '{' {
+			return ParseTodoistJSON(reader)
+		}
+		return ParseTodoistCSV(reader)
+	}
+}
+
+// ParseTodoistCSV reads the CSV export of a Todoist project. Only the rows of
+// TYPE task become tasks, sections and notes are reported as rejected.
+func ParseTodoistCSV(r io.Reader) (*Report, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, found := columns["CONTENT"]; !found {
+		return nil, errors.New("not a Todoist CSV export: CONTENT column not found")
+	}
+
+	report := newReport()
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			report.reject(parseErr.StartLine, err.Error())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			i, found := columns[name]
+			if !found || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		kind := strings.ToLower(field("TYPE"))
+		if kind != "" && kind != "task" {
+			report.reject(line, "rows of type "+kind+" have no counterpart")
+			continue
+		}
+
+		content := field("CONTENT")
+		if content == "" {
+			report.reject(line, "task has no content")
+			continue
+		}
+
+		task := models.Task{Description: content}
+		var warnings []string
+		if p := field("PRIORITY"); p != "" {
+			priority, err := strconv.Atoi(p)
+			if err != nil || priority < 1 || priority > 4 {
+				warnings = append(warnings, "unknown priority "+p+" dropped")
+			}
+			task.Priority = todoistImportance(priority)
+		}
+		if field("DESCRIPTION") != "" {
+			warnings = append(warnings, "description dropped")
+		}
+		if date := field("DATE"); date != "" {
+			warnings = append(warnings, "due date "+date+" dropped")
+		}
+		if indent := field("INDENT"); indent != "" && indent != "1" {
+			warnings = append(warnings, "sub-task imported as a top level task")
+		}
+		report.accept(line, task, warnings)
+	}
+
+	return report, nil
+}
+
+type todoistBackup struct {
+	Projects []struct {
+		ID   json.RawMessage `json:"id"`
+		Name string          `json:"name"`
+	} `json:"projects"`
+	Items []struct {
+		Content     string          `json:"content"`
+		Description string          `json:"description"`
+		Priority    int             `json:"priority"`
+		Checked     bool            `json:"checked"`
+		ProjectID   json.RawMessage `json:"project_id"`
+		ParentID    json.RawMessage `json:"parent_id"`
+		Labels      []string        `json:"labels"`
+		AddedAt     string          `json:"added_at"`
+		DateAdded   string          `json:"date_added"`
+		CompletedAt string          `json:"completed_at"`
+		Due         *struct {
+			Date   string `json:"date"`
+			String string `json:"string"`
+		} `json:"due"`
+	} `json:"items"`
+}
+
+// ParseTodoistJSON reads a Todoist JSON backup, as returned by the Sync API.
+// Projects other than the Inbox become the project of their tasks and labels
+// their contexts.
+func ParseTodoistJSON(r io.Reader) (*Report, error) {
+	var backup todoistBackup
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return nil, fmt.Errorf("not a Todoist JSON backup: %w", err)
+	}
+
+	projects := make(map[string]string, len(backup.Projects))
+	for _, project := range backup.Projects {
+		projects[rawID(project.ID)] = project.Name
+	}
+
+	report := newReport()
+	for i, item := range backup.Items {
+		if strings.TrimSpace(item.Content) == "" {
+			report.reject(i+1, "task has no content")
+			continue
+		}
+
+		// the JSON backup counts priorities the other way round
+		priority := 0
+		if item.Priority >= 1 && item.Priority <= 4 {
+			priority = 5 - item.Priority
+		}
+		task := models.Task{
+			Description: strings.TrimSpace(item.Content),
+			Priority:    todoistImportance(priority),
+			CreatedAt:   parseTimestamp(firstNonEmpty(item.AddedAt, item.DateAdded)),
+			UpdatedAt:   parseTimestamp(item.CompletedAt),
+		}
+		if item.Checked {
+			task.SetCompleted(true, completedAt(task.UpdatedAt))
+		}
+		if name, found := projects[rawID(item.ProjectID)]; found && name != "Inbox" {
+			task.Projects = []string{tag(name)}
+		}
+		for _, label := range item.Labels {
+			task.Contexts = append(task.Contexts, tag(label))
+		}
+
+		var warnings []string
+		if item.Description != "" {
+			warnings = append(warnings, "description dropped")
+		}
+		if item.Due != nil && item.Due.Date != "" {
+			warnings = append(warnings, "due date "+item.Due.Date+" dropped")
+		}
+		if id := rawID(item.ParentID); id != "" && id != "null" {
+			warnings = append(warnings, "sub-task imported as a top level task")
+		}
+		report.accept(i+1, task, warnings)
+	}
+
+	return report, nil
+}
+
+// rawID normalizes identifiers that older backups store as numbers and
+// newer ones as strings.
+func rawID(raw json.RawMessage) string {
+	return strings.Trim(string(raw), `"`)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseTimestamp returns the zero time for missing or unreadable values,
+// which leaves the database default in place.
+func parseTimestamp(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.0000000", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// TaskChange is the last change of a task, its ID is the change sequence
+// that sync clients use as a cursor. A deleted task keeps its change as a
+// tombstone, so that clients learn about the deletion.
+type TaskChange struct {
+	bun.BaseModel `bun:"table:task_changes"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	UserID    int64     `bun:"user_id,notnull"`
+	TaskID    int64     `bun:"task_id,notnull"`
+	Deleted   bool      `bun:"deleted,notnull,default:false"`
+	ChangedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// RecordChange moves the tasks to the end of the change sequence. Every
+// write to the tasks table must call it, in the same transaction.
+//
+// The sequence of a user follows the commits: PostgreSQL and MySQL hand out
+// IDs in insert order, so a transaction committing late could otherwise add
+// a change below the cursor a client already has. The row of the user is
+// locked first, and the next transaction gets its IDs once this one ended.
+// SQLite has a single writer at a time anyway.
+func RecordChange(ctx context.Context, DB bun.IDB, userID int64, deleted bool, taskIDs ...int64) error {
+	if len(taskIDs) > 0 && DB.Dialect().Name() != dialect.SQLite {
+		_, err := DB.NewSelect().
+			Model((*User)(nil)).
+			Column("id").
+			Where("id = ?", userID).
+			For("UPDATE").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, taskID := range taskIDs {
+		change := &TaskChange{UserID: userID, TaskID: taskID, Deleted: deleted}
+		_, err := DB.NewInsert().
+			Model(change).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		// only the last change of a task is kept
+		_, err = DB.NewDelete().
+			Model((*TaskChange)(nil)).
+			Where("task_id = ? AND id < ?", taskID, change.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncMutation remembers the outcome of a mutation a sync client pushed with
+// a client ID, so that pushing its queue again does not apply the mutation
+// twice. Outcome is the JSON sent back the first time.
+type SyncMutation struct {
+	bun.BaseModel `bun:"table:sync_mutations"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	UserID    int64     `bun:"user_id,notnull,unique:user_client"`
+	ClientID  string    `bun:"client_id,notnull,unique:user_client"`
+	Outcome   []byte    `bun:"outcome,notnull"`
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	ExpiresAt time.Time `bun:"expires_at,notnull"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header, so that a retry gets the same response instead of
+// applying the request twice. Status is 0 while the request is in flight.
+// Header holds the headers set by the handler, like ETag and Location.
+type IdempotencyKey struct {
+	bun.BaseModel `bun:"table:idempotency_keys"`
+
+	ID          int64       `bun:"id,pk,autoincrement"`
+	UserID      int64       `bun:"user_id,notnull,unique:user_key"`
+	Key         string      `bun:"key,notnull,unique:user_key"`
+	Fingerprint string      `bun:"fingerprint,notnull"`
+	Status      int         `bun:"status,notnull,default:0"`
+	ContentType string      `bun:"content_type"`
+	Header      http.Header `bun:"header"`
+	Body        []byte      `bun:"body"`
+	CreatedAt   time.Time   `bun:",nullzero,notnull,default:current_timestamp"`
+	ExpiresAt   time.Time   `bun:"expires_at,notnull"`
+}
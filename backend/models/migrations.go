@@ -2,31 +2,204 @@ package models
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"pianpianino/database"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/sqltype"
 )
 
 func Migrate() {
-	DB := database.GetDB()
-	ctx := context.Background()
+	if err := MigrateDB(context.Background(), database.GetDB()); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("database tables migrated successfully")
+}
 
+// MigrateDB creates the missing tables, indexes and columns on SQLite,
+// PostgreSQL or MySQL.
+func MigrateDB(ctx context.Context, DB *bun.DB) error {
 	_, err := DB.NewCreateTable().
 		Model((*User)(nil)).
 		IfNotExists().
 		WithForeignKeys().
 		Exec(ctx)
 	if err != nil {
-		log.Fatal("errors in creating users table")
+		return fmt.Errorf("errors in creating users table: %w", err)
 	}
 	_, err = DB.NewCreateTable().Model((*Task)(nil)).IfNotExists().WithForeignKeys().Exec(ctx)
 	if err != nil {
-		log.Fatal("errors in creating tasks tables")
+		return fmt.Errorf("errors in creating tasks tables: %w", err)
+	}
+	_, err = DB.NewCreateTable().Model((*IdempotencyKey)(nil)).IfNotExists().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("errors in creating idempotency_keys table: %w", err)
+	}
+	_, err = DB.NewCreateTable().Model((*TaskChange)(nil)).IfNotExists().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("errors in creating task_changes table: %w", err)
+	}
+	_, err = DB.NewCreateTable().Model((*SyncMutation)(nil)).IfNotExists().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("errors in creating sync_mutations table: %w", err)
+	}
+	// the first index serves the pulls of a user, the second one RecordChange
+	for _, index := range []struct {
+		name    string
+		columns []string
+	}{
+		{"task_changes_user_id_idx", []string{"user_id", "id"}},
+		{"task_changes_task_id_idx", []string{"task_id"}},
+	} {
+		err = createIndexIfMissing(ctx, DB, (*TaskChange)(nil), "task_changes", index.name, index.columns...)
+		if err != nil {
+			return fmt.Errorf("failed to create index %s: %w", index.name, err)
+		}
+	}
+	// Columns added after the first release are missing from existing tables
+	for _, column := range []string{"completed_at", "projects", "contexts", "uid", "dav_name", "todotxt_priority", "todotxt_undated", "version"} {
+		if err := addColumnIfMissing(ctx, DB, (*Task)(nil), "tasks", column); err != nil {
+			return fmt.Errorf("failed to add %s column: %w", column, err)
+		}
+	}
+	if err := addColumnIfMissing(ctx, DB, (*IdempotencyKey)(nil), "idempotency_keys", "header"); err != nil {
+		return fmt.Errorf("failed to add header column: %w", err)
+	}
+	// Tasks created before the change sequence existed are synced as well.
+	// Every write records a change, so the sequence is only empty until then.
+	recorded, err := DB.NewSelect().Model((*TaskChange)(nil)).Limit(1).Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read the task changes: %w", err)
+	}
+	if !recorded {
+		_, err = DB.ExecContext(ctx, `INSERT INTO task_changes (user_id, task_id) SELECT user_id, id FROM tasks`)
+		if err != nil {
+			return fmt.Errorf("failed to record the existing tasks: %w", err)
+		}
 	}
-	log.Println("database tables migrated successfully")
 
 	// Enable foreign key constraints (necessary in SQLite)
-	_, err = DB.ExecContext(ctx, `PRAGMA foreign_keys = ON;`)
-	if err != nil {
-		log.Fatalf("failed to enable foreign keys: %v", err)
+	if DB.Dialect().Name() == dialect.SQLite {
+		_, err = DB.ExecContext(ctx, `PRAGMA foreign_keys = ON;`)
+		if err != nil {
+			return fmt.Errorf("failed to enable foreign keys: %w", err)
+		}
+	}
+	return nil
+}
+
+// migrated are the models whose tables MigrateDB creates.
+var migrated = []interface{}{(*User)(nil), (*Task)(nil), (*IdempotencyKey)(nil), (*TaskChange)(nil), (*SyncMutation)(nil)}
+
+// Pending lists the tables and columns MigrateDB has yet to create, as
+// "tasks" or "tasks.version". A database used by an older release of the
+// server, not migrated yet, has some.
+func Pending(ctx context.Context, DB *bun.DB) ([]string, error) {
+	var pending []string
+	for _, model := range migrated {
+		table := DB.Table(reflect.TypeOf(model))
+		columns, err := tableColumns(ctx, DB, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) == 0 {
+			pending = append(pending, table.Name)
+			continue
+		}
+		for _, field := range table.Fields {
+			if !columns[field.Name] {
+				pending = append(pending, table.Name+"."+field.Name)
+			}
+		}
+	}
+	return pending, nil
+}
+
+// addColumnIfMissing adds a column of model, with the type, nullability and
+// default the dialect gives to its field.
+func addColumnIfMissing(ctx context.Context, DB *bun.DB, model interface{}, table, column string) error {
+	columns, err := tableColumns(ctx, DB, table)
+	if err != nil || columns[column] {
+		return err
+	}
+
+	field := DB.Table(reflect.TypeOf(model)).LookupField(column)
+	if field == nil {
+		return fmt.Errorf("%s has no field %s", table, column)
+	}
+	definition := "? " + field.CreateTableSQLType
+	// as in CREATE TABLE, MySQL needs the length of a VARCHAR
+	if strings.EqualFold(field.CreateTableSQLType, sqltype.VarChar) && DB.Dialect().DefaultVarcharLen() > 0 {
+		definition += "(" + strconv.Itoa(DB.Dialect().DefaultVarcharLen()) + ")"
+	}
+	if field.NotNull {
+		definition += " NOT NULL"
+	}
+	if field.SQLDefault != "" {
+		definition += " DEFAULT " + field.SQLDefault
+	}
+
+	_, err = DB.NewAddColumn().
+		Model(model).
+		ColumnExpr(definition, bun.Ident(column)).
+		Exec(ctx)
+	return err
+}
+
+// tableColumns returns the columns of table, none when it does not exist.
+func tableColumns(ctx context.Context, DB *bun.DB, table string) (map[string]bool, error) {
+	var names []string
+	query := DB.NewSelect()
+	switch DB.Dialect().Name() {
+	case dialect.SQLite:
+		query = query.ColumnExpr("name").TableExpr("pragma_table_info(?)", table)
+	default:
+		query = query.ColumnExpr("column_name").
+			TableExpr("information_schema.columns").
+			Where("table_schema = "+currentSchema(DB)).
+			Where("table_name = ?", table)
+	}
+	if err := query.Scan(ctx, &names); err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns, nil
+}
+
+// createIndexIfMissing is needed by MySQL, which has no CREATE INDEX IF NOT
+// EXISTS.
+func createIndexIfMissing(ctx context.Context, DB *bun.DB, model interface{}, table, name string, columns ...string) error {
+	query := DB.NewCreateIndex().
+		Model(model).
+		Index(name).
+		Column(columns...)
+	if DB.Dialect().Name() != dialect.MySQL {
+		_, err := query.IfNotExists().Exec(ctx)
+		return err
+	}
+
+	exists, err := DB.NewSelect().
+		TableExpr("information_schema.statistics").
+		Where("table_schema = DATABASE() AND table_name = ? AND index_name = ?", table, name).
+		Exists(ctx)
+	if err != nil || exists {
+		return err
+	}
+	_, err = query.Exec(ctx)
+	return err
+}
+
+func currentSchema(DB *bun.DB) string {
+	if DB.Dialect().Name() == dialect.MySQL {
+		return "DATABASE()"
 	}
+	return "current_schema()"
 }
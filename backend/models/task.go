@@ -10,6 +10,10 @@ import (
 
 type Importance int
 
+// MaxDescription is the length in characters of the longest description of
+// a task, the size of its column.
+const MaxDescription = 1000
+
 const (
 	NotSet Importance = iota
 	Low
@@ -17,34 +21,71 @@ const (
 	High
 )
 
+// Task is a to-do of a user. Version starts at 1 and is incremented by every
+// change, the ETag of the task is derived from it.
+//
+// Projects and Contexts are the +project and @context tags of todo.txt,
+// TodoTxtPriority the letter of an imported todo.txt priority, since (D) to
+// (Z) map onto Low like (C), and TodoTxtUndated tells that the imported line
+// had no creation date, CreatedAt being the time of the import. DAVName is the resource name, without .ics, of a
+// task created through CalDAV, since clients may pick one other than the UID.
 type Task struct {
 	bun.BaseModel `bun:"table:tasks"`
 
-	ID          int64      `bun:"id,pk,autoincrement" json:"id"`
-	UserID      int64      `bun:"user_id,notnull" json:"user_id"`
-	User        *User      `bun:"rel:belongs-to,join:user_id=id,on_delete:cascade,on_update:cascade" json:"user,omitempty"`
-	Description string     `bun:"description" json:"description"`
-	Priority    Importance `bun:"importance,notnull,default:0" json:"priority"`
-	Completed   bool       `bun:"completed,notnull,default:false" json:"completed"`
-	CreatedAt   time.Time  `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
-	UpdatedAt   time.Time  `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
+	ID              int64      `bun:"id,pk,autoincrement" json:"id"`
+	UserID          int64      `bun:"user_id,notnull" json:"user_id"`
+	User            *User      `bun:"rel:belongs-to,join:user_id=id,on_delete:cascade,on_update:cascade" json:"user,omitempty"`
+	Description     string     `bun:"description,type:varchar(1000)" json:"description"`
+	Priority        Importance `bun:"importance,notnull,default:0" json:"priority"`
+	Completed       bool       `bun:"completed,notnull,default:false" json:"completed"`
+	CompletedAt     time.Time  `bun:"completed_at,nullzero" json:"completed_at,omitzero"`
+	Projects        []string   `bun:"projects,nullzero" json:"projects,omitempty"`
+	Contexts        []string   `bun:"contexts,nullzero" json:"contexts,omitempty"`
+	UID             string     `bun:"uid,nullzero" json:"uid,omitempty"`
+	DAVName         string     `bun:"dav_name,nullzero" json:"-"`
+	TodoTxtPriority string     `bun:"todotxt_priority,nullzero" json:"-"`
+	TodoTxtUndated  bool       `bun:"todotxt_undated,nullzero" json:"-"`
+	Version         int64      `bun:"version,notnull,default:1" json:"version"`
+	CreatedAt       time.Time  `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt       time.Time  `bun:",nullzero,notnull,default:current_timestamp" json:"updated_at"`
 }
 
-func (i *Importance) UnmarshalJSON(b []byte) error {
-	s := strings.Trim(string(b), `"`) // remove quotes
+// SetCompleted completes or reopens the task. CompletedAt is set when the
+// task gets completed and cleared when it is reopened.
+func (t *Task) SetCompleted(completed bool, at time.Time) {
+	switch {
+	case completed && !t.Completed:
+		t.CompletedAt = at
+	case !completed:
+		t.CompletedAt = time.Time{}
+	}
+	t.Completed = completed
+}
 
-	switch strings.ToLower(s) {
+// ParseImportance accepts the same names as the JSON encoding of Importance.
+func ParseImportance(s string) (Importance, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "low":
-		*i = Low
+		return Low, nil
 	case "normal", "medium":
-		*i = Medium
+		return Medium, nil
 	case "high":
-		*i = High
+		return High, nil
 	case "", "notset":
-		*i = NotSet
+		return NotSet, nil
 	default:
-		return fmt.Errorf("invalid priority value: %s", s)
+		return NotSet, fmt.Errorf("invalid priority value: %s", s)
+	}
+}
+
+func (i *Importance) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`) // remove quotes
+
+	importance, err := ParseImportance(s)
+	if err != nil {
+		return err
 	}
+	*i = importance
 
 	return nil
 }
@@ -0,0 +1,315 @@
+// Package openapi builds OpenAPI 3 documents. Schemas are derived from the
+// Go types that the handlers bind and return, so they follow the JSON tags.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	defined map[reflect.Type]*Schema
+	named   map[reflect.Type]string
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower case methods onto operations. Methods OpenAPI has no
+// field for, like the WebDAV PROPFIND, are kept as "x-" extensions.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+}
+
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]SecurityScheme),
+		},
+		defined: make(map[reflect.Type]*Schema),
+		named:   make(map[reflect.Type]string),
+	}
+}
+
+// Add registers an operation under an echo route path, its :params become
+// required path parameters.
+func (d *Document) Add(method, path string, op *Operation) {
+	path, params := PathTemplate(path)
+	for _, name := range params {
+		op.Parameters = append([]Parameter{{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   String(),
+		}}, op.Parameters...)
+	}
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = make(PathItem)
+		d.Paths[path] = item
+	}
+	item[MethodKey(method)] = op
+}
+
+// Has reports whether an echo route is described by the document.
+func (d *Document) Has(method, path string) bool {
+	path, _ = PathTemplate(path)
+	_, ok := d.Paths[path][MethodKey(method)]
+	return ok
+}
+
+// PathTemplate turns /tasks/:id into /tasks/{id} and returns the parameters.
+func PathTemplate(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+			params = append(params, name)
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func MethodKey(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete,
+		http.MethodOptions, http.MethodHead, http.MethodPatch, http.MethodTrace:
+		return strings.ToLower(method)
+	default:
+		return "x-" + strings.ToLower(method)
+	}
+}
+
+// Define sets the schema of a type whose JSON encoding is custom, such as
+// a type implementing json.Marshaler.
+func (d *Document) Define(v interface{}, schema *Schema) {
+	d.defined[reflect.TypeOf(v)] = schema
+}
+
+// Schema returns the schema of the JSON encoding of v. Named structs are
+// added to the components and referenced.
+func (d *Document) Schema(v interface{}) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if schema, ok := d.defined[t]; ok {
+		return schema
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return d.schemaOf(t.Elem())
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Integer()
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return String()
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return Array(d.schemaOf(t.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		return d.ref(t)
+	default:
+		// interface{} and anything else accepts any value
+		return &Schema{}
+	}
+}
+
+func (d *Document) ref(t reflect.Type) *Schema {
+	name, ok := d.named[t]
+	if !ok {
+		name = d.componentName(t)
+		d.named[t] = name
+		// registered before the fields, so that recursive types terminate
+		d.Components.Schemas[name] = &Schema{}
+		*d.Components.Schemas[name] = *d.structSchema(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// componentName is the name of the type, prefixed with its package when
+// another package already registered the same name, e.g. BackupTask.
+func (d *Document) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := d.Components.Schemas[name]; !taken {
+		return name
+	}
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + name
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.addFields(schema, t)
+	return schema
+}
+
+func (d *Document) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, hasTag := field.Tag.Lookup("json")
+		name, options, _ := strings.Cut(tag, ",")
+		switch {
+		case name == "-":
+			continue
+		case field.Anonymous && !hasTag && field.Type.Kind() == reflect.Struct:
+			// embedded fields are promoted like encoding/json does
+			d.addFields(schema, field.Type)
+			continue
+		case !field.IsExported():
+			continue
+		case strings.Contains(field.Tag.Get("bun"), "rel:"):
+			// relations are never loaded by the handlers
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := d.schemaOf(field.Type)
+		rules := strings.Split(field.Tag.Get("validate"), ",")
+		if property.Type == "string" && property.Format == "" && property.Enum == nil {
+			// the min and max rules of the validation package
+			for _, rule := range rules {
+				key, value, _ := strings.Cut(rule, "=")
+				if n, err := strconv.Atoi(value); err == nil && key == "min" {
+					property.MinLength = &n
+				} else if err == nil && key == "max" {
+					property.MaxLength = &n
+				}
+			}
+		}
+		schema.Properties[name] = property
+
+		required := !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer
+		if required || slices.Contains(rules, "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+func Integer() *Schema {
+	return &Schema{Type: "integer"}
+}
+
+func Array(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// Object describes a response built with echo.Map, every property is required.
+func Object(properties map[string]*Schema) *Schema {
+	schema := &Schema{Type: "object", Properties: properties}
+	for name := range properties {
+		schema.Required = append(schema.Required, name)
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// Content is a shorthand for a single media type.
+func Content(mediaType string, schema *Schema) map[string]MediaType {
+	return map[string]MediaType{mediaType: {Schema: schema}}
+}
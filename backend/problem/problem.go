@@ -0,0 +1,201 @@
+// Package problem renders errors as RFC 7807 problem details, with a stable
+// machine-readable code so that clients do not have to match messages.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+// typePrefix makes the code a URI, as RFC 7807 wants for the type member.
+const typePrefix = "urn:pianpianino:problem:"
+
+type Code string
+
+const (
+	CodeInvalidBody        Code = "invalid_body"
+	CodeValidation         Code = "validation_failed"
+	CodeInvalidID          Code = "invalid_id"
+	CodeInvalidToken       Code = "invalid_token"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeUsernameTaken      Code = "username_taken"
+	CodeTaskNotFound       Code = "task_not_found"
+	CodeTaskModified       Code = "task_modified"
+	CodeBatchFailed        Code = "batch_failed"
+	CodeInvalidKey         Code = "invalid_idempotency_key"
+	CodeKeyInUse           Code = "idempotency_key_in_use"
+	CodeKeyReused          Code = "idempotency_key_reused"
+	CodeNotFound           Code = "not_found"
+	CodeMethodNotAllowed   Code = "method_not_allowed"
+	CodeNotReady           Code = "not_ready"
+	CodeInternal           Code = "internal_error"
+)
+
+// Codes of the field errors listed in Problem.Errors.
+const (
+	FieldRequired   = "required"
+	FieldInvalid    = "invalid"
+	FieldTooShort   = "too_short"
+	FieldTooLong    = "too_long"
+	FieldNotAllowed = "not_allowed"
+	FieldOutOfOrder = "out_of_order"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is the error type shared by the handlers. Detail is shown to the
+// client, the cause of an internal error is only logged.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+
+	cause error
+}
+
+func New(status int, code Code, detail string) *Problem {
+	return &Problem{
+		Type:   typePrefix + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Internal hides err behind a generic message, the detail says what failed.
+func Internal(detail string, err error) *Problem {
+	p := New(http.StatusInternalServerError, CodeInternal, detail)
+	p.cause = err
+	return p
+}
+
+// Validation starts a problem with no field errors, add them with Field.
+func Validation() *Problem {
+	return New(http.StatusBadRequest, CodeValidation, "The request has invalid fields")
+}
+
+// InvalidBody explains why echo could not bind the body, naming the field
+// when the JSON decoder knows it.
+func InvalidBody(err error) *Problem {
+	p := New(http.StatusBadRequest, CodeInvalidBody, "The request body could not be decoded")
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		if message, ok := he.Message.(string); ok {
+			p.Detail = message
+		}
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		p.Field(typeErr.Field, FieldInvalid, "cannot be a JSON "+typeErr.Value)
+	}
+	return p
+}
+
+func (p *Problem) Field(field, code, message string) *Problem {
+	p.Errors = append(p.Errors, FieldError{Field: field, Code: code, Message: message})
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// Write sends err as a problem and returns nil, so that a handler can
+// return Write(c, err) and stay testable without the error handler.
+func Write(c echo.Context, err error) error {
+	// a copy, so that problems declared once can be written concurrently
+	p := *From(err)
+	if p.cause != nil {
+		c.Logger().Error(p.cause)
+	}
+	p.Instance = c.Request().URL.Path
+	p.RequestID = requestID(c)
+
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(p.Status)
+	}
+	// c.JSON keeps a content type that is already set
+	c.Response().Header().Set(echo.HeaderContentType, MIMEProblemJSON)
+	return c.JSON(p.Status, &p)
+}
+
+// Handler is an echo.HTTPErrorHandler, so that errors raised by middleware
+// and by the router are problems as well.
+func Handler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	if werr := Write(c, err); werr != nil {
+		c.Logger().Error(werr)
+	}
+}
+
+// From converts any error into a problem, errors other than Problem and
+// echo.HTTPError become internal errors.
+func From(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		detail, _ := he.Message.(string)
+		p := New(he.Code, codeForStatus(he.Code), detail)
+		if he.Code >= http.StatusInternalServerError {
+			p.cause = err
+			p.Detail = ""
+		}
+		return p
+	}
+
+	return Internal("", err)
+}
+
+func codeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidBody
+	case http.StatusUnauthorized:
+		return CodeInvalidToken
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusInternalServerError:
+		return CodeInternal
+	default:
+		// e.g. request_entity_too_large for a 413
+		return Code(strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"))
+	}
+}
+
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
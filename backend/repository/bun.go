@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"pianpianino/database"
+	"pianpianino/models"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/feature"
+)
+
+type BunTasks struct {
+	DB bun.IDB
+}
+
+func NewBunTasks(DB bun.IDB) *BunTasks {
+	return &BunTasks{DB: DB}
+}
+
+func (r *BunTasks) List(ctx context.Context, userID int64) ([]models.Task, error) {
+	return r.ListByUsers(ctx, []int64{userID})
+}
+
+func (r *BunTasks) ListByUsers(ctx context.Context, userIDs []int64) ([]models.Task, error) {
+	tasks := make([]models.Task, 0)
+	err := r.DB.NewSelect().
+		Model(&tasks).
+		Where("user_id IN (?)", bun.In(userIDs)).
+		Order("id ASC").
+		Scan(ctx)
+	return tasks, err
+}
+
+func (r *BunTasks) Get(ctx context.Context, userID, id int64) (*models.Task, error) {
+	task := new(models.Task)
+	err := r.DB.NewSelect().
+		Model(task).
+		Where("id = ? AND user_id = ?", id, userID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return task, err
+}
+
+func (r *BunTasks) Create(ctx context.Context, task *models.Task) error {
+	task.Version = 1
+	// inside Atomic, RunInTx uses a savepoint of the outer transaction
+	return r.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewInsert().
+			Model(task).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if !tx.Dialect().Features().Has(feature.InsertReturning) {
+			// MySQL returns the ID only, the defaults are read back
+			if err := tx.NewSelect().Model(task).WherePK().Scan(ctx); err != nil {
+				return err
+			}
+		}
+		return models.RecordChange(ctx, tx, task.UserID, false, task.ID)
+	})
+}
+
+func (r *BunTasks) Update(ctx context.Context, task *models.Task) error {
+	version := task.Version
+	err := r.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		task.Version = version + 1
+		res, err := tx.NewUpdate().
+			Model(task).
+			Column("description", "importance", "completed", "completed_at", "updated_at", "version").
+			Where("id = ? AND version = ?", task.ID, version).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if updated, err := res.RowsAffected(); err == nil && updated == 0 {
+			return ErrConflict
+		}
+		return models.RecordChange(ctx, tx, task.UserID, false, task.ID)
+	})
+	if err != nil {
+		task.Version = version
+	}
+	return err
+}
+
+func (r *BunTasks) Delete(ctx context.Context, task *models.Task) error {
+	return r.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().
+			Model(task).
+			Where("id = ? AND version = ?", task.ID, task.Version).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if deleted, err := res.RowsAffected(); err == nil && deleted == 0 {
+			return ErrConflict
+		}
+		return models.RecordChange(ctx, tx, task.UserID, true, task.ID)
+	})
+}
+
+func (r *BunTasks) Atomic(ctx context.Context, fn func(ctx context.Context, tasks Tasks) error) error {
+	return r.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		return fn(ctx, &BunTasks{DB: tx})
+	})
+}
+
+type BunUsers struct {
+	DB bun.IDB
+}
+
+func NewBunUsers(DB bun.IDB) *BunUsers {
+	return &BunUsers{DB: DB}
+}
+
+func (r *BunUsers) Get(ctx context.Context, ids []int64) ([]models.User, error) {
+	users := make([]models.User, 0)
+	err := r.DB.NewSelect().
+		Model(&users).
+		Where("id IN (?)", bun.In(ids)).
+		Scan(ctx)
+	return users, err
+}
+
+func (r *BunUsers) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	user := new(models.User)
+	err := r.DB.NewSelect().
+		Model(user).
+		Where("username = ?", username).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+// Create checks the username first, the unique index still catches two
+// registrations racing for the same one.
+func (r *BunUsers) Create(ctx context.Context, user *models.User) error {
+	taken, err := r.DB.NewSelect().
+		Model((*models.User)(nil)).
+		Where("username = ?", user.Username).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicate
+	}
+	_, err = r.DB.NewInsert().
+		Model(user).
+		Exec(ctx)
+	if database.IsUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"pianpianino/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryTasks keeps the tasks in a map, it records no change log.
+type MemoryTasks struct {
+	mu     sync.Mutex
+	tasks  map[int64]models.Task
+	lastID int64
+}
+
+func NewMemoryTasks() *MemoryTasks {
+	return &MemoryTasks{tasks: make(map[int64]models.Task)}
+}
+
+func (r *MemoryTasks) List(ctx context.Context, userID int64) ([]models.Task, error) {
+	return r.ListByUsers(ctx, []int64{userID})
+}
+
+func (r *MemoryTasks) ListByUsers(_ context.Context, userIDs []int64) ([]models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tasks := make([]models.Task, 0)
+	for _, task := range r.tasks {
+		for _, userID := range userIDs {
+			if task.UserID == userID {
+				tasks = append(tasks, task)
+				break
+			}
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+func (r *MemoryTasks) Get(_ context.Context, userID, id int64) (*models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.tasks[id]
+	if !ok || task.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return &task, nil
+}
+
+func (r *MemoryTasks) Create(_ context.Context, task *models.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	task.ID = r.lastID
+	task.Version = 1
+	if task.CreatedAt.IsZero() {
+		task.CreatedAt = time.Now()
+	}
+	if task.UpdatedAt.IsZero() {
+		task.UpdatedAt = task.CreatedAt
+	}
+	r.tasks[task.ID] = *task
+	return nil
+}
+
+func (r *MemoryTasks) Update(_ context.Context, task *models.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[task.ID]
+	if !ok || stored.Version != task.Version {
+		return ErrConflict
+	}
+	stored.Description = task.Description
+	stored.Priority = task.Priority
+	stored.Completed = task.Completed
+	stored.CompletedAt = task.CompletedAt
+	stored.UpdatedAt = task.UpdatedAt
+	stored.Version++
+	r.tasks[task.ID] = stored
+	task.Version = stored.Version
+	return nil
+}
+
+func (r *MemoryTasks) Delete(_ context.Context, task *models.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[task.ID]
+	if !ok || stored.Version != task.Version {
+		return ErrConflict
+	}
+	delete(r.tasks, task.ID)
+	return nil
+}
+
+// Atomic runs fn on a copy of the tasks that replaces them when fn succeeds.
+// Unlike a transaction, it discards the writes made meanwhile outside fn.
+func (r *MemoryTasks) Atomic(ctx context.Context, fn func(ctx context.Context, tasks Tasks) error) error {
+	r.mu.Lock()
+	copied := &MemoryTasks{tasks: make(map[int64]models.Task, len(r.tasks)), lastID: r.lastID}
+	for id, task := range r.tasks {
+		copied.tasks[id] = task
+	}
+	r.mu.Unlock()
+
+	if err := fn(ctx, copied); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tasks, r.lastID = copied.tasks, copied.lastID
+	return nil
+}
+
+type MemoryUsers struct {
+	mu     sync.Mutex
+	users  map[int64]models.User
+	lastID int64
+}
+
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{users: make(map[int64]models.User)}
+}
+
+func (r *MemoryUsers) Get(_ context.Context, ids []int64) ([]models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := make([]models.User, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := r.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (r *MemoryUsers) FindByUsername(_ context.Context, username string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUsers) Create(_ context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	r.lastID++
+	user.ID = r.lastID
+	r.users[user.ID] = *user
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package repository stores the tasks and the users, behind interfaces that
+// the services depend on: Bun* implementations are backed by the database
+// and Memory* ones by maps, for tests and tools that need no database.
+package repository
+
+import (
+	"context"
+	"errors"
+	"pianpianino/models"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means that the task changed since it was read
+	ErrConflict = errors.New("version conflict")
+	// ErrDuplicate means that the username is already taken
+	ErrDuplicate = errors.New("duplicate")
+)
+
+// Tasks stores the tasks of every user. Every write also records the change
+// for the sync clients, see models.RecordChange.
+type Tasks interface {
+	// List returns the tasks of a user ordered by ID.
+	List(ctx context.Context, userID int64) ([]models.Task, error)
+	// ListByUsers returns the tasks of several users at once, ordered by ID.
+	ListByUsers(ctx context.Context, userIDs []int64) ([]models.Task, error)
+	// Get returns a task of the user, or ErrNotFound.
+	Get(ctx context.Context, userID, id int64) (*models.Task, error)
+	// Create stores a new task with version 1 and sets its ID.
+	Create(ctx context.Context, task *models.Task) error
+	// Update writes the description, priority, completion and update time
+	// of task and increments its version, or fails with ErrConflict if the
+	// stored task no longer has the version of task.
+	Update(ctx context.Context, task *models.Task) error
+	// Delete removes task, or fails with ErrConflict if the stored task no
+	// longer has the version of task.
+	Delete(ctx context.Context, task *models.Task) error
+	// Atomic runs fn with a repository whose writes are kept together, or
+	// discarded together when fn fails.
+	Atomic(ctx context.Context, fn func(ctx context.Context, tasks Tasks) error) error
+}
+
+type Users interface {
+	// Get returns the users with the given IDs, missing ones are left out.
+	Get(ctx context.Context, ids []int64) ([]models.User, error)
+	// FindByUsername returns the user, or ErrNotFound.
+	FindByUsername(ctx context.Context, username string) (*models.User, error)
+	// Create stores a new user and sets its ID, or fails with ErrDuplicate.
+	Create(ctx context.Context, user *models.User) error
+}
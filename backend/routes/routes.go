@@ -1,34 +1,126 @@
 package routes
 
 import (
+	_ "embed"
+	"net/http"
+	"pianpianino/config"
+	"pianpianino/gql"
 	"pianpianino/handlers"
-	"pianpianino/helpers"
+	"pianpianino/idempotency"
+	"pianpianino/problem"
+	"pianpianino/repository"
+	"pianpianino/service"
+	"pianpianino/validation"
+	"strings"
 
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func SetupRoutes(e *echo.Echo, auth *handlers.AuthHandler, task *handlers.TaskHandler) {
+//go:embed docs.html
+var docsPage []byte
+
+// Handlers are the handlers SetupRoutes serves, built once by the caller.
+// The health and GraphQL handlers are built from the database of Task.
+type Handlers struct {
+	Auth     *handlers.AuthHandler
+	Task     *handlers.TaskHandler
+	Calendar *handlers.CalendarHandler
+	CalDAV   *handlers.CalDAVHandler
+	TodoTxt  *handlers.TodoTxtHandler
+	Backup   *handlers.BackupHandler
+	Import   *handlers.ImportHandler
+}
+
+func SetupRoutes(e *echo.Echo, cfg *config.Config, h Handlers) {
+	// Errors raised outside the handlers are sent as problem details too,
+	// with the request ID that is also logged
+	e.HTTPErrorHandler = problem.Handler
+	e.Validator = validation.New()
+	e.Use(middleware.RequestID())
+
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"http://localhost:5173", "http://localhost:1323/"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		// CalDAV clients are not browsers and need OPTIONS to reach the handler
+		Skipper: func(c echo.Context) bool {
+			return strings.HasPrefix(c.Request().URL.Path, "/caldav")
+		},
+		AllowOrigins: cfg.CORSOrigins,
+		AllowHeaders: []string{
+			echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization,
+			idempotency.HeaderKey, "If-Match", "If-None-Match",
+		},
+		// lets the frontend notice that it is calling a deprecated version,
+		// report the ID of a failed request, spot replayed responses and
+		// send conditional requests
+		ExposeHeaders: []string{"Deprecation", "Sunset", "Link", echo.HeaderXRequestID, idempotency.HeaderReplayed, "ETag"},
 	}))
 
+	// API documentation
+	spec := Spec()
+	e.GET("/openapi.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, spec)
+	})
+	e.GET("/docs", func(c echo.Context) error {
+		return c.HTMLBlob(http.StatusOK, docsPage)
+	})
+
+	// Probes of the load balancer, public and quiet
+	health := &handlers.HealthHandler{DB: h.Task.DB}
+	e.GET("/healthz", health.Healthz)
+	e.GET("/readyz", health.Readyz)
+	e.GET("/version", health.Version)
+
 	// Public routes using struct methods
-	e.POST("/register", auth.Register)
-	e.POST("/login", auth.Login)
-
-	// Protected routes
-	protected := e.Group("/api")
-	jwtSecret := helpers.LoadConfig("JWT_SECRET")
-	protected.Use(echojwt.WithConfig(echojwt.Config{
-		SigningKey:  []byte(jwtSecret),
-		TokenLookup: "header:Authorization:Bearer ",
+	e.POST("/register", h.Auth.Register)
+	e.POST("/login", h.Auth.Login)
+
+	// The calendar feed is protected by the signed token in its URL
+	e.GET("/calendar/:token", h.Calendar.Feed)
+
+	// CalDAV routes, authenticated with the same credentials used for /login
+	e.Match([]string{http.MethodGet, echo.PROPFIND}, "/.well-known/caldav", func(c echo.Context) error {
+		return c.Redirect(http.StatusMovedPermanently, handlers.CalDAVRoot)
+	})
+	dav := e.Group("/caldav", middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Validator: h.CalDAV.Authenticate,
+		Realm:     "PianPianino",
 	}))
+	for _, path := range []string{"", "/"} {
+		dav.OPTIONS(path, h.CalDAV.Options)
+		dav.Add(echo.PROPFIND, path, h.CalDAV.PropfindRoot)
+	}
+	for _, path := range []string{"/tasks", "/tasks/"} {
+		dav.OPTIONS(path, h.CalDAV.Options)
+		dav.Add(echo.PROPFIND, path, h.CalDAV.PropfindCollection)
+		dav.Add(echo.REPORT, path, h.CalDAV.Report)
+	}
+	dav.OPTIONS("/tasks/:name", h.CalDAV.Options)
+	dav.Add(echo.PROPFIND, "/tasks/:name", h.CalDAV.PropfindResource)
+	dav.GET("/tasks/:name", h.CalDAV.GetResource)
+	dav.PUT("/tasks/:name", h.CalDAV.PutResource)
+	dav.DELETE("/tasks/:name", h.CalDAV.DeleteResource)
 
-	protected.GET("/tasks", task.GetAllTasks)
-	protected.POST("/tasks", task.InsertTask)
-	protected.DELETE("/tasks/:id", task.DeleteTask)
-	protected.PATCH("/tasks/:id/toggle", task.ToggleTaskCompleted)
+	// Protected routes, one group per API version, see versions.go
+	jwtAuth := echojwt.WithConfig(echojwt.Config{
+		SigningKey:  []byte(cfg.JWTSecret),
+		TokenLookup: "header:Authorization:Bearer ",
+		ErrorHandler: func(c echo.Context, err error) error {
+			return problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "Missing or invalid token")
+		},
+	})
+	// retried writes are answered from the stored response, the handlers
+	// share a single database
+	retries := idempotency.Middleware(h.Task.DB, idempotency.DefaultTTL)
+	registerVersions(e, apiHandlers{
+		task:     h.Task,
+		calendar: h.Calendar,
+		todoTxt:  h.TodoTxt,
+		backup:   h.Backup,
+		imports:  h.Import,
+		graphql: &handlers.GraphQLHandler{Schema: gql.NewSchema(
+			service.NewTaskService(repository.NewBunTasks(h.Task.DB)),
+			service.NewUserService(repository.NewBunUsers(h.Task.DB), cfg.JWTSecret),
+		)},
+	}, jwtAuth, retries)
 }
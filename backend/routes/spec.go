@@ -0,0 +1,556 @@
+package routes
+
+import (
+	"net/http"
+	"pianpianino/backup"
+	"pianpianino/gql"
+	"pianpianino/handlers"
+	"pianpianino/idempotency"
+	"pianpianino/importers"
+	"pianpianino/models"
+	"pianpianino/openapi"
+	"pianpianino/problem"
+	"pianpianino/service"
+	"pianpianino/tasksync"
+	"pianpianino/version"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Spec describes every route registered by SetupRoutes, a test keeps the two
+// in sync. Schemas come from the types the handlers bind and return.
+func Spec() *openapi.Document {
+	doc := openapi.New("PianPianino API", "1.0.0")
+	doc.Info.Description = "Manage tasks with their priority and completion. " +
+		"Routes under /api/<version> need the token returned by /login as a Bearer token. " +
+		"The unversioned /api prefix is a deprecated alias of /api/v1."
+	doc.Components.SecuritySchemes["bearer"] = openapi.SecurityScheme{
+		Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+	}
+	doc.Components.SecuritySchemes["basic"] = openapi.SecurityScheme{
+		Type: "http", Scheme: "basic",
+	}
+	doc.Define(models.Importance(0), &openapi.Schema{
+		Type:        "string",
+		Enum:        []string{"notset", "low", "normal", "high"},
+		Description: `"medium" is accepted as a synonym of "normal"`,
+	})
+
+	doc.Components.Schemas["Error"] = doc.Schema(struct {
+		Error string `json:"error"`
+	}{})
+	doc.Schema(problem.Problem{})
+
+	// Probes
+	doc.Add(http.MethodGet, "/healthz", &openapi.Operation{
+		Summary:   "Tell that the server is alive",
+		Tags:      []string{"health"},
+		Responses: map[string]openapi.Response{"200": ok("Alive", statusSchema())},
+	})
+	doc.Add(http.MethodGet, "/readyz", &openapi.Operation{
+		Summary:     "Tell whether the server can take requests",
+		Description: "The server is ready when the database answers and is migrated to the schema of this release.",
+		Tags:        []string{"health"},
+		Responses: map[string]openapi.Response{
+			"200": ok("Ready", statusSchema()),
+			"503": problemResponse("The database is unreachable or not migrated"),
+		},
+	})
+	doc.Add(http.MethodGet, "/version", &openapi.Operation{
+		Summary:   "Describe the build of the server",
+		Tags:      []string{"health"},
+		Responses: map[string]openapi.Response{"200": ok("The commit, build time and Go version", doc.Schema(version.Info{}))},
+	})
+
+	// Authentication
+	doc.Add(http.MethodPost, "/register", &openapi.Operation{
+		Summary:     "Register a new user",
+		Tags:        []string{"auth"},
+		RequestBody: jsonBody(doc.Schema(service.Registration{})),
+		Responses: map[string]openapi.Response{
+			"201": ok("User registered", messageSchema()),
+			"400": problemResponse("Invalid body or missing fields"),
+			"409": problemResponse("Username already taken"),
+		},
+	})
+	doc.Add(http.MethodPost, "/login", &openapi.Operation{
+		Summary:     "Log in and obtain a JWT valid for two hours",
+		Tags:        []string{"auth"},
+		RequestBody: jsonBody(doc.Schema(service.Credentials{})),
+		Responses: map[string]openapi.Response{
+			"200": ok("Logged in", openapi.Object(map[string]*openapi.Schema{
+				"message": openapi.String(),
+				"token":   openapi.String(),
+			})),
+			"400": problemResponse("Missing fields"),
+			"401": problemResponse("Invalid credentials"),
+		},
+	})
+
+	// Calendar feed
+	doc.Add(http.MethodGet, "/calendar/:token", &openapi.Operation{
+		Summary:     "iCalendar feed of the tasks as VTODOs",
+		Description: "The token in the URL, obtained from /api/v1/calendar, authenticates the request.",
+		Tags:        []string{"calendar"},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "The calendar", Content: openapi.Content("text/calendar", openapi.String())},
+			"404": failure("Unknown or invalid token"),
+		},
+	})
+
+	// Protected routes of every version and of the deprecated /api alias
+	for _, v := range apiVersions {
+		v.spec(doc, func(method, path string, op *openapi.Operation) {
+			op.Deprecated = !v.deprecation.IsZero()
+			idempotent(method, op)
+			doc.Add(method, versionPrefix(v)+path, op)
+		})
+	}
+	findVersion(apiAlias.name).spec(doc, func(method, path string, op *openapi.Operation) {
+		op.Deprecated = true
+		idempotent(method, op)
+		doc.Add(method, "/api"+path, op)
+	})
+
+	// CalDAV, see RFC 4791 for the XML bodies
+	calendarData := openapi.Content("text/calendar", openapi.String())
+	xml := openapi.Content(echo.MIMEApplicationXMLCharsetUTF8, openapi.String())
+	unauthorized := openapi.Response{Description: "Missing or invalid Basic credentials"}
+	doc.Add(http.MethodGet, "/.well-known/caldav", &openapi.Operation{
+		Summary:   "Redirect to the CalDAV root",
+		Tags:      []string{"caldav"},
+		Responses: map[string]openapi.Response{"301": {Description: "Redirect to " + handlers.CalDAVRoot}},
+	})
+	doc.Add(echo.PROPFIND, "/.well-known/caldav", doc.Paths["/.well-known/caldav"]["get"])
+	for _, path := range []string{"/caldav", "/caldav/tasks"} {
+		doc.Add(http.MethodOptions, path, &openapi.Operation{
+			Summary:   "Advertise the supported DAV features",
+			Tags:      []string{"caldav"},
+			Security:  basic,
+			Responses: map[string]openapi.Response{"200": {Description: "DAV and Allow headers"}},
+		})
+	}
+	doc.Add(echo.PROPFIND, "/caldav", &openapi.Operation{
+		Summary:   "Discover the principal and the calendar home",
+		Tags:      []string{"caldav"},
+		Security:  basic,
+		Responses: map[string]openapi.Response{"207": {Description: "Multi-status", Content: xml}, "401": unauthorized},
+	})
+	doc.Add(echo.PROPFIND, "/caldav/tasks", &openapi.Operation{
+		Summary:   "Properties of the task calendar and, with Depth 1, of its tasks",
+		Tags:      []string{"caldav"},
+		Security:  basic,
+		Responses: map[string]openapi.Response{"207": {Description: "Multi-status", Content: xml}, "401": unauthorized},
+	})
+	doc.Add(echo.REPORT, "/caldav/tasks", &openapi.Operation{
+		Summary:   "calendar-query and calendar-multiget reports",
+		Tags:      []string{"caldav"},
+		Security:  basic,
+		Responses: map[string]openapi.Response{"207": {Description: "Multi-status", Content: xml}, "401": unauthorized},
+	})
+	doc.Add(http.MethodOptions, "/caldav/tasks/:name", &openapi.Operation{
+		Summary:   "Advertise the supported DAV features",
+		Tags:      []string{"caldav"},
+		Security:  basic,
+		Responses: map[string]openapi.Response{"200": {Description: "DAV and Allow headers"}},
+	})
+	doc.Add(echo.PROPFIND, "/caldav/tasks/:name", &openapi.Operation{
+		Summary:   "Properties of a task",
+		Tags:      []string{"caldav"},
+		Security:  basic,
+		Responses: map[string]openapi.Response{"207": {Description: "Multi-status", Content: xml}, "404": {Description: "Task not found"}},
+	})
+	doc.Add(http.MethodGet, "/caldav/tasks/:name", &openapi.Operation{
+		Summary:   "A task as a VTODO",
+		Tags:      []string{"caldav"},
+		Security:  basic,
+		Responses: map[string]openapi.Response{"200": {Description: "The task", Content: calendarData}, "404": {Description: "Task not found"}},
+	})
+	doc.Add(http.MethodPut, "/caldav/tasks/:name", &openapi.Operation{
+		Summary:     "Create or replace a task, honoring If-Match and If-None-Match",
+		Tags:        []string{"caldav"},
+		Security:    basic,
+		RequestBody: &openapi.RequestBody{Required: true, Content: calendarData},
+		Responses: map[string]openapi.Response{
+			"201": {Description: "Task created"},
+			"204": {Description: "Task replaced"},
+			"400": {Description: "No VTODO in the body"},
+			"409": {Description: "Another resource has the UID of the task"},
+			"412": {Description: "The ETag does not match"},
+		},
+	})
+	doc.Add(http.MethodDelete, "/caldav/tasks/:name", &openapi.Operation{
+		Summary:   "Delete a task",
+		Tags:      []string{"caldav"},
+		Security:  basic,
+		Responses: map[string]openapi.Response{"204": {Description: "Task deleted"}, "404": {Description: "Task not found"}},
+	})
+
+	// Documentation
+	doc.Add(http.MethodGet, "/openapi.json", &openapi.Operation{
+		Summary:   "This document",
+		Tags:      []string{"docs"},
+		Responses: map[string]openapi.Response{"200": {Description: "The OpenAPI document"}},
+	})
+	doc.Add(http.MethodGet, "/docs", &openapi.Operation{
+		Summary:   "Browsable documentation of this API",
+		Tags:      []string{"docs"},
+		Responses: map[string]openapi.Response{"200": {Description: "An HTML page"}},
+	})
+
+	return doc
+}
+
+// describeV1 describes the protected routes registered by registerV1.
+func describeV1(doc *openapi.Document, add specFunc) {
+	// Tasks
+	task := doc.Schema(models.Task{})
+	add(http.MethodGet, "/tasks", conditionalRead(&openapi.Operation{
+		Summary:     "List the tasks of the user",
+		Description: "The ETag of the response changes whenever a task is added, changed or deleted.",
+		Tags:        []string{"tasks"},
+		Security:    bearer,
+		Responses: map[string]openapi.Response{
+			"200": ok("The tasks", openapi.Object(map[string]*openapi.Schema{
+				"tasks": openapi.Array(task),
+				"count": openapi.Integer(),
+			})),
+			"401": problemResponse("Missing or invalid token"),
+		},
+	}))
+	add(http.MethodGet, "/tasks/:id", conditionalRead(&openapi.Operation{
+		Summary:     "Get a task",
+		Description: "The ETag of the response is the version of the task.",
+		Tags:        []string{"tasks"},
+		Security:    bearer,
+		Responses: map[string]openapi.Response{
+			"200": ok("The task", openapi.Object(map[string]*openapi.Schema{
+				"task": task,
+			})),
+			"400": problemResponse("Invalid ID"),
+			"401": problemResponse("Missing or invalid token"),
+			"404": problemResponse("Task not found"),
+		},
+	}))
+	add(http.MethodPost, "/tasks", &openapi.Operation{
+		Summary:     "Create a task",
+		Tags:        []string{"tasks"},
+		Security:    bearer,
+		RequestBody: jsonBody(doc.Schema(service.NewTask{})),
+		Responses: map[string]openapi.Response{
+			"201": ok("Task created", openapi.Object(map[string]*openapi.Schema{
+				"message": openapi.String(),
+				"task":    task,
+			})),
+			"400": problemResponse("Invalid body or empty description"),
+			"401": problemResponse("Missing or invalid token"),
+		},
+	})
+	add(http.MethodPost, "/tasks/batch", &openapi.Operation{
+		Summary: "Apply several task operations at once",
+		Description: "The operations (create, update, toggle, complete, delete and move, also named prioritize, which only changes the priority) run in order. " +
+			"In atomic mode, the default, the first failure rolls every operation back and is reported as a batch_failed problem. " +
+			"In best_effort mode each operation is committed on its own and its outcome is listed in the results.",
+		Tags:        []string{"tasks"},
+		Security:    bearer,
+		RequestBody: jsonBody(doc.Schema(handlers.BatchRequest{})),
+		Responses: map[string]openapi.Response{
+			"200": ok("The result of every operation", doc.Schema(handlers.BatchResponse{})),
+			"400": problemResponse("Invalid body, or an atomic batch failed on an invalid operation"),
+			"401": problemResponse("Missing or invalid token"),
+			"404": problemResponse("An atomic batch failed on a missing task"),
+		},
+	})
+	add(http.MethodPatch, "/tasks/:id", conditionalWrite(&openapi.Operation{
+		Summary:     "Change the description or priority of a task",
+		Description: "Fields missing from the body are left untouched.",
+		Tags:        []string{"tasks"},
+		Security:    bearer,
+		RequestBody: jsonBody(doc.Schema(handlers.TaskUpdateRequest{})),
+		Responses: map[string]openapi.Response{
+			"200": ok("Task updated", openapi.Object(map[string]*openapi.Schema{
+				"message": openapi.String(),
+				"task":    task,
+			})),
+			"400": problemResponse("Invalid ID or body"),
+			"401": problemResponse("Missing or invalid token"),
+			"404": problemResponse("Task not found"),
+		},
+	}))
+	add(http.MethodDelete, "/tasks/:id", conditionalWrite(&openapi.Operation{
+		Summary:  "Delete a task",
+		Tags:     []string{"tasks"},
+		Security: bearer,
+		Responses: map[string]openapi.Response{
+			"200": ok("Task deleted", messageSchema()),
+			"400": problemResponse("Invalid ID"),
+			"401": problemResponse("Missing or invalid token"),
+			"404": problemResponse("Task not found"),
+		},
+	}))
+	add(http.MethodPatch, "/tasks/:id/toggle", conditionalWrite(&openapi.Operation{
+		Summary:  "Toggle the completion of a task",
+		Tags:     []string{"tasks"},
+		Security: bearer,
+		Responses: map[string]openapi.Response{
+			"200": ok("Completion toggled", messageSchema()),
+			"400": problemResponse("Invalid ID"),
+			"401": problemResponse("Missing or invalid token"),
+			"404": problemResponse("Task not found"),
+		},
+	}))
+
+	// Sync
+	add(http.MethodGet, "/sync", &openapi.Operation{
+		Summary: "Pull the tasks changed or deleted since a cursor",
+		Description: "Start with no cursor for a full sync and keep the returned cursor for the next pull. " +
+			"Pull again right away while more is true.",
+		Tags:     []string{"sync"},
+		Security: bearer,
+		Parameters: []openapi.Parameter{
+			{Name: "since", In: "query", Description: "Cursor returned by the previous pull", Schema: openapi.Integer()},
+			{Name: "limit", In: "query", Description: "Maximum number of changes, 500 by default", Schema: openapi.Integer()},
+		},
+		Responses: map[string]openapi.Response{
+			"200": ok("The changes", doc.Schema(tasksync.Delta{})),
+			"400": problemResponse("Invalid cursor or limit"),
+			"401": problemResponse("Missing or invalid token"),
+		},
+	})
+	add(http.MethodPost, "/sync", &openapi.Operation{
+		Summary: "Push the changes queued by an offline client",
+		Description: "Each mutation is applied on its own. A mutation whose base_version is not the current " +
+			"version of the task is a conflict: it is not applied and the current task is returned instead.",
+		Tags:        []string{"sync"},
+		Security:    bearer,
+		RequestBody: jsonBody(doc.Schema(handlers.SyncPushRequest{})),
+		Responses: map[string]openapi.Response{
+			"200": ok("The outcome of every mutation", openapi.Object(map[string]*openapi.Schema{
+				"results": openapi.Array(doc.Schema(tasksync.Outcome{})),
+			})),
+			"400": problemResponse("Invalid body"),
+			"401": problemResponse("Missing or invalid token"),
+		},
+	})
+
+	// GraphQL
+	add(http.MethodPost, "/graphql", &openapi.Operation{
+		Summary: "Run a GraphQL query or mutation on the tasks of the user",
+		Description: "The schema is in backend/gql/schema.graphql. Errors of the query are answered with a 200 " +
+			"and listed in errors, extensions.code holds the same codes as the problems of the REST routes.",
+		Tags:        []string{"graphql"},
+		Security:    bearer,
+		RequestBody: jsonBody(doc.Schema(gql.Params{})),
+		Responses: map[string]openapi.Response{
+			"200": ok("The data and the errors of the query", openapi.Object(map[string]*openapi.Schema{
+				"data":   {Type: "object"},
+				"errors": openapi.Array(&openapi.Schema{Type: "object"}),
+			})),
+			"400": problemResponse("Invalid body or missing query"),
+			"401": problemResponse("Missing or invalid token"),
+		},
+	})
+
+	// Calendar
+	add(http.MethodGet, "/calendar", &openapi.Operation{
+		Summary:  "Get the URL of the iCalendar feed of the user",
+		Tags:     []string{"calendar"},
+		Security: bearer,
+		Responses: map[string]openapi.Response{
+			"200": ok("The feed URL", openapi.Object(map[string]*openapi.Schema{"url": openapi.String()})),
+			"401": problemResponse("Missing or invalid token"),
+		},
+	})
+	// Backup and imports
+	add(http.MethodGet, "/export", &openapi.Operation{
+		Summary:  "Export all the data of the user",
+		Tags:     []string{"backup"},
+		Security: bearer,
+		Responses: map[string]openapi.Response{
+			"200": ok("The backup document", doc.Schema(backup.Document{})),
+			"401": problemResponse("Missing or invalid token"),
+		},
+	})
+	add(http.MethodPost, "/import", &openapi.Operation{
+		Summary:  "Restore a backup document",
+		Tags:     []string{"backup"},
+		Security: bearer,
+		Parameters: []openapi.Parameter{{
+			Name:        "mode",
+			In:          "query",
+			Description: "merge skips tasks whose uid already exists, replace deletes every task first",
+			Schema:      &openapi.Schema{Type: "string", Enum: []string{backup.ModeMerge, backup.ModeReplace}},
+		}},
+		RequestBody: jsonBody(doc.Schema(backup.Document{})),
+		Responses: map[string]openapi.Response{
+			"200": ok("Backup restored", openapi.Object(map[string]*openapi.Schema{
+				"message": openapi.String(),
+				"result":  doc.Schema(backup.Result{}),
+			})),
+			"400": problemResponse("Invalid mode, body, version or tasks"),
+			"401": problemResponse("Missing or invalid token"),
+		},
+	})
+	add(http.MethodGet, "/export/todotxt", &openapi.Operation{
+		Summary:  "Export the tasks as a todo.txt file",
+		Tags:     []string{"todo.txt"},
+		Security: bearer,
+		Responses: map[string]openapi.Response{
+			"200": {Description: "The todo.txt file", Content: openapi.Content(echo.MIMETextPlain, openapi.String())},
+			"401": problemResponse("Missing or invalid token"),
+		},
+	})
+	add(http.MethodPost, "/import/todotxt", &openapi.Operation{
+		Summary:  "Import a todo.txt file, sent raw or as the multipart field file",
+		Tags:     []string{"todo.txt"},
+		Security: bearer,
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			echo.MIMETextPlain:     {Schema: openapi.String()},
+			echo.MIMEMultipartForm: {Schema: uploadSchema(nil)},
+		}},
+		Responses: map[string]openapi.Response{
+			"201": ok("Tasks imported", openapi.Object(map[string]*openapi.Schema{
+				"message":  openapi.String(),
+				"imported": openapi.Integer(),
+			})),
+			"400": problemResponse("Invalid file, or lines that cannot be imported, listed as errors"),
+			"401": problemResponse("Missing or invalid token"),
+		},
+	})
+
+	dryRun := map[string]*openapi.Schema{
+		"dry_run": {Type: "boolean", Description: "only report what would be imported"},
+	}
+	report := doc.Schema(importers.Report{})
+	importResponses := map[string]openapi.Response{
+		"200": ok("Dry run, nothing was stored", openapi.Object(map[string]*openapi.Schema{
+			"dry_run": {Type: "boolean"},
+			"report":  report,
+		})),
+		"201": ok("Tasks imported", openapi.Object(map[string]*openapi.Schema{
+			"message":  openapi.String(),
+			"imported": openapi.Integer(),
+			"report":   report,
+		})),
+		"400": failure("Missing or unreadable file"),
+		"401": problemResponse("Missing or invalid token"),
+	}
+	add(http.MethodPost, "/import/csv", &openapi.Operation{
+		Summary:  "Import tasks from a CSV file",
+		Tags:     []string{"imports"},
+		Security: bearer,
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(echo.MIMEMultipartForm, uploadSchema(map[string]*openapi.Schema{
+			"mapping": {Type: "string", Description: "JSON object of task fields to column names"},
+			"dry_run": dryRun["dry_run"],
+		}))},
+		Responses: importResponses,
+	})
+	for _, source := range []struct{ path, name string }{
+		{"/import/todoist", "a Todoist CSV or JSON export"},
+		{"/import/microsoft-todo", "a Microsoft To Do export"},
+		{"/import/google-tasks", "a Google Takeout Tasks.json"},
+	} {
+		add(http.MethodPost, source.path, &openapi.Operation{
+			Summary:     "Import tasks from " + source.name,
+			Tags:        []string{"imports"},
+			Security:    bearer,
+			RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(echo.MIMEMultipartForm, uploadSchema(dryRun))},
+			Responses:   importResponses,
+		})
+	}
+}
+
+var (
+	bearer = []map[string][]string{{"bearer": {}}}
+	basic  = []map[string][]string{{"basic": {}}}
+)
+
+func jsonBody(schema *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{Required: true, Content: openapi.Content(echo.MIMEApplicationJSON, schema)}
+}
+
+func ok(description string, schema *openapi.Schema) openapi.Response {
+	return openapi.Response{Description: description, Content: openapi.Content(echo.MIMEApplicationJSON, schema)}
+}
+
+// failure is a response with the {"error": ...} body of the handlers that
+// do not send problem details yet.
+func failure(description string) openapi.Response {
+	return ok(description, &openapi.Schema{Ref: "#/components/schemas/Error"})
+}
+
+// problemResponse is an RFC 7807 response, see the problem package.
+func problemResponse(description string) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content:     openapi.Content(problem.MIMEProblemJSON, &openapi.Schema{Ref: "#/components/schemas/Problem"}),
+	}
+}
+
+func statusSchema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{"status": openapi.String()})
+}
+
+func messageSchema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{"message": openapi.String()})
+}
+
+// uploadSchema is a multipart form with a file field and optional extra fields.
+func uploadSchema(fields map[string]*openapi.Schema) *openapi.Schema {
+	schema := &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"file": {Type: "string", Format: "binary"},
+		},
+		Required: []string{"file"},
+	}
+	for name, field := range fields {
+		schema.Properties[name] = field
+	}
+	return schema
+}
+
+// idempotent documents the Idempotency-Key header accepted by the protected
+// routes that change data.
+func idempotent(method string, op *openapi.Operation) {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return
+	}
+	op.Parameters = append(op.Parameters, openapi.Parameter{
+		Name: idempotency.HeaderKey,
+		In:   "header",
+		Description: "Unique key of the request, a retry with the same key gets the stored response " +
+			"with an Idempotent-Replayed header instead of being applied again.",
+		Schema: &openapi.Schema{Type: "string", MaxLength: &maxKeyLength},
+	})
+	op.Responses["409"] = problemResponse("A request with the same Idempotency-Key is in progress")
+	op.Responses["422"] = problemResponse("The Idempotency-Key was used for a different request")
+}
+
+var maxKeyLength = 255
+
+// conditionalRead documents If-None-Match on a route answering with an ETag.
+func conditionalRead(op *openapi.Operation) *openapi.Operation {
+	op.Parameters = append(op.Parameters, openapi.Parameter{
+		Name:        "If-None-Match",
+		In:          "header",
+		Description: "ETag of a previous response, the response is a 304 if it is still current.",
+		Schema:      openapi.String(),
+	})
+	op.Responses["304"] = openapi.Response{Description: "Not modified since the given ETag"}
+	return op
+}
+
+// conditionalWrite documents If-Match on a route changing a task.
+func conditionalWrite(op *openapi.Operation) *openapi.Operation {
+	op.Parameters = append(op.Parameters, openapi.Parameter{
+		Name:        "If-Match",
+		In:          "header",
+		Description: "ETag of the task, the change is refused if the task has since been modified.",
+		Schema:      openapi.String(),
+	})
+	op.Responses["412"] = problemResponse("The task has been modified since the given ETag")
+	return op
+}
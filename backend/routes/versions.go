@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"net/http"
+	"pianpianino/handlers"
+	"pianpianino/openapi"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// apiHandlers are the handlers behind the protected routes.
+type apiHandlers struct {
+	task     *handlers.TaskHandler
+	calendar *handlers.CalendarHandler
+	todoTxt  *handlers.TodoTxtHandler
+	backup   *handlers.BackupHandler
+	imports  *handlers.ImportHandler
+	graphql  *handlers.GraphQLHandler
+}
+
+type specFunc func(method, path string, op *openapi.Operation)
+
+// apiVersion is a set of protected routes mounted under /api/<name>. A breaking
+// change to the JSON of the API goes into a new version: its routes reuse the
+// handlers of the previous one for everything that did not change, and both
+// are served side by side until the old version reaches its sunset.
+type apiVersion struct {
+	name string
+	// routes registers the handlers of the version on its group
+	routes func(g *echo.Group, h apiHandlers)
+	// spec describes the routes for routes.Spec, with paths relative to the group
+	spec func(doc *openapi.Document, add specFunc)
+	// a deprecated version answers with Deprecation and Sunset headers
+	deprecation time.Time
+	sunset      time.Time
+}
+
+// apiVersions are ordered from the oldest, the last one is the current version.
+// To add v2, append it here and set the deprecation and sunset of v1.
+var apiVersions = []apiVersion{
+	{name: "v1", routes: registerV1, spec: describeV1},
+}
+
+// apiAlias is the unversioned /api prefix used before versioning was
+// introduced. It serves v1 and is deprecated in favour of /api/v1.
+var apiAlias = apiVersion{
+	name:        "v1",
+	deprecation: time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+	sunset:      time.Date(2027, time.October, 19, 0, 0, 0, 0, time.UTC),
+}
+
+func registerV1(g *echo.Group, h apiHandlers) {
+	g.GET("/tasks", h.task.GetAllTasks)
+	g.POST("/tasks", h.task.InsertTask)
+	g.POST("/tasks/batch", h.task.Batch)
+	g.GET("/tasks/:id", h.task.GetTask)
+	g.PATCH("/tasks/:id", h.task.UpdateTask)
+	g.DELETE("/tasks/:id", h.task.DeleteTask)
+	g.PATCH("/tasks/:id/toggle", h.task.ToggleTaskCompleted)
+	g.GET("/sync", h.task.PullChanges)
+	g.POST("/sync", h.task.PushChanges)
+	g.POST("/graphql", h.graphql.Query)
+	g.GET("/calendar", h.calendar.GetFeedURL)
+	g.GET("/export", h.backup.Export)
+	g.POST("/import", h.backup.Import)
+	g.GET("/export/todotxt", h.todoTxt.Export)
+	g.POST("/import/todotxt", h.todoTxt.Import)
+	g.POST("/import/csv", h.imports.CSV)
+	g.POST("/import/todoist", h.imports.Todoist)
+	g.POST("/import/microsoft-todo", h.imports.MicrosoftToDo)
+	g.POST("/import/google-tasks", h.imports.GoogleTasks)
+}
+
+func versionPrefix(v apiVersion) string {
+	return "/api/" + v.name
+}
+
+func currentVersion() apiVersion {
+	return apiVersions[len(apiVersions)-1]
+}
+
+func findVersion(name string) apiVersion {
+	for _, v := range apiVersions {
+		if v.name == name {
+			return v
+		}
+	}
+	panic("routes: unknown API version " + name)
+}
+
+// registerVersions mounts every version and the /api alias behind the given
+// middleware, authentication first.
+func registerVersions(e *echo.Echo, h apiHandlers, m ...echo.MiddlewareFunc) {
+	for _, v := range apiVersions {
+		g := e.Group(versionPrefix(v), append([]echo.MiddlewareFunc{deprecated(v)}, m...)...)
+		v.routes(g, h)
+	}
+	alias := findVersion(apiAlias.name)
+	alias.deprecation, alias.sunset = apiAlias.deprecation, apiAlias.sunset
+	alias.routes(e.Group("/api", append([]echo.MiddlewareFunc{deprecated(alias)}, m...)...), h)
+}
+
+// deprecated sets the headers of RFC 9745 and RFC 8594 on every response of a
+// deprecated version, errors included, and links the version to use instead.
+// The headers are set before authentication so that even a 401 carries them.
+func deprecated(v apiVersion) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if v.deprecation.IsZero() {
+			return next
+		}
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			header.Set("Deprecation", "@"+strconv.FormatInt(v.deprecation.Unix(), 10))
+			if !v.sunset.IsZero() {
+				header.Set("Sunset", v.sunset.UTC().Format(http.TimeFormat))
+			}
+			header.Add("Link", "<"+versionPrefix(currentVersion())+">; rel=\"successor-version\"")
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"pianpianino/problem"
+	"pianpianino/rpc/pb"
+	"pianpianino/service"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var errInvalidToken = problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "Missing or invalid token")
+
+// AuthServer adapts the UserService to gRPC, like handlers.AuthHandler.
+type AuthServer struct {
+	pb.UnimplementedAuthServiceServer
+	Users *service.UserService
+}
+
+func (s *AuthServer) Register(ctx context.Context, in *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	_, err := s.Users.Register(ctx, service.Registration{Username: in.GetUsername(), Password: in.GetPassword()})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RegisterResponse{}, nil
+}
+
+func (s *AuthServer) Login(ctx context.Context, in *pb.LoginRequest) (*pb.LoginResponse, error) {
+	token, err := s.Users.Login(ctx, service.Credentials{Username: in.GetUsername(), Password: in.GetPassword()})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.LoginResponse{Token: token}, nil
+}
+
+type userKey struct{}
+
+// public are the methods called without a token. Reflection is a streaming
+// service, which the unary interceptor does not see.
+var public = map[string]bool{
+	pb.AuthService_Register_FullMethodName: true,
+	pb.AuthService_Login_FullMethodName:    true,
+}
+
+// authenticator checks the Bearer token of the authorization metadata for
+// every unary method but the public ones.
+type authenticator struct {
+	secret []byte
+}
+
+func (a *authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if public[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	userID, err := a.userID(ctx)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	return handler(context.WithValue(ctx, userKey{}, userID), req)
+}
+
+func (a *authenticator) userID(ctx context.Context) (int64, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) != 1 {
+		return 0, errInvalidToken
+	}
+	raw, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found {
+		return 0, errInvalidToken
+	}
+
+	token, err := jwt.Parse(raw, func(*jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return 0, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, errInvalidToken
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errInvalidToken
+	}
+	return int64(userID), nil
+}
+
+// userFrom returns the user authenticated by the authenticator, or an
+// Unauthenticated status for a method it did not check.
+func userFrom(ctx context.Context) (int64, error) {
+	userID, ok := ctx.Value(userKey{}).(int64)
+	if !ok {
+		return 0, toStatus(errInvalidToken).Err()
+	}
+	return userID, nil
+}
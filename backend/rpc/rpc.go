@@ -0,0 +1,136 @@
+// Package rpc serves the services of proto/pianpianino/v1 over gRPC, next to
+// the REST API and on the same database. The code in rpc/pb is generated
+// from the .proto files with `buf generate`, see buf.gen.yaml.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"pianpianino/config"
+	"pianpianino/problem"
+	"pianpianino/repository"
+	"pianpianino/rpc/pb"
+	"pianpianino/service"
+
+	"github.com/uptrace/bun"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain is the domain of the ErrorInfo details, whose reason is the
+// code of the problem.
+const errorDomain = "pianpianino"
+
+// NewServer registers the auth and task services, along with the reflection
+// service so that tools like grpcurl can list them. Only the secret and the
+// token lifetime of cfg are used.
+func NewServer(DB *bun.DB, cfg *config.Config) *grpc.Server {
+	auth := &authenticator{secret: []byte(cfg.JWTSecret)}
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(statusErrors, auth.unary))
+	users := service.NewUserService(repository.NewBunUsers(DB), cfg.JWTSecret)
+	users.TokenTTL = cfg.TokenTTL
+	pb.RegisterAuthServiceServer(server, &AuthServer{Users: users})
+	pb.RegisterTaskServiceServer(server, &TaskServer{
+		Tasks: service.NewTaskService(repository.NewBunTasks(DB)),
+	})
+	reflection.Register(server)
+	return server
+}
+
+// statusErrors turns the problems returned by the services into statuses,
+// logging the cause of internal errors.
+func statusErrors(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return nil, err
+	}
+
+	p := problem.From(err)
+	if cause := errors.Unwrap(p); cause != nil {
+		log.Printf("%s: %v", info.FullMethod, cause)
+	}
+	return nil, toStatus(p).Err()
+}
+
+func toStatus(p *problem.Problem) *status.Status {
+	st := status.New(statusCode(p.Status), p.Error())
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: string(p.Code), Domain: errorDomain}}
+	if len(p.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, fe := range p.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       fe.Field,
+				Description: fe.Message,
+				Reason:      fe.Code,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+func statusCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	default:
+		return codes.Internal
+	}
+}
+
+// Service runs Server on Listener as a worker of server.Run.
+type Service struct {
+	Server   *grpc.Server
+	Listener net.Listener
+}
+
+// Serve blocks until Shutdown, which may come first when another server
+// fails at startup.
+func (s *Service) Serve() error {
+	err := s.Server.Serve(s.Listener)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown waits for the calls in flight until ctx is done, then cancels
+// them.
+func (s *Service) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Server.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"context"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/rpc/pb"
+	"pianpianino/service"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TaskServer adapts the TaskService to gRPC, like handlers.TaskHandler, the
+// version fields of the requests playing the part of If-Match.
+type TaskServer struct {
+	pb.UnimplementedTaskServiceServer
+	Tasks *service.TaskService
+}
+
+func (s *TaskServer) ListTasks(ctx context.Context, in *pb.ListTasksRequest) (*pb.ListTasksResponse, error) {
+	userID, err := userFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := s.Tasks.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListTasksResponse{Tasks: make([]*pb.Task, 0, len(tasks))}
+	for i := range tasks {
+		resp.Tasks = append(resp.Tasks, toProto(&tasks[i]))
+	}
+	return resp, nil
+}
+
+func (s *TaskServer) GetTask(ctx context.Context, in *pb.GetTaskRequest) (*pb.Task, error) {
+	userID, err := userFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	task, err := s.Tasks.Get(ctx, userID, in.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return toProto(task), nil
+}
+
+func (s *TaskServer) CreateTask(ctx context.Context, in *pb.CreateTaskRequest) (*pb.Task, error) {
+	userID, err := userFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	task, err := s.Tasks.Create(ctx, userID, service.NewTask{
+		Description: in.GetDescription(),
+		Priority:    models.Importance(in.GetPriority()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toProto(task), nil
+}
+
+// UpdateTask changes the fields named by the update mask, both description
+// and priority when it is empty.
+func (s *TaskServer) UpdateTask(ctx context.Context, in *pb.UpdateTaskRequest) (*pb.Task, error) {
+	userID, err := userFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := in.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		paths = []string{"description", "priority"}
+	}
+
+	var patch service.TaskPatch
+	for _, path := range paths {
+		switch path {
+		case "description":
+			patch.Description = &in.Description
+		case "priority":
+			priority := models.Importance(in.GetPriority())
+			patch.Priority = &priority
+		default:
+			return nil, problem.Validation().
+				Field("update_mask", problem.FieldNotAllowed, "update_mask can only name description and priority")
+		}
+	}
+
+	task, err := s.Tasks.Update(ctx, userID, in.GetId(), patch, service.Version(in.GetVersion()))
+	if err != nil {
+		return nil, err
+	}
+	return toProto(task), nil
+}
+
+func (s *TaskServer) ToggleTask(ctx context.Context, in *pb.ToggleTaskRequest) (*pb.Task, error) {
+	userID, err := userFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	task, err := s.Tasks.Toggle(ctx, userID, in.GetId(), service.Version(in.GetVersion()))
+	if err != nil {
+		return nil, err
+	}
+	return toProto(task), nil
+}
+
+func (s *TaskServer) DeleteTask(ctx context.Context, in *pb.DeleteTaskRequest) (*pb.DeleteTaskResponse, error) {
+	userID, err := userFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Tasks.Delete(ctx, userID, in.GetId(), service.Version(in.GetVersion())); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteTaskResponse{}, nil
+}
+
+// toProto relies on pb.Priority having the values of models.Importance.
+func toProto(task *models.Task) *pb.Task {
+	return &pb.Task{
+		Id:          task.ID,
+		Description: task.Description,
+		Priority:    pb.Priority(task.Priority),
+		Completed:   task.Completed,
+		Uid:         task.UID,
+		Version:     task.Version,
+		CreatedAt:   timestamppb.New(task.CreatedAt),
+		UpdatedAt:   timestamppb.New(task.UpdatedAt),
+	}
+}
@@ -0,0 +1,184 @@
+// Package server serves the REST API the way the configuration asks: on a
+// port or a Unix socket, over HTTP or HTTPS, with or without HTTP/2. Run
+// lets the requests in flight finish before stopping.
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"pianpianino/config"
+	"time"
+)
+
+// New returns the server of handler, with the timeouts, protocols and
+// certificate of cfg. It is started by Serve.
+func New(cfg *config.Config, handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:         cfg.Address(),
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+		Protocols:    new(http.Protocols),
+	}
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(cfg.HTTP2 && cfg.TLS())
+	srv.Protocols.SetUnencryptedHTTP2(cfg.HTTP2 && !cfg.TLS())
+	if !cfg.TLS() {
+		return srv, nil
+	}
+
+	var cert tls.Certificate
+	var err error
+	if cfg.TLSSelfSigned {
+		cert, err = SelfSigned(cfg.Host)
+	} else {
+		// loaded now, a wrong file is reported before listening
+		cert, err = tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	srv.TLSConfig = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	return srv, nil
+}
+
+// Listen opens the Unix socket of cfg, or else its address.
+func Listen(cfg *config.Config) (net.Listener, error) {
+	if cfg.Socket == "" {
+		return net.Listen("tcp", cfg.Address())
+	}
+
+	// a socket left behind by a server that crashed is replaced, any other
+	// file is an error
+	if info, err := os.Stat(cfg.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(cfg.Socket); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", cfg.Socket)
+}
+
+// Serve blocks serving the connections of ln until srv is shut down.
+func Serve(srv *http.Server, ln net.Listener) error {
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
+
+// Worker is a server running next to the REST API, like the gRPC one.
+// Serve blocks until Shutdown stops it.
+type Worker interface {
+	Serve() error
+	Shutdown(ctx context.Context) error
+}
+
+// Run serves srv on ln, and the workers, until ctx is done or one of them
+// fails. It then stops accepting connections and gives the requests in
+// flight, and the workers, the timeout to finish; the connections still
+// open after it are closed.
+func Run(ctx context.Context, srv *http.Server, ln net.Listener, timeout time.Duration, workers ...Worker) error {
+	// buffered, the servers that stop late must not block
+	failed := make(chan error, len(workers)+1)
+	go func() { failed <- Serve(srv, ln) }()
+	for _, worker := range workers {
+		go func() { failed <- worker.Serve() }()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-failed:
+		// the others are stopped as well
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stopped := make(chan error, len(workers)+1)
+	go func() { stopped <- srv.Shutdown(shutdownCtx) }()
+	for _, worker := range workers {
+		go func() { stopped <- worker.Shutdown(shutdownCtx) }()
+	}
+	for range len(workers) + 1 {
+		if stopErr := <-stopped; stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+
+	// the connections still open are closed even when a failure is reported
+	if shutdownCtx.Err() != nil {
+		srv.Close()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("requests still running after %s were interrupted: %w", timeout, err)
+	}
+	return err
+}
+
+// URL tells where the server of cfg listening on ln can be reached.
+func URL(cfg *config.Config, ln net.Listener) string {
+	if ln.Addr().Network() == "unix" {
+		return "unix:" + ln.Addr().String()
+	}
+	scheme := "http://"
+	if cfg.TLS() {
+		scheme = "https://"
+	}
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	if ip := net.ParseIP(host); cfg.Host == "" || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return scheme + net.JoinHostPort(host, port)
+}
+
+// SelfSigned generates a certificate for localhost and host, good for a
+// year of development: browsers show a warning before accepting it.
+func SelfSigned(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"PianPianino development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else if host != "" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
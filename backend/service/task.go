@@ -0,0 +1,197 @@
+// Package service holds the business rules of the tasks and the users, on
+// top of the repositories, so that the REST handlers, GraphQL, gRPC and the
+// command-line tools share them. Failures are *problem.Problem values, ready
+// to be written by the handlers.
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/repository"
+	"pianpianino/validation"
+	"time"
+)
+
+var (
+	ErrTaskNotFound = problem.New(http.StatusNotFound, problem.CodeTaskNotFound, "Task not found")
+	ErrTaskModified = problem.New(http.StatusPreconditionFailed, problem.CodeTaskModified,
+		"Task has been modified, fetch it again before changing it")
+)
+
+// NewTask is the body of POST /tasks. CalDAV clients also create completed
+// tasks and name them, with a UID and a resource name.
+type NewTask struct {
+	Description string            `json:"description" validate:"required,max=1000"`
+	Priority    models.Importance `json:"priority" validate:"importance"`
+	Completed   bool              `json:"-"`
+	UID         string            `json:"-"`
+	DAVName     string            `json:"-"`
+}
+
+// TaskPatch changes the fields that are set.
+type TaskPatch struct {
+	Description *string            `json:"description" validate:"omitnil,min=1,max=1000"`
+	Priority    *models.Importance `json:"priority" validate:"omitnil,importance"`
+	Completed   *bool              `json:"completed"`
+}
+
+// Precondition is checked against the current task before it is changed,
+// like If-Match. It gets nil when the task does not exist, a nil
+// Precondition always holds.
+type Precondition func(task *models.Task) bool
+
+// Version holds when the task has the given version, any version for 0.
+func Version(version int64) Precondition {
+	if version == 0 {
+		return nil
+	}
+	return func(task *models.Task) bool {
+		return task != nil && task.Version == version
+	}
+}
+
+type TaskService struct {
+	Tasks repository.Tasks
+}
+
+func NewTaskService(tasks repository.Tasks) *TaskService {
+	return &TaskService{Tasks: tasks}
+}
+
+func (s *TaskService) List(ctx context.Context, userID int64) ([]models.Task, error) {
+	tasks, err := s.Tasks.List(ctx, userID)
+	if err != nil {
+		return nil, problem.Internal("Failed to fetch tasks", err)
+	}
+	return tasks, nil
+}
+
+// ListByUsers fetches the tasks of several users with a single query, for
+// the loaders of GraphQL.
+func (s *TaskService) ListByUsers(ctx context.Context, userIDs []int64) ([]models.Task, error) {
+	tasks, err := s.Tasks.ListByUsers(ctx, userIDs)
+	if err != nil {
+		return nil, problem.Internal("Failed to fetch tasks", err)
+	}
+	return tasks, nil
+}
+
+func (s *TaskService) Get(ctx context.Context, userID, id int64) (*models.Task, error) {
+	task, err := s.Tasks.Get(ctx, userID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, problem.Internal("Failed to fetch task", err)
+	}
+	return task, nil
+}
+
+func (s *TaskService) Create(ctx context.Context, userID int64, input NewTask) (*models.Task, error) {
+	if err := validation.Default.Validate(&input); err != nil {
+		return nil, err
+	}
+
+	task := &models.Task{
+		UserID:      userID,
+		Description: input.Description,
+		Priority:    input.Priority,
+		UID:         input.UID,
+		DAVName:     input.DAVName,
+	}
+	task.SetCompleted(input.Completed, time.Now())
+	if err := s.Tasks.Create(ctx, task); err != nil {
+		return nil, problem.Internal("Failed to create task", err)
+	}
+	return task, nil
+}
+
+func (s *TaskService) Update(ctx context.Context, userID, id int64, patch TaskPatch, cond Precondition) (*models.Task, error) {
+	if err := validation.Default.Validate(&patch); err != nil {
+		return nil, err
+	}
+
+	task, err := s.find(ctx, userID, id, cond)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Description != nil {
+		task.Description = *patch.Description
+	}
+	if patch.Priority != nil {
+		task.Priority = *patch.Priority
+	}
+	if patch.Completed != nil {
+		task.SetCompleted(*patch.Completed, time.Now())
+	}
+	return task, s.save(ctx, task)
+}
+
+func (s *TaskService) Toggle(ctx context.Context, userID, id int64, cond Precondition) (*models.Task, error) {
+	task, err := s.find(ctx, userID, id, cond)
+	if err != nil {
+		return nil, err
+	}
+
+	task.SetCompleted(!task.Completed, time.Now())
+	return task, s.save(ctx, task)
+}
+
+// Delete fails with ErrTaskModified rather than ErrTaskNotFound when the
+// task is gone and cond does not hold, the way If-Match matches no missing
+// resource.
+func (s *TaskService) Delete(ctx context.Context, userID, id int64, cond Precondition) error {
+	task, err := s.find(ctx, userID, id, cond)
+	if errors.Is(err, ErrTaskNotFound) && cond != nil && !cond(nil) {
+		return ErrTaskModified
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.Tasks.Delete(ctx, task)
+	if errors.Is(err, repository.ErrConflict) {
+		return ErrTaskModified
+	}
+	if err != nil {
+		return problem.Internal("Failed to delete task", err)
+	}
+	return nil
+}
+
+// Atomic runs fn with a service whose changes are all kept, or none of them
+// when fn fails.
+func (s *TaskService) Atomic(ctx context.Context, fn func(ctx context.Context, tasks *TaskService) error) error {
+	return s.Tasks.Atomic(ctx, func(ctx context.Context, tasks repository.Tasks) error {
+		return fn(ctx, &TaskService{Tasks: tasks})
+	})
+}
+
+func (s *TaskService) find(ctx context.Context, userID, id int64, cond Precondition) (*models.Task, error) {
+	task, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if cond != nil && !cond(task) {
+		return nil, ErrTaskModified
+	}
+	return task, nil
+}
+
+// save stores a changed task with a new version, provided that nobody
+// changed it since it was loaded.
+func (s *TaskService) save(ctx context.Context, task *models.Task) error {
+	task.UpdatedAt = time.Now()
+	err := s.Tasks.Update(ctx, task)
+	if errors.Is(err, repository.ErrConflict) {
+		return ErrTaskModified
+	}
+	if err != nil {
+		return problem.Internal("Failed to update task", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/repository"
+	"pianpianino/validation"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TokenLifetime is how long a token returned by Login is valid, unless the
+// service has a TokenTTL.
+const TokenLifetime = 2 * time.Hour
+
+var (
+	ErrInvalidCredentials = problem.New(http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials")
+	ErrUsernameTaken      = problem.New(http.StatusConflict, problem.CodeUsernameTaken, "Username is already taken")
+)
+
+// Registration adds the rules for new accounts, users registered before
+// them keep logging in all the same. bcrypt ignores passwords past 72 bytes.
+type Registration struct {
+	Username string `json:"username" validate:"required,username"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type Credentials struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type UserService struct {
+	Users repository.Users
+	// JWTSecret signs the tokens returned by Login
+	JWTSecret string
+	TokenTTL  time.Duration
+}
+
+func NewUserService(users repository.Users, jwtSecret string) *UserService {
+	return &UserService{Users: users, JWTSecret: jwtSecret}
+}
+
+func (s *UserService) Register(ctx context.Context, input Registration) (*models.User, error) {
+	if err := validation.Default.Validate(&input); err != nil {
+		return nil, err
+	}
+
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, problem.Internal("Failed to hash the password", err)
+	}
+
+	user := &models.User{
+		Username: input.Username,
+		Password: string(hashPassword),
+	}
+	err = s.Users.Create(ctx, user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, problem.Internal("Failed to create the user", err)
+	}
+	return user, nil
+}
+
+// Authenticate returns the user with these credentials.
+func (s *UserService) Authenticate(ctx context.Context, input Credentials) (*models.User, error) {
+	if err := validation.Default.Validate(&input); err != nil {
+		return nil, err
+	}
+
+	user, err := s.Users.FindByUsername(ctx, input.Username)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, problem.Internal("Failed to look the user up", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// Login returns a token for the user with these credentials, accepted by
+// both the REST and the gRPC API.
+func (s *UserService) Login(ctx context.Context, input Credentials) (string, error) {
+	user, err := s.Authenticate(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": user.ID,
+		"exp":     time.Now().Add(s.tokenTTL()).Unix(),
+		"iat":     time.Now().Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(s.JWTSecret))
+	if err != nil {
+		return "", problem.Internal("Could not create token", err)
+	}
+	return tokenString, nil
+}
+
+func (s *UserService) tokenTTL() time.Duration {
+	if s.TokenTTL > 0 {
+		return s.TokenTTL
+	}
+	return TokenLifetime
+}
+
+// Get returns the users with the given IDs, missing ones are left out.
+func (s *UserService) Get(ctx context.Context, ids ...int64) ([]models.User, error) {
+	users, err := s.Users.Get(ctx, ids)
+	if err != nil {
+		return nil, problem.Internal("Failed to fetch users", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,274 @@
+// Package tasksync lets offline-first clients keep a copy of the tasks of a
+// user. A client pulls the changes made since its cursor, a position in the
+// sequence of models.TaskChange, and pushes the mutations it queued while
+// offline. The server stays the source of truth: a mutation based on an old
+// version of a task is not applied and the current task is returned instead.
+package tasksync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pianpianino/database"
+	"pianpianino/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// MaxPull is the largest number of changes returned by a single pull.
+const MaxPull = 500
+
+// ClientIDTTL is how long the outcome of a mutation pushed with a client ID
+// is kept, a client offline for longer may apply its mutations twice.
+const ClientIDTTL = 30 * 24 * time.Hour
+
+const (
+	OpPut    = "put"
+	OpDelete = "delete"
+)
+
+const (
+	StatusApplied  = "applied"
+	StatusConflict = "conflict"
+)
+
+// Delta holds the tasks created or changed and the IDs of the tasks deleted
+// since a cursor. When More is set the client pulls again from Cursor.
+type Delta struct {
+	Cursor  int64         `json:"cursor"`
+	More    bool          `json:"more"`
+	Tasks   []models.Task `json:"tasks"`
+	Deleted []int64       `json:"deleted"`
+}
+
+// Mutation is a change queued by a client. A put without ID creates a task,
+// otherwise it replaces the task if BaseVersion, the version the client
+// started from, is still its current version. The same holds for a delete.
+type Mutation struct {
+	Op          string            `json:"op" validate:"required,oneof=put delete"`
+	ID          int64             `json:"id,omitempty" validate:"required_if=Op delete"`
+	BaseVersion int64             `json:"base_version,omitempty" validate:"required_with=ID"`
+	ClientID    string            `json:"client_id,omitempty" validate:"max=64"`
+	Description string            `json:"description,omitempty" validate:"required_if=Op put,max=1000"`
+	Priority    models.Importance `json:"priority,omitempty" validate:"importance"`
+	Completed   bool              `json:"completed,omitempty"`
+}
+
+// Outcome tells a client what became of a mutation. Task is the task as
+// stored on the server, after the mutation if it was applied; Deleted is set
+// instead when the task no longer exists.
+type Outcome struct {
+	Index    int          `json:"index"`
+	ClientID string       `json:"client_id,omitempty"`
+	ID       int64        `json:"id"`
+	Status   string       `json:"status"`
+	Task     *models.Task `json:"task,omitempty"`
+	Deleted  bool         `json:"deleted,omitempty"`
+}
+
+// Pull returns at most limit changes made to the tasks of the user after
+// since, a cursor returned by a previous pull or 0 for a full sync.
+func Pull(ctx context.Context, DB bun.IDB, userID, since int64, limit int) (*Delta, error) {
+	if limit <= 0 || limit > MaxPull {
+		limit = MaxPull
+	}
+
+	changes := make([]models.TaskChange, 0)
+	err := DB.NewSelect().
+		Model(&changes).
+		Where("user_id = ? AND id > ?", userID, since).
+		Order("id ASC").
+		Limit(limit + 1).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := &Delta{Cursor: since, Tasks: make([]models.Task, 0), Deleted: make([]int64, 0)}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		delta.More = true
+	}
+	if len(changes) == 0 {
+		return delta, nil
+	}
+	delta.Cursor = changes[len(changes)-1].ID
+
+	changed := make([]int64, 0, len(changes))
+	for _, change := range changes {
+		if change.Deleted {
+			delta.Deleted = append(delta.Deleted, change.TaskID)
+		} else {
+			changed = append(changed, change.TaskID)
+		}
+	}
+	if len(changed) == 0 {
+		return delta, nil
+	}
+
+	err = DB.NewSelect().
+		Model(&delta.Tasks).
+		Where("user_id = ? AND id IN (?)", userID, bun.In(changed)).
+		Order("id ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+// Push applies the mutations in order, each one in its own transaction so
+// that a conflict does not hold back the others. A mutation whose ClientID
+// was already pushed is not applied again, its first outcome is returned:
+// when two pushes of the same mutation race, the one that remembers it last
+// breaks the unique index of sync_mutations and returns the outcome of the
+// other one.
+func Push(ctx context.Context, DB *bun.DB, userID int64, mutations []Mutation) ([]Outcome, error) {
+	_, err := DB.NewDelete().
+		Model((*models.SyncMutation)(nil)).
+		Where("expires_at < ?", time.Now()).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]Outcome, 0, len(mutations))
+	for i, m := range mutations {
+		var outcome Outcome
+		err := DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+			if m.ClientID == "" {
+				var err error
+				outcome, err = apply(ctx, tx, userID, m)
+				return err
+			}
+
+			found, err := pushed(ctx, tx, userID, m.ClientID, &outcome)
+			if err != nil || found {
+				return err
+			}
+			if outcome, err = apply(ctx, tx, userID, m); err != nil {
+				return err
+			}
+			return remember(ctx, tx, userID, m.ClientID, outcome)
+		})
+		if m.ClientID != "" && database.IsUniqueViolation(err) {
+			// the transaction is rolled back, the mutation was applied once
+			var found bool
+			found, err = pushed(ctx, DB, userID, m.ClientID, &outcome)
+			if err == nil && !found {
+				err = fmt.Errorf("mutation %q was pushed concurrently but is not stored", m.ClientID)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		outcome.Index = i
+		outcome.ClientID = m.ClientID
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes, nil
+}
+
+// pushed reads into outcome what became of the mutation with clientID.
+func pushed(ctx context.Context, DB bun.IDB, userID int64, clientID string, outcome *Outcome) (bool, error) {
+	stored := new(models.SyncMutation)
+	err := DB.NewSelect().
+		Model(stored).
+		Where("user_id = ? AND client_id = ?", userID, clientID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(stored.Outcome, outcome)
+}
+
+func remember(ctx context.Context, tx bun.Tx, userID int64, clientID string, outcome Outcome) error {
+	outcome.ClientID = clientID
+	data, err := json.Marshal(outcome)
+	if err != nil {
+		return err
+	}
+	_, err = tx.NewInsert().
+		Model(&models.SyncMutation{
+			UserID:    userID,
+			ClientID:  clientID,
+			Outcome:   data,
+			ExpiresAt: time.Now().Add(ClientIDTTL),
+		}).
+		Exec(ctx)
+	return err
+}
+
+func apply(ctx context.Context, tx bun.Tx, userID int64, m Mutation) (Outcome, error) {
+	if m.Op == OpPut && m.ID == 0 {
+		task := &models.Task{
+			UserID:      userID,
+			Description: m.Description,
+			Priority:    m.Priority,
+			Version:     1,
+		}
+		task.SetCompleted(m.Completed, time.Now())
+		_, err := tx.NewInsert().
+			Model(task).
+			Exec(ctx)
+		if err != nil {
+			return Outcome{}, err
+		}
+		err = models.RecordChange(ctx, tx, userID, false, task.ID)
+		return Outcome{ID: task.ID, Status: StatusApplied, Task: task}, err
+	}
+
+	task := new(models.Task)
+	err := tx.NewSelect().
+		Model(task).
+		Where("id = ? AND user_id = ?", m.ID, userID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		// deleting a deleted task is not a conflict, changing it is
+		status := StatusConflict
+		if m.Op == OpDelete {
+			status = StatusApplied
+		}
+		return Outcome{ID: m.ID, Status: status, Deleted: true}, nil
+	}
+	if err != nil {
+		return Outcome{}, err
+	}
+	if task.Version != m.BaseVersion {
+		return Outcome{ID: task.ID, Status: StatusConflict, Task: task}, nil
+	}
+
+	if m.Op == OpDelete {
+		_, err = tx.NewDelete().
+			Model(task).
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return Outcome{}, err
+		}
+		err = models.RecordChange(ctx, tx, userID, true, task.ID)
+		return Outcome{ID: task.ID, Status: StatusApplied, Deleted: true}, err
+	}
+
+	task.Description = m.Description
+	task.Priority = m.Priority
+	task.UpdatedAt = time.Now()
+	task.SetCompleted(m.Completed, task.UpdatedAt)
+	task.Version++
+	_, err = tx.NewUpdate().
+		Model(task).
+		Column("description", "importance", "completed", "completed_at", "updated_at", "version").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return Outcome{}, err
+	}
+	err = models.RecordChange(ctx, tx, userID, false, task.ID)
+	return Outcome{ID: task.ID, Status: StatusApplied, Task: task}, err
+}
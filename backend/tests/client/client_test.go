@@ -0,0 +1,187 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/client"
+	"pianpianino/config"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"pianpianino/routes"
+	"pianpianino/tests/testdb"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect"
+)
+
+const testJWTSecret = "test-secret-key"
+
+// setUpTestServer serves the real routes on top of the test database.
+func setUpTestServer(t *testing.T) *httptest.Server {
+	DB := testdb.Open(t, (*models.User)(nil), (*models.Task)(nil), (*models.TaskChange)(nil))
+	if DB.Dialect().Name() == dialect.SQLite {
+		// every connection to :memory: would open a different database
+		DB.SetMaxOpenConns(1)
+	}
+
+	cfg := config.Default()
+	cfg.JWTSecret = testJWTSecret
+
+	e := echo.New()
+	routes.SetupRoutes(e, cfg, routes.Handlers{
+		Auth:     &handlers.AuthHandler{DB: DB, JWTSecret: cfg.JWTSecret},
+		Task:     handlers.NewTaskHandler(DB),
+		Calendar: &handlers.CalendarHandler{DB: DB, JWTSecret: cfg.JWTSecret},
+		CalDAV:   handlers.NewCalDAVHandler(DB),
+		TodoTxt:  &handlers.TodoTxtHandler{DB: DB},
+		Backup:   &handlers.BackupHandler{DB: DB},
+		Import:   &handlers.ImportHandler{DB: DB},
+	})
+
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newLoggedInClient(t *testing.T, server *httptest.Server) *client.Client {
+	ctx := context.Background()
+	c := client.New(server.URL)
+	assert.NoError(t, c.Register(ctx, "testuser", "password123"))
+	assert.NoError(t, c.Login(ctx, "testuser", "password123"))
+	return c
+}
+
+func TestClientTaskLifecycle(t *testing.T) {
+	server := setUpTestServer(t)
+	c := newLoggedInClient(t, server)
+	ctx := context.Background()
+
+	task, err := c.CreateTask(ctx, "Buy milk", models.High)
+	assert.NoError(t, err)
+	assert.NotZero(t, task.ID)
+	assert.Equal(t, "Buy milk", task.Description)
+	assert.Equal(t, models.High, task.Priority)
+
+	assert.NoError(t, c.ToggleTask(ctx, task.ID))
+	toggled, err := c.GetTask(ctx, task.ID)
+	assert.NoError(t, err)
+	assert.True(t, toggled.Completed)
+
+	description := "Buy oat milk"
+	updated, err := c.UpdateTask(ctx, task.ID, client.TaskUpdate{Description: &description})
+	assert.NoError(t, err)
+	assert.Equal(t, description, updated.Description)
+
+	tasks, err := c.ListTasks(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, tasks, 1) {
+		assert.True(t, tasks[0].Completed)
+		assert.Equal(t, description, tasks[0].Description)
+	}
+
+	assert.NoError(t, c.DeleteTask(ctx, task.ID))
+	tasks, err = c.ListTasks(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, tasks)
+}
+
+func TestClientTypedErrors(t *testing.T) {
+	server := setUpTestServer(t)
+	c := newLoggedInClient(t, server)
+	ctx := context.Background()
+
+	description := "Missing"
+	_, err := c.UpdateTask(ctx, 999, client.TaskUpdate{Description: &description})
+	assert.ErrorIs(t, err, client.ErrNotFound)
+	var apiErr *client.APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, 404, apiErr.StatusCode)
+		assert.Equal(t, "task_not_found", apiErr.Code)
+		assert.Equal(t, "Task not found", apiErr.Message)
+	}
+
+	_, err = c.GetTask(ctx, 999)
+	assert.ErrorIs(t, err, client.ErrNotFound)
+
+	_, err = c.CreateTask(ctx, "", models.NotSet)
+	assert.ErrorIs(t, err, client.ErrBadRequest)
+
+	err = client.New(server.URL).Login(ctx, "testuser", "wrong")
+	assert.ErrorIs(t, err, client.ErrUnauthorized)
+	assert.EqualError(t, err, "Invalid credentials")
+}
+
+func TestClientPreconditionFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusPreconditionFailed)
+		_, _ = w.Write([]byte(`{"status": 412, "code": "task_modified", "detail": "Task has been modified"}`))
+	}))
+	t.Cleanup(server.Close)
+	c := client.New(server.URL)
+	c.SetToken("token")
+
+	_, err := c.GetTask(context.Background(), 1)
+	assert.ErrorIs(t, err, client.ErrPreconditionFailed)
+	assert.NotErrorIs(t, err, client.ErrConflict)
+	assert.EqualError(t, err, "Task has been modified")
+}
+
+func TestClientWithoutCredentials(t *testing.T) {
+	server := setUpTestServer(t)
+	c := client.New(server.URL)
+	c.SetToken("not-a-token")
+
+	_, err := c.ListTasks(context.Background())
+	assert.ErrorIs(t, err, client.ErrUnauthorized)
+}
+
+func TestClientRefreshesExpiredToken(t *testing.T) {
+	server := setUpTestServer(t)
+	c := newLoggedInClient(t, server)
+
+	var refreshed []string
+	c.OnToken = func(token string) { refreshed = append(refreshed, token) }
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 1,
+		"exp":     time.Now().Add(-time.Hour).Unix(),
+	}).SignedString([]byte(testJWTSecret))
+	assert.NoError(t, err)
+	c.SetToken(expired)
+
+	_, err = c.ListTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, refreshed, 1)
+	assert.NotEqual(t, expired, c.Token())
+}
+
+func TestClientRetriesRejectedToken(t *testing.T) {
+	server := setUpTestServer(t)
+	c := newLoggedInClient(t, server)
+
+	// a token the client cannot read is only renewed after the server rejects it
+	c.SetToken("not-a-token")
+	_, err := c.CreateTask(context.Background(), "Retry me", models.Low)
+	assert.NoError(t, err)
+
+	tasks, err := c.ListTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+}
+
+func TestClientHonoursContext(t *testing.T) {
+	server := setUpTestServer(t)
+	c := newLoggedInClient(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.ListTasks(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
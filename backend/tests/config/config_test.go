@@ -0,0 +1,241 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"pianpianino/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setUpDir runs the test in an empty directory, without the variables of
+// the environment the settings could come from.
+func setUpDir(t *testing.T) string {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, name := range []string{
+		"HOST", "PORT", "GRPC_PORT", "SOCKET", "TLS_CERT", "TLS_KEY", "TLS_SELF_SIGNED", "HTTP2",
+		"READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "SHUTDOWN_TIMEOUT", "DATABASE_DSN", "JWT_SECRET", "CORS_ORIGINS", "TOKEN_TTL", config.EnvFile,
+	} {
+		if value, ok := os.LookupEnv(name); ok {
+			t.Setenv(name, value)
+			os.Unsetenv(name)
+		}
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	setUpDir(t)
+	t.Setenv("DATABASE_DSN", "file:test.db")
+	t.Setenv("JWT_SECRET", "secret")
+
+	cfg, err := config.Load(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1323, cfg.Port)
+	assert.Equal(t, 1324, cfg.GRPCPort)
+	assert.Equal(t, "file:test.db", cfg.DatabaseDSN)
+	assert.Equal(t, "secret", cfg.JWTSecret)
+	assert.Equal(t, []string{"http://localhost:5173", "http://localhost:1323"}, cfg.CORSOrigins)
+	assert.Equal(t, 2*time.Hour, cfg.TokenTTL)
+	assert.Equal(t, ":1323", cfg.Address())
+	assert.Equal(t, ":1324", cfg.GRPCAddress())
+	assert.True(t, cfg.HTTP2)
+	assert.False(t, cfg.TLS())
+	assert.Equal(t, 30*time.Second, cfg.ReadTimeout)
+	assert.Equal(t, time.Minute, cfg.WriteTimeout)
+	assert.Equal(t, 2*time.Minute, cfg.IdleTimeout)
+	assert.Equal(t, 15*time.Second, cfg.ShutdownTimeout)
+}
+
+func TestLoadServerSettings(t *testing.T) {
+	setUpDir(t)
+	t.Setenv("DATABASE_DSN", "file:test.db")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("HTTP2", "false")
+	t.Setenv("READ_TIMEOUT", "5s")
+
+	cfg, err := config.Load([]string{"-host", "::1", "-tls-self-signed", "-socket", "/run/pianpianino.sock", "-idle-timeout", "0"})
+	assert.NoError(t, err)
+	assert.Equal(t, "[::1]:1323", cfg.Address())
+	assert.Equal(t, "[::1]:1324", cfg.GRPCAddress())
+	assert.Equal(t, "/run/pianpianino.sock", cfg.Socket)
+	assert.True(t, cfg.TLS())
+	assert.False(t, cfg.HTTP2)
+	assert.Equal(t, 5*time.Second, cfg.ReadTimeout)
+	assert.Equal(t, time.Duration(0), cfg.IdleTimeout)
+
+	cfg, err = config.Load([]string{"-http2"})
+	assert.NoError(t, err)
+	assert.True(t, cfg.HTTP2)
+}
+
+func TestLoadWithoutDotenv(t *testing.T) {
+	setUpDir(t)
+	t.Setenv("DATABASE_DSN", "file:test.db")
+	t.Setenv("JWT_SECRET", "secret")
+
+	_, err := config.Load(nil)
+	assert.NoError(t, err)
+}
+
+func TestLoadDotenvInParentDirectory(t *testing.T) {
+	dir := setUpDir(t)
+	writeFile(t, ".env", "DATABASE_DSN=./../db.sqlite\nJWT_SECRET=secret123\n")
+	backend := filepath.Join(dir, "backend")
+	assert.NoError(t, os.Mkdir(backend, 0755))
+	t.Chdir(backend)
+
+	cfg, err := config.Load(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "./../db.sqlite", cfg.DatabaseDSN)
+	assert.Equal(t, "secret123", cfg.JWTSecret)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	setUpDir(t)
+	writeFile(t, "config.yaml", `
+port: 8000
+grpc_port: 8001
+database_dsn: file:yaml.db
+jwt_secret: from-yaml
+cors_origins:
+  - https://yaml.example.com
+token_ttl: 1h
+`)
+	writeFile(t, ".env", "PIANPIANINO_CONFIG=config.yaml\nPORT=8100\nDATABASE_DSN=file:dotenv.db\nTOKEN_TTL=30m\n")
+	t.Setenv("PORT", "8200")
+	t.Setenv("TOKEN_TTL", "45m")
+
+	cfg, err := config.Load([]string{"-port", "8300"})
+	assert.NoError(t, err)
+	// flags, then the environment, then .env, then the file
+	assert.Equal(t, 8300, cfg.Port)
+	assert.Equal(t, 45*time.Minute, cfg.TokenTTL)
+	assert.Equal(t, "file:dotenv.db", cfg.DatabaseDSN)
+	assert.Equal(t, 8001, cfg.GRPCPort)
+	assert.Equal(t, "from-yaml", cfg.JWTSecret)
+	assert.Equal(t, []string{"https://yaml.example.com"}, cfg.CORSOrigins)
+}
+
+func TestLoadConfigFlag(t *testing.T) {
+	setUpDir(t)
+	writeFile(t, "other.yaml", "database_dsn: file:other.db\njwt_secret: secret\n")
+
+	cfg, err := config.Load([]string{"-config", "other.yaml", "-cors-origins", "https://a.example.com, https://b.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "file:other.db", cfg.DatabaseDSN)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.CORSOrigins)
+}
+
+func TestLoadTOMLFile(t *testing.T) {
+	setUpDir(t)
+	writeFile(t, "config.toml", `
+port = 8200
+database_dsn = "file:toml.db"
+jwt_secret = "from-toml"
+token_ttl = "45m"
+cors_origins = ["https://toml.example.com"]
+`)
+
+	cfg, err := config.Load([]string{"-config", "config.toml"})
+	assert.NoError(t, err)
+	assert.Equal(t, 8200, cfg.Port)
+	assert.Equal(t, "file:toml.db", cfg.DatabaseDSN)
+	assert.Equal(t, "from-toml", cfg.JWTSecret)
+	assert.Equal(t, 45*time.Minute, cfg.TokenTTL)
+	assert.Equal(t, []string{"https://toml.example.com"}, cfg.CORSOrigins)
+}
+
+func TestLoadMissingConfigFile(t *testing.T) {
+	setUpDir(t)
+	t.Setenv(config.EnvFile, "missing.yaml")
+
+	_, err := config.Load(nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLoadUnknownSettingInFile(t *testing.T) {
+	setUpDir(t)
+	writeFile(t, "config.yaml", "database_dsn: file:test.db\njwt_secret: secret\njwt_secert: typo\n")
+
+	_, err := config.Load([]string{"-config", "config.yaml"})
+	assert.ErrorContains(t, err, "jwt_secert")
+}
+
+func TestLoadUnknownSettingInTOMLFile(t *testing.T) {
+	setUpDir(t)
+	writeFile(t, "config.toml", "database_dsn = \"file:test.db\"\njwt_secret = \"secret\"\njwt_secert = \"typo\"\n")
+
+	_, err := config.Load([]string{"-config", "config.toml"})
+	assert.ErrorContains(t, err, "jwt_secert")
+}
+
+func TestLoadInvalidValues(t *testing.T) {
+	setUpDir(t)
+	t.Setenv("DATABASE_DSN", "file:test.db")
+	t.Setenv("JWT_SECRET", "secret")
+
+	_, err := config.Load([]string{"-port", "http"})
+	assert.ErrorContains(t, err, `flags: PORT: invalid port "http"`)
+
+	t.Setenv("TOKEN_TTL", "two hours")
+	_, err = config.Load(nil)
+	assert.ErrorContains(t, err, "environment: TOKEN_TTL")
+}
+
+func TestLoadHelp(t *testing.T) {
+	setUpDir(t)
+
+	_, err := config.Load([]string{"-h"})
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.Port = 70000
+	cfg.GRPCPort = 70000
+	cfg.CORSOrigins = []string{"*", "https://example.com", "example.com", "https://example.com/app"}
+	cfg.TokenTTL = 0
+	cfg.ShutdownTimeout = 0
+
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "port must be between 1 and 65535, not 70000")
+	assert.ErrorContains(t, err, "grpc_port must be between 1 and 65535, not 70000")
+	assert.ErrorContains(t, err, "port and grpc_port must differ")
+	assert.ErrorContains(t, err, "database_dsn is required")
+	assert.ErrorContains(t, err, "jwt_secret is required")
+	assert.ErrorContains(t, err, `"example.com" is not an origin`)
+	assert.ErrorContains(t, err, `"https://example.com/app" is not an origin`)
+	assert.NotContains(t, err.Error(), `"https://example.com" is not`)
+	assert.ErrorContains(t, err, "token_ttl must be positive")
+	assert.ErrorContains(t, err, "shutdown_timeout must be positive")
+}
+
+func TestValidateTLS(t *testing.T) {
+	cfg := config.Default()
+	cfg.DatabaseDSN = "file:test.db"
+	cfg.JWTSecret = "secret"
+
+	cfg.TLSCert = "cert.pem"
+	assert.EqualError(t, cfg.Validate(), "tls_cert and tls_key must be set together")
+
+	cfg.TLSKey = "key.pem"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TLSSelfSigned = true
+	assert.EqualError(t, cfg.Validate(), "tls_self_signed excludes tls_cert and tls_key")
+
+	cfg.TLSCert, cfg.TLSKey = "", ""
+	cfg.WriteTimeout = -time.Second
+	assert.EqualError(t, cfg.Validate(), "write_timeout must not be negative, not -1s")
+}
@@ -0,0 +1,282 @@
+package gql_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"pianpianino/gql"
+	"pianpianino/models"
+	"pianpianino/repository"
+	"pianpianino/service"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+// selectCounter counts the SELECT queries, to check that the loaders batch.
+type selectCounter struct {
+	selects atomic.Int32
+}
+
+func (c *selectCounter) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if strings.HasPrefix(event.Query, "SELECT") {
+		c.selects.Add(1)
+	}
+	return ctx
+}
+
+func (c *selectCounter) AfterQuery(context.Context, *bun.QueryEvent) {}
+
+func setUpTestDB(t *testing.T) (*bun.DB, *selectCounter) {
+	ctx := context.Background()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	DB := bun.NewDB(sqlDB, sqlitedialect.New())
+	for _, model := range []interface{}{(*models.User)(nil), (*models.Task)(nil), (*models.TaskChange)(nil)} {
+		if _, err := DB.NewCreateTable().Model(model).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	counter := &selectCounter{}
+	DB.AddQueryHook(counter)
+	return DB, counter
+}
+
+func newSchema(DB *bun.DB) *gql.Schema {
+	return gql.NewSchema(
+		service.NewTaskService(repository.NewBunTasks(DB)),
+		service.NewUserService(repository.NewBunUsers(DB), "test-secret"),
+	)
+}
+
+func createUser(t *testing.T, DB *bun.DB, username string) int64 {
+	user := &models.User{Username: username, Password: "hashed"}
+	if _, err := DB.NewInsert().Model(user).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+type gqlError struct {
+	Message    string                 `json:"message"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+func exec(t *testing.T, schema *gql.Schema, userID int64, query string, variables map[string]interface{}, data interface{}) []gqlError {
+	response := schema.Exec(context.Background(), userID, echo.New().Logger, gql.Params{Query: query, Variables: variables})
+	if data != nil && len(response.Data) > 0 {
+		assert.NoError(t, json.Unmarshal(response.Data, data))
+	}
+	encoded, err := json.Marshal(response.Errors)
+	assert.NoError(t, err)
+	var errs []gqlError
+	assert.NoError(t, json.Unmarshal(encoded, &errs))
+	return errs
+}
+
+type task struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Priority    string `json:"priority"`
+	Completed   bool   `json:"completed"`
+	Version     int    `json:"version"`
+	User        struct {
+		Username string `json:"username"`
+	} `json:"user"`
+}
+
+func TestMutationsAndQueries(t *testing.T) {
+	DB, _ := setUpTestDB(t)
+	schema := newSchema(DB)
+	userID := createUser(t, DB, "ada")
+
+	var created struct {
+		CreateTask task `json:"createTask"`
+	}
+	errs := exec(t, schema, userID, `mutation {
+		createTask(input: {description: "Write docs", priority: HIGH}) { id description priority version }
+	}`, nil, &created)
+	assert.Empty(t, errs)
+	assert.Equal(t, "HIGH", created.CreateTask.Priority)
+	assert.Equal(t, 1, created.CreateTask.Version)
+
+	var toggled struct {
+		ToggleTask task `json:"toggleTask"`
+	}
+	errs = exec(t, schema, userID, `mutation($id: ID!) { toggleTask(id: $id, version: 1) { completed version } }`,
+		map[string]interface{}{"id": created.CreateTask.ID}, &toggled)
+	assert.Empty(t, errs)
+	assert.True(t, toggled.ToggleTask.Completed)
+	assert.Equal(t, 2, toggled.ToggleTask.Version)
+
+	exec(t, schema, userID, `mutation { createTask(input: {description: "Open task"}) { id } }`, nil, nil)
+
+	var queried struct {
+		Me struct {
+			Username string `json:"username"`
+			Tasks    []task `json:"tasks"`
+		} `json:"me"`
+		Stats struct {
+			Total     int `json:"total"`
+			Completed int `json:"completed"`
+			Open      int `json:"open"`
+		} `json:"stats"`
+	}
+	errs = exec(t, schema, userID, `{
+		me { username tasks(completed: false) { description priority user { username } } }
+		stats { total completed open }
+	}`, nil, &queried)
+	assert.Empty(t, errs)
+	assert.Equal(t, "ada", queried.Me.Username)
+	if assert.Len(t, queried.Me.Tasks, 1) {
+		assert.Equal(t, "Open task", queried.Me.Tasks[0].Description)
+		assert.Equal(t, "NOTSET", queried.Me.Tasks[0].Priority)
+		assert.Equal(t, "ada", queried.Me.Tasks[0].User.Username)
+	}
+	assert.Equal(t, 2, queried.Stats.Total)
+	assert.Equal(t, 1, queried.Stats.Completed)
+	assert.Equal(t, 1, queried.Stats.Open)
+
+	var deleted struct {
+		DeleteTask string `json:"deleteTask"`
+	}
+	errs = exec(t, schema, userID, `mutation($id: ID!) { deleteTask(id: $id) }`,
+		map[string]interface{}{"id": created.CreateTask.ID}, &deleted)
+	assert.Empty(t, errs)
+	assert.Equal(t, created.CreateTask.ID, deleted.DeleteTask)
+
+	// mutations are recorded for the sync clients
+	var changes []models.TaskChange
+	assert.NoError(t, DB.NewSelect().Model(&changes).Order("id ASC").Scan(context.Background()))
+	if assert.Len(t, changes, 2) {
+		assert.True(t, changes[1].Deleted)
+	}
+}
+
+func TestMutationErrors(t *testing.T) {
+	DB, _ := setUpTestDB(t)
+	schema := newSchema(DB)
+	userID := createUser(t, DB, "ada")
+	otherID := createUser(t, DB, "bob")
+
+	errs := exec(t, schema, userID, `mutation { createTask(input: {description: ""}) { id } }`, nil, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "validation_failed", errs[0].Extensions["code"])
+	}
+
+	var created struct {
+		CreateTask task `json:"createTask"`
+	}
+	exec(t, schema, userID, `mutation { createTask(input: {description: "Task"}) { id } }`, nil, &created)
+	variables := map[string]interface{}{"id": created.CreateTask.ID}
+
+	errs = exec(t, schema, userID, `mutation($id: ID!) { updateTask(id: $id, input: {description: "Edited"}, version: 3) { id } }`, variables, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "task_modified", errs[0].Extensions["code"])
+	}
+
+	// the tasks of another user do not exist for this one
+	errs = exec(t, schema, otherID, `mutation($id: ID!) { toggleTask(id: $id) { id } }`, variables, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "task_not_found", errs[0].Extensions["code"])
+	}
+	var queried struct {
+		Task *task `json:"task"`
+	}
+	errs = exec(t, schema, otherID, `query($id: ID!) { task(id: $id) { id } }`, variables, &queried)
+	assert.Empty(t, errs)
+	assert.Nil(t, queried.Task)
+
+	errs = exec(t, schema, userID, `{ task(id: "abc") { id } }`, nil, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "invalid_id", errs[0].Extensions["code"])
+	}
+}
+
+func TestLoadersBatchQueries(t *testing.T) {
+	DB, counter := setUpTestDB(t)
+	schema := newSchema(DB)
+	userID := createUser(t, DB, "ada")
+	for i := 0; i < 5; i++ {
+		exec(t, schema, userID, `mutation { createTask(input: {description: "Task"}) { id } }`, nil, nil)
+	}
+
+	counter.selects.Store(0)
+	var queried struct {
+		Tasks []task `json:"tasks"`
+	}
+	errs := exec(t, schema, userID, `{
+		tasks { id user { username tasks { id } stats { total } } }
+		stats { total }
+	}`, nil, &queried)
+	assert.Empty(t, errs)
+	assert.Len(t, queried.Tasks, 5)
+	// one query for the tasks and one for their users, whatever the number of tasks
+	assert.Equal(t, int32(2), counter.selects.Load())
+}
+
+func TestProjects(t *testing.T) {
+	DB, _ := setUpTestDB(t)
+	schema := newSchema(DB)
+	userID := createUser(t, DB, "ada")
+	otherID := createUser(t, DB, "bob")
+	for _, created := range []*models.Task{
+		{UserID: userID, Description: "Paint +home", Projects: []string{"home"}, Contexts: []string{"weekend"}},
+		{UserID: userID, Description: "Call +home +work", Projects: []string{"home", "work"}, Completed: true},
+		{UserID: userID, Description: "No project"},
+		{UserID: otherID, Description: "Not mine +garden", Projects: []string{"garden"}},
+	} {
+		_, err := DB.NewInsert().Model(created).Exec(context.Background())
+		assert.NoError(t, err)
+	}
+
+	var queried struct {
+		Projects []struct {
+			Name  string `json:"name"`
+			Tasks []struct {
+				Description string   `json:"description"`
+				Projects    []string `json:"projects"`
+				Contexts    []string `json:"contexts"`
+			} `json:"tasks"`
+			Stats struct {
+				Total int `json:"total"`
+			} `json:"stats"`
+		} `json:"projects"`
+	}
+	errs := exec(t, schema, userID, `{
+		projects { name tasks(completed: false) { description projects contexts } stats { total } }
+	}`, nil, &queried)
+	assert.Empty(t, errs)
+	if assert.Len(t, queried.Projects, 2) {
+		home := queried.Projects[0]
+		assert.Equal(t, "home", home.Name)
+		assert.Equal(t, 2, home.Stats.Total)
+		if assert.Len(t, home.Tasks, 1) {
+			assert.Equal(t, []string{"home"}, home.Tasks[0].Projects)
+			assert.Equal(t, []string{"weekend"}, home.Tasks[0].Contexts)
+		}
+		assert.Equal(t, "work", queried.Projects[1].Name)
+		assert.Empty(t, queried.Projects[1].Tasks)
+	}
+}
+
+func TestQueryDepthIsLimited(t *testing.T) {
+	DB, _ := setUpTestDB(t)
+	schema := newSchema(DB)
+	userID := createUser(t, DB, "ada")
+
+	query := "{ me { " + strings.Repeat("tasks { user { ", 5) + "username" + strings.Repeat(" } }", 5) + " } }"
+	errs := exec(t, schema, userID, query, nil, nil)
+	assert.NotEmpty(t, errs)
+}
@@ -2,54 +2,24 @@ package handlers_test
 
 import (
 	"bytes"
-	"context"
-	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"pianpianino/handlers"
 	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/service"
+	"pianpianino/tests/testdb"
 	"strings"
 	"testing"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/uptrace/bun"
-	"github.com/uptrace/bun/dialect/sqlitedialect"
-	"github.com/uptrace/bun/driver/sqliteshim"
 )
 
 func setUpTestDB(t *testing.T) *bun.DB {
-	// in memory db for testing
-	ctx := context.Background()
-	sqlDB, err := sql.Open(sqliteshim.ShimName, ":memory:")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	DB := bun.NewDB(sqlDB, sqlitedialect.New())
-
-	// migrate user table
-	_, err = DB.NewCreateTable().
-		Model((*models.User)(nil)).
-		IfNotExists().
-		Exec(ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	t.Cleanup(func() {
-		// Truncate the table after test runs
-		_, err := DB.NewTruncateTable().
-			Model((*models.User)(nil)).
-			Exec(ctx)
-		if err != nil {
-			t.Fatal(err)
-		}
-		_ = sqlDB.Close()
-	})
-
-	return DB
+	return testdb.Open(t, (*models.User)(nil))
 }
 
 func TestRegisterSuccess(t *testing.T) {
@@ -57,7 +27,7 @@ func TestRegisterSuccess(t *testing.T) {
 	handler := &handlers.AuthHandler{DB: DB}
 	e := echo.New()
 
-	reqBody := &handlers.UserRequest{
+	reqBody := &service.Credentials{
 		Username: "correctUser",
 		Password: "correctPassword",
 	}
@@ -95,7 +65,7 @@ func TestRegisterMissingFieldsUsername(t *testing.T) {
 	handler := &handlers.AuthHandler{DB: DB}
 	e := echo.New()
 
-	reqBody := &handlers.UserRequest{
+	reqBody := &service.Credentials{
 		Username: "",
 		Password: "testPassword",
 	}
@@ -116,7 +86,7 @@ func TestRegisterMissingFieldsPassword(t *testing.T) {
 	handler := &handlers.AuthHandler{DB: DB}
 	e := echo.New()
 
-	reqBody := &handlers.UserRequest{
+	reqBody := &service.Credentials{
 		Username: "testUsername",
 		Password: "",
 	}
@@ -140,7 +110,7 @@ func TestLoginSuccess(t *testing.T) {
 	}
 	e := echo.New()
 
-	registerBody := &handlers.UserRequest{
+	registerBody := &service.Credentials{
 		Username: "integrationUser",
 		Password: "integrationPass",
 	}
@@ -155,7 +125,7 @@ func TestLoginSuccess(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusCreated, rec.Code)
 
-	loginBody := &handlers.UserRequest{
+	loginBody := &service.Credentials{
 		Username: "integrationUser",
 		Password: "integrationPass",
 	}
@@ -188,7 +158,7 @@ func TestLoginWrongPassword(t *testing.T) {
 		httptest.NewRecorder(),
 	))
 
-	loginBody := &handlers.UserRequest{
+	loginBody := &service.Credentials{
 		Username: "foo",
 		Password: "wrongpass",
 	}
@@ -209,7 +179,7 @@ func TestLoginNonExistentUser(t *testing.T) {
 	handler := &handlers.AuthHandler{DB: DB, JWTSecret: "test"}
 	e := echo.New()
 
-	loginBody := &handlers.UserRequest{
+	loginBody := &service.Credentials{
 		Username: "ghost",
 		Password: "password",
 	}
@@ -239,3 +209,68 @@ func TestLoginInvalidJSON(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
+
+func TestRegisterDuplicateUsername(t *testing.T) {
+	DB := setUpTestDB(t)
+	handler := &handlers.AuthHandler{DB: DB}
+	e := echo.New()
+
+	jsonBody, _ := json.Marshal(&service.Credentials{Username: "sameUser", Password: "password"})
+	for _, status := range []int{http.StatusCreated, http.StatusConflict} {
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(jsonBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+
+		err := handler.Register(e.NewContext(req, rec))
+		assert.NoError(t, err)
+		assert.Equal(t, status, rec.Code)
+		if status == http.StatusConflict {
+			var p problem.Problem
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+			assert.Equal(t, problem.CodeUsernameTaken, p.Code)
+		}
+	}
+}
+
+func TestRegisterMissingFieldsProblem(t *testing.T) {
+	DB := setUpTestDB(t)
+	handler := &handlers.AuthHandler{DB: DB}
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	err := handler.Register(e.NewContext(req, rec))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, problem.MIMEProblemJSON, rec.Header().Get(echo.HeaderContentType))
+
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeValidation, p.Code)
+	// both missing fields are reported at once
+	if assert.Len(t, p.Errors, 2) {
+		assert.Equal(t, "username", p.Errors[0].Field)
+		assert.Equal(t, "password", p.Errors[1].Field)
+	}
+}
+
+func TestLoginInvalidCredentialsCode(t *testing.T) {
+	DB := setUpTestDB(t)
+	handler := &handlers.AuthHandler{DB: DB, JWTSecret: "secret"}
+	e := echo.New()
+
+	jsonBody, _ := json.Marshal(&service.Credentials{Username: "nobody", Password: "password"})
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(jsonBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	err := handler.Login(e.NewContext(req, rec))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeInvalidCredentials, p.Code)
+}
@@ -0,0 +1,254 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/backup"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+func exportBackup(t *testing.T, handler *handlers.BackupHandler, userID int) string {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/export", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	setTestUser(t, ctx, userID)
+
+	err := handler.Export(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func importBackup(t *testing.T, handler *handlers.BackupHandler, userID int, mode, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/import?mode="+mode, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	setTestUser(t, ctx, userID)
+
+	err := handler.Import(ctx)
+	assert.NoError(t, err)
+	return rec
+}
+
+func createSecondTestUser(t *testing.T, DB *bun.DB) int {
+	user := &models.User{Username: "testuser2", Password: "hashedpassword2"}
+	_, err := DB.NewInsert().Model(user).Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(user.ID)
+}
+
+func TestBackupExport(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.BackupHandler{DB: DB}
+
+	userID := createTestUser(t, DB)
+	createTestTask(t, DB, userID, "Task 1", models.Low)
+	createTestTask(t, DB, userID, "Task 2", models.High)
+
+	var doc backup.Document
+	err := json.Unmarshal([]byte(exportBackup(t, handler, userID)), &doc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, backup.Version, doc.Version)
+	assert.Equal(t, "testuser", doc.User.Username)
+	assert.Len(t, doc.Tasks, 2)
+	assert.Equal(t, "Task 2", doc.Tasks[1].Description)
+	assert.Equal(t, models.High, doc.Tasks[1].Priority)
+}
+
+func TestBackupImportReplaceRemapsIDs(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.BackupHandler{DB: DB}
+
+	userID := createTestUser(t, DB)
+	first := createTestTask(t, DB, userID, "Task 1", models.Low)
+	_, err := DB.NewUpdate().Model(first).
+		Set("dav_name = ?", "first").
+		Set("todotxt_undated = ?", true).
+		WherePK().
+		Exec(context.Background())
+	assert.NoError(t, err)
+	createTestTask(t, DB, userID, "Task 2", models.High)
+	exported := exportBackup(t, handler, userID)
+
+	otherID := createSecondTestUser(t, DB)
+	createTestTask(t, DB, otherID, "Replaced task", models.Medium)
+
+	rec := importBackup(t, handler, otherID, backup.ModeReplace, exported)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Result backup.Result `json:"result"`
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, response.Result.Imported)
+	assert.Equal(t, 1, response.Result.Deleted)
+
+	var tasks []models.Task
+	err = DB.NewSelect().Model(&tasks).Where("user_id = ?", otherID).Order("id ASC").Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "Task 1", tasks[0].Description)
+	assert.Equal(t, "first", tasks[0].DAVName)
+	assert.True(t, tasks[0].TodoTxtUndated)
+	assert.False(t, tasks[1].TodoTxtUndated)
+	assert.Equal(t, tasks[0].ID, response.Result.IDs[first.ID])
+	assert.NotEqual(t, first.ID, tasks[0].ID)
+}
+
+func TestBackupImportMergeAddsNoDuplicates(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.BackupHandler{DB: DB}
+
+	userID := createTestUser(t, DB)
+	synced := createTestTask(t, DB, userID, "Synced task", models.Low)
+	_, err := DB.NewUpdate().Model(synced).Set("uid = ?", "phone-1").WherePK().Exec(context.Background())
+	assert.NoError(t, err)
+	// created through the REST API, without UID
+	local := createTestTask(t, DB, userID, "Local task", models.Low)
+
+	rec := importBackup(t, handler, userID, backup.ModeMerge, exportBackup(t, handler, userID))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Result backup.Result `json:"result"`
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, response.Result.Imported)
+	assert.Equal(t, 2, response.Result.Skipped)
+	assert.Equal(t, map[int64]int64{synced.ID: synced.ID, local.ID: local.ID}, response.Result.IDs)
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Where("user_id = ?", userID).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestBackupImportMergeIntoAnotherAccount(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.BackupHandler{DB: DB}
+
+	userID := createTestUser(t, DB)
+	createTestTask(t, DB, userID, "Task 1", models.Low)
+	exported := exportBackup(t, handler, userID)
+
+	otherID := createSecondTestUser(t, DB)
+	rec := importBackup(t, handler, otherID, backup.ModeMerge, exported)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// the copies keep the UID of the backup, a second merge skips them
+	rec = importBackup(t, handler, otherID, backup.ModeMerge, exported)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Where("user_id = ?", otherID).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestBackupImportUnsupportedVersion(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.BackupHandler{DB: DB}
+
+	userID := createTestUser(t, DB)
+	createTestTask(t, DB, userID, "Kept task", models.Low)
+
+	rec := importBackup(t, handler, userID, backup.ModeReplace, `{"version": 99, "tasks": []}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, problem.MIMEProblemJSON, rec.Header().Get(echo.HeaderContentType))
+
+	var response problem.Problem
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Equal(t, "version", response.Errors[0].Field)
+	}
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestBackupImportInvalidMode(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.BackupHandler{DB: DB}
+	userID := createTestUser(t, DB)
+
+	rec := importBackup(t, handler, userID, "overwrite", `{"version": 1, "tasks": []}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var response problem.Problem
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, problem.CodeValidation, response.Code)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Equal(t, "mode", response.Errors[0].Field)
+	}
+}
+
+func TestBackupImportInvalidTasks(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.BackupHandler{DB: DB}
+	userID := createTestUser(t, DB)
+
+	body := `{"version": 1, "tasks": [
+		{"description": "Fine", "priority": "low"},
+		{"description": "Backwards", "created_at": "2024-05-02T00:00:00Z", "updated_at": "2024-05-01T00:00:00Z"}
+	]}`
+	rec := importBackup(t, handler, userID, backup.ModeMerge, body)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var response problem.Problem
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, problem.CodeValidation, response.Code)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Equal(t, "tasks[1].updated_at", response.Errors[0].Field)
+		assert.Equal(t, problem.FieldOutOfOrder, response.Errors[0].Code)
+	}
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestBackupImportInvalidDescriptions(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.BackupHandler{DB: DB}
+	userID := createTestUser(t, DB)
+
+	body := `{"version": 1, "tasks": [
+		{"description": ""},
+		{"description": "` + strings.Repeat("a", models.MaxDescription+1) + `"}
+	]}`
+	rec := importBackup(t, handler, userID, backup.ModeMerge, body)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var response problem.Problem
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	if assert.Len(t, response.Errors, 2) {
+		assert.Equal(t, "tasks[0].description", response.Errors[0].Field)
+		assert.Equal(t, problem.FieldRequired, response.Errors[0].Code)
+		assert.Equal(t, "tasks[1].description", response.Errors[1].Field)
+		assert.Equal(t, problem.FieldTooLong, response.Errors[1].Code)
+	}
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,207 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func runBatch(t *testing.T, handler *handlers.TaskHandler, userID int, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks/batch", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	setTestUser(t, ctx, userID)
+
+	err := handler.Batch(ctx)
+	assert.NoError(t, err)
+	return rec
+}
+
+func TestBatchAtomicSuccess(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+
+	userID := createTestUser(t, DB)
+	toggled := createTestTask(t, DB, userID, "Toggled", models.Low)
+	changed := createTestTask(t, DB, userID, "Changed", models.Low)
+	deleted := createTestTask(t, DB, userID, "Deleted", models.Low)
+
+	body := `{"operations": [
+		{"op": "create", "description": "Created", "priority": "high"},
+		{"op": "toggle", "id": ` + itoa(toggled.ID) + `},
+		{"op": "move", "id": ` + itoa(changed.ID) + `, "priority": "high"},
+		{"op": "update", "id": ` + itoa(changed.ID) + `, "description": "Renamed"},
+		{"op": "complete", "id": ` + itoa(changed.ID) + `},
+		{"op": "delete", "id": ` + itoa(deleted.ID) + `}
+	]}`
+	rec := runBatch(t, handler, userID, body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response handlers.BatchResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, handlers.BatchAtomic, response.Mode)
+	assert.Equal(t, 6, response.Succeeded)
+	assert.Equal(t, 0, response.Failed)
+	if assert.Len(t, response.Results, 6) {
+		assert.Equal(t, http.StatusCreated, response.Results[0].Status)
+		assert.Equal(t, "Created", response.Results[0].Task.Description)
+		assert.True(t, response.Results[1].Task.Completed)
+	}
+
+	var tasks []models.Task
+	err = DB.NewSelect().Model(&tasks).Order("id ASC").Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 3)
+	assert.True(t, tasks[0].Completed)
+	assert.Equal(t, "Renamed", tasks[1].Description)
+	assert.Equal(t, models.High, tasks[1].Priority)
+	assert.True(t, tasks[1].Completed)
+	assert.Equal(t, "Created", tasks[2].Description)
+}
+
+func TestBatchAtomicRollsBack(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Kept", models.Low)
+
+	body := `{"mode": "atomic", "operations": [
+		{"op": "delete", "id": ` + itoa(task.ID) + `},
+		{"op": "toggle", "id": 999}
+	]}`
+	rec := runBatch(t, handler, userID, body)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	var response problem.Problem
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, problem.CodeBatchFailed, response.Code)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Equal(t, "operations[1]", response.Errors[0].Field)
+		assert.Equal(t, string(problem.CodeTaskNotFound), response.Errors[0].Code)
+	}
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestBatchBestEffortReportsFailures(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+
+	userID := createTestUser(t, DB)
+	otherID := createSecondTestUser(t, DB)
+	own := createTestTask(t, DB, userID, "Own", models.Low)
+	other := createTestTask(t, DB, otherID, "Not mine", models.Low)
+
+	body := `{"mode": "best_effort", "operations": [
+		{"op": "delete", "id": ` + itoa(other.ID) + `},
+		{"op": "complete", "id": ` + itoa(own.ID) + `}
+	]}`
+	rec := runBatch(t, handler, userID, body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response handlers.BatchResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, response.Succeeded)
+	assert.Equal(t, 1, response.Failed)
+	if assert.Len(t, response.Results, 2) {
+		assert.Equal(t, http.StatusNotFound, response.Results[0].Status)
+		if assert.NotNil(t, response.Results[0].Error) {
+			assert.Equal(t, problem.CodeTaskNotFound, response.Results[0].Error.Code)
+		}
+		assert.Equal(t, http.StatusOK, response.Results[1].Status)
+	}
+
+	var tasks []models.Task
+	err = DB.NewSelect().Model(&tasks).Order("id ASC").Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.True(t, tasks[0].Completed)
+}
+
+func TestBatchMoveChangesOnlyThePriority(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+
+	userID := createTestUser(t, DB)
+	moved := createTestTask(t, DB, userID, "Moved", models.Low)
+	prioritized := createTestTask(t, DB, userID, "Prioritized", models.Low)
+
+	body := `{"mode": "best_effort", "operations": [
+		{"op": "move", "id": ` + itoa(moved.ID) + `, "priority": "high", "description": "Ignored"},
+		{"op": "prioritize", "id": ` + itoa(prioritized.ID) + `, "priority": "medium", "description": "Ignored"}
+	]}`
+	rec := runBatch(t, handler, userID, body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response handlers.BatchResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, response.Succeeded)
+
+	var tasks []models.Task
+	err = DB.NewSelect().Model(&tasks).Order("id ASC").Scan(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, tasks, 2) {
+		assert.Equal(t, "Moved", tasks[0].Description)
+		assert.Equal(t, models.High, tasks[0].Priority)
+		assert.Equal(t, "Prioritized", tasks[1].Description)
+		assert.Equal(t, models.Medium, tasks[1].Priority)
+	}
+}
+
+func TestBatchValidation(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	userID := createTestUser(t, DB)
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{"no operations", `{"operations": []}`, "operations"},
+		{"unknown mode", `{"mode": "some", "operations": [{"op": "toggle", "id": 1}]}`, "mode"},
+		{"unknown operation", `{"operations": [{"op": "archive", "id": 1}]}`, "operations[0].op"},
+		{"create without description", `{"operations": [{"op": "create"}]}`, "operations[0].description"},
+		{"toggle without id", `{"operations": [{"op": "toggle"}]}`, "operations[0].id"},
+		{"move without priority", `{"operations": [{"op": "move", "id": 1}]}`, "operations[0].priority"},
+		{"prioritize without priority", `{"operations": [{"op": "prioritize", "id": 1}]}`, "operations[0].priority"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := runBatch(t, handler, userID, tt.body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+			var response problem.Problem
+			err := json.Unmarshal(rec.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, problem.CodeValidation, response.Code)
+			if assert.Len(t, response.Errors, 1) {
+				assert.Equal(t, tt.field, response.Errors[0].Field)
+			}
+		})
+	}
+}
+
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,223 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+const testTodo = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VTODO\r\n" +
+	"UID:7B2D1C1E-phone\r\n" +
+	"SUMMARY:Pick up the bike\r\n" +
+	"PRIORITY:1\r\n" +
+	"STATUS:NEEDS-ACTION\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"SUMMARY:Alarm summary must be ignored\r\n" +
+	"END:VALARM\r\n" +
+	"END:VTODO\r\n" +
+	"END:VCALENDAR\r\n"
+
+func registerCalDAVUser(t *testing.T, DB *bun.DB) {
+	auth := &handlers.AuthHandler{DB: DB}
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"username":"phone","password":"secret"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, auth.Register(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+// newCalDAVContext builds an authenticated context, the way the Basic auth
+// middleware does before reaching the handlers.
+func newCalDAVContext(t *testing.T, handler *handlers.CalDAVHandler, method, name, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(method, handlers.CalDAVCollection+name, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	if name != "" {
+		ctx.SetParamNames("name")
+		ctx.SetParamValues(name)
+	}
+
+	ok, err := handler.Authenticate("phone", "secret", ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	return ctx, rec
+}
+
+func TestCalDAVAuthenticateWrongPassword(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewCalDAVHandler(DB)
+	registerCalDAVUser(t, DB)
+
+	ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/caldav/", nil), httptest.NewRecorder())
+	ok, err := handler.Authenticate("phone", "wrong", ctx)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCalDAVPutCreatesAndUpdatesTask(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewCalDAVHandler(DB)
+	registerCalDAVUser(t, DB)
+
+	ctx, rec := newCalDAVContext(t, handler, http.MethodPut, "7B2D1C1E-phone.ics", testTodo)
+	ctx.Request().Header.Set("If-None-Match", "*")
+	assert.NoError(t, handler.PutResource(ctx))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	created := rec.Header().Get("ETag")
+	assert.NotEmpty(t, created)
+
+	task := new(models.Task)
+	err := DB.NewSelect().Model(task).Where("uid = ?", "7B2D1C1E-phone").Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Pick up the bike", task.Description)
+	assert.Equal(t, models.High, task.Priority)
+	assert.False(t, task.Completed)
+
+	ctx, rec = newCalDAVContext(t, handler, http.MethodGet, "7B2D1C1E-phone.ics", "")
+	assert.NoError(t, handler.GetResource(ctx))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, created, rec.Header().Get("ETag"))
+	assert.Contains(t, rec.Body.String(), "UID:7B2D1C1E-phone\r\n")
+
+	completed := strings.Replace(testTodo, "STATUS:NEEDS-ACTION", "STATUS:COMPLETED", 1)
+	ctx, rec = newCalDAVContext(t, handler, http.MethodPut, "7B2D1C1E-phone.ics", completed)
+	ctx.Request().Header.Set("If-Match", created)
+	assert.NoError(t, handler.PutResource(ctx))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.NotEqual(t, created, rec.Header().Get("ETag"))
+
+	err = DB.NewSelect().Model(task).WherePK().Scan(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, task.Completed)
+
+	// the first device still holds the old ETag and must not overwrite the change
+	ctx, rec = newCalDAVContext(t, handler, http.MethodPut, "7B2D1C1E-phone.ics", testTodo)
+	ctx.Request().Header.Set("If-Match", created)
+	assert.NoError(t, handler.PutResource(ctx))
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+}
+
+func TestCalDAVReportListsTasksCreatedThroughAPI(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewCalDAVHandler(DB)
+	registerCalDAVUser(t, DB)
+
+	user := new(models.User)
+	assert.NoError(t, DB.NewSelect().Model(user).Where("username = ?", "phone").Scan(context.Background()))
+	task := createTestTask(t, DB, int(user.ID), "Task from the web", models.Low)
+	href := handlers.CalDAVCollection + "task-" + strconv.Itoa(int(task.ID)) + "@pianpianino.ics"
+
+	query := `<?xml version="1.0"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"/></c:comp-filter></c:filter>
+</c:calendar-query>`
+	ctx, rec := newCalDAVContext(t, handler, "REPORT", "", query)
+	assert.NoError(t, handler.Report(ctx))
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<d:href>"+href+"</d:href>")
+	assert.Contains(t, rec.Body.String(), "SUMMARY:Task from the web")
+
+	events := strings.Replace(query, `name="VTODO"`, `name="VEVENT"`, 1)
+	ctx, rec = newCalDAVContext(t, handler, "REPORT", "", events)
+	assert.NoError(t, handler.Report(ctx))
+	assert.NotContains(t, rec.Body.String(), "<d:response>")
+
+	multiget := `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <d:href>` + href + `</d:href>
+  <d:href>` + handlers.CalDAVCollection + `missing.ics</d:href>
+</c:calendar-multiget>`
+	ctx, rec = newCalDAVContext(t, handler, "REPORT", "", multiget)
+	assert.NoError(t, handler.Report(ctx))
+	assert.Contains(t, rec.Body.String(), "<d:getetag>")
+	assert.NotContains(t, rec.Body.String(), "SUMMARY:")
+	assert.Contains(t, rec.Body.String(), "HTTP/1.1 404 Not Found")
+}
+
+func TestCalDAVDeleteTask(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewCalDAVHandler(DB)
+	registerCalDAVUser(t, DB)
+
+	ctx, rec := newCalDAVContext(t, handler, http.MethodPut, "7B2D1C1E-phone.ics", testTodo)
+	assert.NoError(t, handler.PutResource(ctx))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	ctx, rec = newCalDAVContext(t, handler, http.MethodDelete, "7B2D1C1E-phone.ics", "")
+	assert.NoError(t, handler.DeleteResource(ctx))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	ctx, rec = newCalDAVContext(t, handler, http.MethodGet, "7B2D1C1E-phone.ics", "")
+	assert.NoError(t, handler.GetResource(ctx))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCalDAVResourceNamedOtherThanUID(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewCalDAVHandler(DB)
+	registerCalDAVUser(t, DB)
+
+	ctx, rec := newCalDAVContext(t, handler, http.MethodPut, "foo.ics", testTodo)
+	assert.NoError(t, handler.PutResource(ctx))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	ctx, rec = newCalDAVContext(t, handler, http.MethodGet, "foo.ics", "")
+	assert.NoError(t, handler.GetResource(ctx))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "UID:7B2D1C1E-phone\r\n")
+
+	ctx, rec = newCalDAVContext(t, handler, "PROPFIND", "foo.ics", "")
+	assert.NoError(t, handler.PropfindResource(ctx))
+	assert.Contains(t, rec.Body.String(), "<d:href>"+handlers.CalDAVCollection+"foo.ics</d:href>")
+
+	// a second PUT replaces the task
+	completed := strings.Replace(testTodo, "STATUS:NEEDS-ACTION", "STATUS:COMPLETED", 1)
+	ctx, rec = newCalDAVContext(t, handler, http.MethodPut, "foo.ics", completed)
+	assert.NoError(t, handler.PutResource(ctx))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	// the UID is not a name of the resource, and cannot name another one
+	ctx, rec = newCalDAVContext(t, handler, http.MethodGet, "7B2D1C1E-phone.ics", "")
+	assert.NoError(t, handler.GetResource(ctx))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	ctx, rec = newCalDAVContext(t, handler, http.MethodPut, "7B2D1C1E-phone.ics", testTodo)
+	assert.NoError(t, handler.PutResource(ctx))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	ctx, rec = newCalDAVContext(t, handler, http.MethodDelete, "foo.ics", "")
+	assert.NoError(t, handler.DeleteResource(ctx))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestCalDAVPutDatabaseFailure(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewCalDAVHandler(DB)
+	registerCalDAVUser(t, DB)
+
+	ctx, rec := newCalDAVContext(t, handler, http.MethodPut, "7B2D1C1E-phone.ics", testTodo)
+	DB.Close()
+	assert.NoError(t, handler.PutResource(ctx))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
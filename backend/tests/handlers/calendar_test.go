@@ -0,0 +1,117 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func getFeedToken(t *testing.T, handler *handlers.CalendarHandler, userID int) string {
+	token, err := createTestJWTToken(userID)
+	assert.NoError(t, err)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/calendar", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	jwtToken, _ := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testJWTSecret), nil
+	})
+	ctx.Set("user", jwtToken)
+
+	err = handler.GetFeedURL(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response map[string]string
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	_, feedToken, found := strings.Cut(response["url"], "/calendar/")
+	assert.True(t, found)
+	return feedToken
+}
+
+func TestCalendarFeedSuccess(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.CalendarHandler{DB: DB, JWTSecret: testJWTSecret}
+	e := echo.New()
+
+	userID := createTestUser(t, DB)
+	createTestTask(t, DB, userID, "Write the report", models.High)
+	createTestTask(t, DB, userID, "Buy milk", models.NotSet)
+
+	feedToken := getFeedToken(t, handler, userID)
+	assert.True(t, strings.HasSuffix(feedToken, ".ics"))
+
+	req := httptest.NewRequest(http.MethodGet, "/calendar/"+feedToken, nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("token")
+	ctx.SetParamValues(feedToken)
+
+	err := handler.Feed(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), "text/calendar")
+
+	body := rec.Body.String()
+	assert.Equal(t, 2, strings.Count(body, "BEGIN:VTODO"))
+	assert.Contains(t, body, "SUMMARY:Write the report\r\n")
+	assert.Contains(t, body, "PRIORITY:1\r\n")
+	assert.Equal(t, 2, strings.Count(body, "STATUS:NEEDS-ACTION"))
+}
+
+func TestCalendarFeedOnlyContainsOwnTasks(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.CalendarHandler{DB: DB, JWTSecret: testJWTSecret}
+	e := echo.New()
+
+	userID := createTestUser(t, DB)
+	createTestTask(t, DB, userID, "Someone else's task", models.Low)
+
+	feedToken := getFeedToken(t, handler, userID+1)
+
+	req := httptest.NewRequest(http.MethodGet, "/calendar/"+feedToken, nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("token")
+	ctx.SetParamValues(feedToken)
+
+	err := handler.Feed(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "BEGIN:VTODO")
+}
+
+func TestCalendarFeedInvalidToken(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.CalendarHandler{DB: DB, JWTSecret: testJWTSecret}
+	e := echo.New()
+
+	userID := createTestUser(t, DB)
+	feedToken := getFeedToken(t, handler, userID)
+
+	// a token for another user cannot be forged by changing the user ID
+	_, signature, _ := strings.Cut(feedToken, ".")
+	forged := "999." + signature
+
+	req := httptest.NewRequest(http.MethodGet, "/calendar/"+forged, nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("token")
+	ctx.SetParamValues(forged)
+
+	err := handler.Feed(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+// conditional calls a task handler with the given precondition header and
+// the :id parameter set when id is not zero.
+func conditional(t *testing.T, handler echo.HandlerFunc, userID int, method string, id int64, header, etag, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(method, "/api/v1/tasks", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if etag != "" {
+		req.Header.Set(header, etag)
+	}
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	if id != 0 {
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(strconv.FormatInt(id, 10))
+	}
+	setTestUser(t, ctx, userID)
+
+	assert.NoError(t, handler(ctx))
+	return rec
+}
+
+func reloadTask(t *testing.T, DB *bun.DB, id int64) *models.Task {
+	task := new(models.Task)
+	err := DB.NewSelect().Model(task).Where("id = ?", id).Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func TestTaskVersionStartsAtOne(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Task", models.Low)
+
+	assert.Equal(t, int64(1), reloadTask(t, DB, task.ID).Version)
+}
+
+func TestUpdateTaskIfMatch(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Task", models.Low)
+
+	rec := conditional(t, handler.UpdateTask, userID, http.MethodPatch, task.ID, "If-Match", `"1"`, `{"description": "First"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	// a second device still holding the first version
+	rec = conditional(t, handler.UpdateTask, userID, http.MethodPatch, task.ID, "If-Match", `"1"`, `{"description": "Second"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	var response problem.Problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, problem.CodeTaskModified, response.Code)
+
+	stored := reloadTask(t, DB, task.ID)
+	assert.Equal(t, "First", stored.Description)
+	assert.Equal(t, int64(2), stored.Version)
+
+	// without If-Match the last write wins, as before
+	rec = conditional(t, handler.UpdateTask, userID, http.MethodPatch, task.ID, "If-Match", "", `{"description": "Third"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+}
+
+func TestToggleAndDeleteIfMatch(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Task", models.Low)
+
+	rec := conditional(t, handler.ToggleTaskCompleted, userID, http.MethodPatch, task.ID, "If-Match", `"1", "7"`, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	rec = conditional(t, handler.ToggleTaskCompleted, userID, http.MethodPatch, task.ID, "If-Match", `W/"2"`, "")
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = conditional(t, handler.DeleteTask, userID, http.MethodDelete, task.ID, "If-Match", `"1"`, "")
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.True(t, reloadTask(t, DB, task.ID).Completed)
+
+	rec = conditional(t, handler.DeleteTask, userID, http.MethodDelete, task.ID, "If-Match", `"2"`, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// the task is gone, no ETag matches it anymore
+	rec = conditional(t, handler.DeleteTask, userID, http.MethodDelete, task.ID, "If-Match", "*", "")
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	rec = conditional(t, handler.DeleteTask, userID, http.MethodDelete, task.ID, "If-Match", "", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestGetAllTasksIfNoneMatch(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Task", models.Low)
+
+	rec := conditional(t, handler.GetAllTasks, userID, http.MethodGet, 0, "If-None-Match", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	rec = conditional(t, handler.GetAllTasks, userID, http.MethodGet, 0, "If-None-Match", "W/"+etag, "")
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	conditional(t, handler.ToggleTaskCompleted, userID, http.MethodPatch, task.ID, "If-Match", "", "")
+	rec = conditional(t, handler.GetAllTasks, userID, http.MethodGet, 0, "If-None-Match", etag, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+}
+
+func TestGetTask(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Task", models.Low)
+
+	rec := conditional(t, handler.GetTask, userID, http.MethodGet, task.ID, "If-None-Match", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+	var response struct {
+		Task models.Task `json:"task"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "Task", response.Task.Description)
+	assert.Equal(t, int64(1), response.Task.Version)
+
+	rec = conditional(t, handler.GetTask, userID, http.MethodGet, task.ID, "If-None-Match", `"1"`, "")
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	otherID := createSecondTestUser(t, DB)
+	rec = conditional(t, handler.GetTask, otherID, http.MethodGet, task.ID, "If-None-Match", "", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestBatchVersionMismatch(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Task", models.Low)
+
+	id := strconv.FormatInt(task.ID, 10)
+	rec := runBatch(t, handler, userID, `{"operations": [{"op": "complete", "id": `+id+`, "version": 1}]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int64(2), reloadTask(t, DB, task.ID).Version)
+
+	rec = runBatch(t, handler, userID, `{"operations": [{"op": "delete", "id": `+id+`, "version": 1}]}`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+}
@@ -0,0 +1,53 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/gql"
+	"pianpianino/handlers"
+	"pianpianino/repository"
+	"pianpianino/service"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphQLQuery(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.GraphQLHandler{Schema: gql.NewSchema(
+		service.NewTaskService(repository.NewBunTasks(DB)),
+		service.NewUserService(repository.NewBunUsers(DB), "test-secret"),
+	)}
+	userID := createTestUser(t, DB)
+
+	query := func(body string, authenticated bool) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/graphql", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+		if authenticated {
+			setTestUser(t, ctx, userID)
+		}
+		assert.NoError(t, handler.Query(ctx))
+		return rec
+	}
+
+	rec := query(`{"query": "mutation { createTask(input: {description: \"From GraphQL\"}) { description } }"}`, true)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response struct {
+		Data struct {
+			CreateTask struct {
+				Description string `json:"description"`
+			} `json:"createTask"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "From GraphQL", response.Data.CreateTask.Description)
+
+	assert.Equal(t, http.StatusBadRequest, query(`{"variables": {}}`, true).Code)
+	assert.Equal(t, http.StatusUnauthorized, query(`{"query": "{ me { id } }"}`, false).Code)
+}
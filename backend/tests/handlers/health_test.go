@@ -0,0 +1,73 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/tests/testdb"
+	"runtime"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func probe(t *testing.T, handle echo.HandlerFunc) (*httptest.ResponseRecorder, map[string]interface{}) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	assert.NoError(t, handle(ctx))
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return rec, body
+}
+
+func TestHealthz(t *testing.T) {
+	handler := &handlers.HealthHandler{}
+
+	rec, body := probe(t, handler.Healthz)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", body["status"])
+}
+
+func TestReadyz(t *testing.T) {
+	DB := testdb.Open(t)
+	assert.NoError(t, models.MigrateDB(context.Background(), DB))
+	handler := &handlers.HealthHandler{DB: DB}
+
+	rec, body := probe(t, handler.Readyz)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ready", body["status"])
+}
+
+func TestReadyzNotMigrated(t *testing.T) {
+	handler := &handlers.HealthHandler{DB: setUpTestDB(t)}
+
+	rec, body := probe(t, handler.Readyz)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, string(problem.CodeNotReady), body["code"])
+	assert.Contains(t, body["detail"], "tasks")
+}
+
+func TestReadyzDatabaseUnreachable(t *testing.T) {
+	DB := setUpTestDB(t)
+	DB.Close()
+	handler := &handlers.HealthHandler{DB: DB}
+
+	rec, body := probe(t, handler.Readyz)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "The database is unreachable", body["detail"])
+}
+
+func TestVersion(t *testing.T) {
+	handler := &handlers.HealthHandler{}
+
+	rec, body := probe(t, handler.Version)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, runtime.Version(), body["go_version"])
+}
@@ -0,0 +1,138 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUploadRequest(t *testing.T, target, filename, content string, fields map[string]string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		assert.NoError(t, writer.WriteField(name, value))
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	assert.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	return req
+}
+
+const testCSV = "Title,Prio\nWrite the report,high\n,low\n"
+
+func TestImportCSVDryRun(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.ImportHandler{DB: DB}
+	e := echo.New()
+	userID := createTestUser(t, DB)
+
+	req := newUploadRequest(t, "/api/import/csv", "tasks.csv", testCSV, map[string]string{
+		"mapping": `{"description": "Title", "priority": "Prio"}`,
+		"dry_run": "true",
+	})
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	setTestUser(t, ctx, userID)
+
+	err := handler.CSV(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		DryRun bool `json:"dry_run"`
+		Report struct {
+			Accepted []map[string]interface{} `json:"accepted"`
+			Rejected []map[string]interface{} `json:"rejected"`
+		} `json:"report"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.True(t, response.DryRun)
+	assert.Len(t, response.Report.Accepted, 1)
+	assert.Len(t, response.Report.Rejected, 1)
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestImportCSVCommitsAcceptedRows(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.ImportHandler{DB: DB}
+	e := echo.New()
+	userID := createTestUser(t, DB)
+
+	req := newUploadRequest(t, "/api/import/csv", "tasks.csv", testCSV, map[string]string{
+		"mapping": `{"description": "Title", "priority": "Prio"}`,
+	})
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	setTestUser(t, ctx, userID)
+
+	err := handler.CSV(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var tasks []models.Task
+	err = DB.NewSelect().Model(&tasks).Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "Write the report", tasks[0].Description)
+	assert.Equal(t, models.High, tasks[0].Priority)
+	assert.Equal(t, int64(userID), tasks[0].UserID)
+}
+
+func TestImportCSVInvalidMapping(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.ImportHandler{DB: DB}
+	e := echo.New()
+	userID := createTestUser(t, DB)
+
+	req := newUploadRequest(t, "/api/import/csv", "tasks.csv", testCSV, map[string]string{
+		"mapping": `{"description": "Name"}`,
+	})
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	setTestUser(t, ctx, userID)
+
+	err := handler.CSV(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestImportTodoistJSON(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.ImportHandler{DB: DB}
+	e := echo.New()
+	userID := createTestUser(t, DB)
+
+	file := `{"items": [{"content": "Fix the tap", "priority": 4, "due": {"date": "2025-01-10"}}]}`
+	req := newUploadRequest(t, "/api/import/todoist", "backup.json", file, nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	setTestUser(t, ctx, userID)
+
+	err := handler.Todoist(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), "due date 2025-01-10 dropped")
+
+	var tasks []models.Task
+	err = DB.NewSelect().Model(&tasks).Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, models.High, tasks[0].Priority)
+}
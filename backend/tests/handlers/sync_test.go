@@ -0,0 +1,106 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/handlers"
+	"pianpianino/problem"
+	"pianpianino/tasksync"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func pullChanges(t *testing.T, handler *handlers.TaskHandler, userID int, query string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/sync?"+query, nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	setTestUser(t, ctx, userID)
+
+	assert.NoError(t, handler.PullChanges(ctx))
+	return rec
+}
+
+func TestPullChangesAfterTaskRoutes(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	userID := createTestUser(t, DB)
+
+	rec := conditional(t, handler.InsertTask, userID, http.MethodPost, 0, "", "", `{"description": "Kept"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = conditional(t, handler.InsertTask, userID, http.MethodPost, 0, "", "", `{"description": "Deleted"}`)
+	var created struct {
+		Task struct {
+			ID int64 `json:"id"`
+		} `json:"task"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	rec = pullChanges(t, handler, userID, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var full tasksync.Delta
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &full))
+	assert.Len(t, full.Tasks, 2)
+
+	rec = conditional(t, handler.DeleteTask, userID, http.MethodDelete, created.Task.ID, "", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = pullChanges(t, handler, userID, "since="+strconv.FormatInt(full.Cursor, 10))
+	var delta tasksync.Delta
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &delta))
+	assert.Empty(t, delta.Tasks)
+	assert.Equal(t, []int64{created.Task.ID}, delta.Deleted)
+}
+
+func TestPullChangesInvalidQuery(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	userID := createTestUser(t, DB)
+
+	for _, query := range []string{"since=abc", "since=-1", "limit=100000"} {
+		rec := pullChanges(t, handler, userID, query)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestPushChanges(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	userID := createTestUser(t, DB)
+
+	push := func(body string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/sync", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+		setTestUser(t, ctx, userID)
+		assert.NoError(t, handler.PushChanges(ctx))
+		return rec
+	}
+
+	rec := push(`{"mutations": [{"op": "put", "client_id": "a", "description": "Offline task", "priority": "high"}]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response struct {
+		Results []tasksync.Outcome `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	if assert.Len(t, response.Results, 1) {
+		assert.Equal(t, tasksync.StatusApplied, response.Results[0].Status)
+		assert.Equal(t, "a", response.Results[0].ClientID)
+	}
+
+	// changing a known task needs the version it was based on
+	rec = push(`{"mutations": [{"op": "put", "id": 1, "description": "Edited"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	if assert.Len(t, p.Errors, 1) {
+		assert.Equal(t, "mutations[0].base_version", p.Errors[0].Field)
+	}
+}
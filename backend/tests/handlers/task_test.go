@@ -3,12 +3,15 @@ package handlers_test
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"pianpianino/handlers"
 	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/repository"
+	"pianpianino/service"
+	"pianpianino/tests/testdb"
 	"strconv"
 	"strings"
 	"testing"
@@ -18,58 +21,12 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/uptrace/bun"
-	"github.com/uptrace/bun/dialect/sqlitedialect"
-	"github.com/uptrace/bun/driver/sqliteshim"
 )
 
 const testJWTSecret = "test-secret-key"
 
 func setUpTaskTestDB(t *testing.T) *bun.DB {
-	// in memory db for testing
-	ctx := context.Background()
-	sqlDB, err := sql.Open(sqliteshim.ShimName, ":memory:")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	DB := bun.NewDB(sqlDB, sqlitedialect.New())
-
-	// migrate user table
-	_, err = DB.NewCreateTable().
-		Model((*models.User)(nil)).
-		IfNotExists().
-		Exec(ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// migrate task table
-	_, err = DB.NewCreateTable().
-		Model((*models.Task)(nil)).
-		IfNotExists().
-		Exec(ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	t.Cleanup(func() {
-		// Truncate tables after test runs
-		_, err := DB.NewTruncateTable().
-			Model((*models.Task)(nil)).
-			Exec(ctx)
-		if err != nil {
-			t.Fatal(err)
-		}
-		_, err = DB.NewTruncateTable().
-			Model((*models.User)(nil)).
-			Exec(ctx)
-		if err != nil {
-			t.Fatal(err)
-		}
-		_ = sqlDB.Close()
-	})
-
-	return DB
+	return testdb.Open(t, (*models.User)(nil), (*models.Task)(nil), (*models.TaskChange)(nil), (*models.SyncMutation)(nil))
 }
 
 func createTestJWTToken(userID int) (string, error) {
@@ -80,6 +37,20 @@ func createTestJWTToken(userID int) (string, error) {
 	return token.SignedString([]byte(testJWTSecret))
 }
 
+// setTestUser stores a parsed token for the user in the context,
+// the way the JWT middleware does before reaching the handlers.
+func setTestUser(t *testing.T, ctx echo.Context, userID int) {
+	token, err := createTestJWTToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtToken, _ := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testJWTSecret), nil
+	})
+	ctx.Set("user", jwtToken)
+}
+
 func createTestUser(t *testing.T, DB *bun.DB) int {
 	user := &models.User{
 		Username: "testuser",
@@ -116,7 +87,7 @@ func createTestTask(t *testing.T, DB *bun.DB, userID int, description string, pr
 
 func TestGetAllTasksSuccess(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID := createTestUser(t, DB)
@@ -151,7 +122,7 @@ func TestGetAllTasksSuccess(t *testing.T) {
 
 func TestGetAllTasksEmptyList(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID := createTestUser(t, DB)
@@ -183,7 +154,7 @@ func TestGetAllTasksEmptyList(t *testing.T) {
 
 func TestInsertTaskSuccess(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID := createTestUser(t, DB)
@@ -191,7 +162,7 @@ func TestInsertTaskSuccess(t *testing.T) {
 	token, err := createTestJWTToken(userID)
 	assert.NoError(t, err)
 
-	reqBody := &handlers.TaskRequest{
+	reqBody := &service.NewTask{
 		Description: "New test task",
 		Priority:    models.Medium,
 	}
@@ -221,7 +192,7 @@ func TestInsertTaskSuccess(t *testing.T) {
 
 func TestInsertTaskMissingDescription(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID := createTestUser(t, DB)
@@ -229,7 +200,7 @@ func TestInsertTaskMissingDescription(t *testing.T) {
 	token, err := createTestJWTToken(userID)
 	assert.NoError(t, err)
 
-	reqBody := &handlers.TaskRequest{
+	reqBody := &service.NewTask{
 		Description: "",
 		Priority:    models.Medium,
 	}
@@ -252,7 +223,7 @@ func TestInsertTaskMissingDescription(t *testing.T) {
 
 func TestInsertTaskInvalidJSON(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID := createTestUser(t, DB)
@@ -277,7 +248,7 @@ func TestInsertTaskInvalidJSON(t *testing.T) {
 
 func TestDeleteTaskSuccess(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID := createTestUser(t, DB)
@@ -288,6 +259,7 @@ func TestDeleteTaskSuccess(t *testing.T) {
 	ctx := e.NewContext(req, rec)
 	ctx.SetParamNames("id")
 	ctx.SetParamValues(strconv.Itoa(int(task.ID)))
+	setTestUser(t, ctx, userID)
 
 	err := handler.DeleteTask(ctx)
 	assert.NoError(t, err)
@@ -302,7 +274,7 @@ func TestDeleteTaskSuccess(t *testing.T) {
 
 func TestDeleteTaskInvalidID(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	req := httptest.NewRequest(http.MethodDelete, "/tasks/invalid", nil)
@@ -318,7 +290,7 @@ func TestDeleteTaskInvalidID(t *testing.T) {
 
 func TestToggleTaskCompletedSuccess(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID := createTestUser(t, DB)
@@ -351,7 +323,7 @@ func TestToggleTaskCompletedSuccess(t *testing.T) {
 
 func TestToggleTaskCompletedInvalidID(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID := createTestUser(t, DB)
@@ -377,7 +349,7 @@ func TestToggleTaskCompletedInvalidID(t *testing.T) {
 
 func TestToggleTaskCompletedTaskNotFound(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID := createTestUser(t, DB)
@@ -403,7 +375,7 @@ func TestToggleTaskCompletedTaskNotFound(t *testing.T) {
 
 func TestToggleTaskCompletedUserCannotAccessOtherUserTasks(t *testing.T) {
 	DB := setUpTaskTestDB(t)
-	handler := &handlers.TaskHandler{DB: DB}
+	handler := handlers.NewTaskHandler(DB)
 	e := echo.New()
 
 	userID1 := createTestUser(t, DB)
@@ -438,3 +410,125 @@ func TestToggleTaskCompletedUserCannotAccessOtherUserTasks(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
+
+func TestUpdateTaskSuccess(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	e := echo.New()
+
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Task to edit", models.Low)
+
+	req := httptest.NewRequest(http.MethodPatch, "/tasks/"+strconv.Itoa(int(task.ID)), strings.NewReader(`{"priority": "high"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(strconv.Itoa(int(task.ID)))
+	setTestUser(t, ctx, userID)
+
+	err := handler.UpdateTask(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	updated := new(models.Task)
+	err = DB.NewSelect().Model(updated).Where("id = ?", task.ID).Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Task to edit", updated.Description)
+	assert.Equal(t, models.High, updated.Priority)
+}
+
+func TestUpdateTaskEmptyDescription(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	e := echo.New()
+
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Task to edit", models.Low)
+
+	req := httptest.NewRequest(http.MethodPatch, "/tasks/"+strconv.Itoa(int(task.ID)), strings.NewReader(`{"description": ""}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(strconv.Itoa(int(task.ID)))
+	setTestUser(t, ctx, userID)
+
+	err := handler.UpdateTask(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestUpdateTaskUserCannotEditOtherUserTasks(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	e := echo.New()
+
+	userID := createTestUser(t, DB)
+	task := createTestTask(t, DB, userID, "Task to edit", models.Low)
+
+	req := httptest.NewRequest(http.MethodPatch, "/tasks/"+strconv.Itoa(int(task.ID)), strings.NewReader(`{"description": "Mine now"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(strconv.Itoa(int(task.ID)))
+	setTestUser(t, ctx, userID+1)
+
+	err := handler.UpdateTask(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestTaskProblemCodes(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := handlers.NewTaskHandler(DB)
+	e := echo.New()
+	userID := createTestUser(t, DB)
+
+	for _, tc := range []struct {
+		name   string
+		id     string
+		body   string
+		call   func(echo.Context) error
+		status int
+		code   problem.Code
+	}{
+		{"toggle missing task", "999", "", handler.ToggleTaskCompleted, http.StatusNotFound, problem.CodeTaskNotFound},
+		{"toggle invalid id", "abc", "", handler.ToggleTaskCompleted, http.StatusBadRequest, problem.CodeInvalidID},
+		{"insert without description", "", `{"priority": "high"}`, handler.InsertTask, http.StatusBadRequest, problem.CodeValidation},
+		{"insert invalid priority", "", `{"description": "a", "priority": "urgent"}`, handler.InsertTask, http.StatusBadRequest, problem.CodeInvalidBody},
+		{"insert long description", "", `{"description": "` + strings.Repeat("a", 1001) + `"}`, handler.InsertTask, http.StatusBadRequest, problem.CodeValidation},
+		{"update empty description", "1", `{"description": ""}`, handler.UpdateTask, http.StatusBadRequest, problem.CodeValidation},
+		{"update missing task", "999", `{"description": "a"}`, handler.UpdateTask, http.StatusNotFound, problem.CodeTaskNotFound},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(tc.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(tc.id)
+		setTestUser(t, ctx, userID)
+
+		err := tc.call(ctx)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.status, rec.Code, tc.name)
+
+		var p problem.Problem
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p), tc.name)
+		assert.Equal(t, tc.code, p.Code, tc.name)
+	}
+}
+
+func TestTaskHandlerWithoutDatabase(t *testing.T) {
+	handler := &handlers.TaskHandler{Tasks: service.NewTaskService(repository.NewMemoryTasks())}
+
+	rec := conditional(t, handler.InsertTask, 1, http.MethodPost, 0, "", "", `{"description": "In memory"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+
+	rec = conditional(t, handler.ToggleTaskCompleted, 1, http.MethodPatch, 1, "If-Match", `"1"`, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = conditional(t, handler.ToggleTaskCompleted, 1, http.MethodPatch, 1, "If-Match", `"1"`, "")
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+}
@@ -0,0 +1,123 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTodoTxtImportExport(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.TodoTxtHandler{DB: DB}
+	e := echo.New()
+
+	userID := createTestUser(t, DB)
+
+	token, err := createTestJWTToken(userID)
+	assert.NoError(t, err)
+	jwtToken, _ := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testJWTSecret), nil
+	})
+
+	file := "(A) 2025-01-02 Call mum +family @phone\n" +
+		"x 2025-01-05 2025-01-02 Pay the rent pri:B\n"
+
+	req := httptest.NewRequest(http.MethodPost, "/api/import/todotxt", strings.NewReader(file))
+	req.Header.Set(echo.HeaderContentType, echo.MIMETextPlain)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.Set("user", jwtToken)
+
+	err = handler.Import(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var response map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), response["imported"])
+
+	var tasks []models.Task
+	err = DB.NewSelect().Model(&tasks).Order("id ASC").Scan(req.Context())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, models.High, tasks[0].Priority)
+	assert.False(t, tasks[0].Completed)
+	assert.Equal(t, models.Medium, tasks[1].Priority)
+	assert.True(t, tasks[1].Completed)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/export/todotxt", nil)
+	rec = httptest.NewRecorder()
+	ctx = e.NewContext(req, rec)
+	ctx.Set("user", jwtToken)
+
+	err = handler.Export(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, file, rec.Body.String())
+}
+
+func TestTodoTxtImportWithoutDates(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.TodoTxtHandler{DB: DB}
+	e := echo.New()
+
+	userID := createTestUser(t, DB)
+
+	token, err := createTestJWTToken(userID)
+	assert.NoError(t, err)
+	jwtToken, _ := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testJWTSecret), nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/import/todotxt", strings.NewReader("Buy milk\n(C) Walk the dog\n"))
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.Set("user", jwtToken)
+
+	err = handler.Import(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var tasks []models.Task
+	err = DB.NewSelect().Model(&tasks).Order("id ASC").Scan(req.Context())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.False(t, tasks[0].CreatedAt.IsZero())
+	assert.Equal(t, models.Low, tasks[1].Priority)
+}
+
+func TestTodoTxtImportInvalidLines(t *testing.T) {
+	DB := setUpTaskTestDB(t)
+	handler := &handlers.TodoTxtHandler{DB: DB}
+	e := echo.New()
+
+	userID := createTestUser(t, DB)
+
+	file := "Buy milk\n" + strings.Repeat("a", models.MaxDescription+1) + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/import/todotxt", strings.NewReader(file))
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	setTestUser(t, ctx, userID)
+
+	err := handler.Import(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var response problem.Problem
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, problem.CodeValidation, response.Code)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Equal(t, "line 2", response.Errors[0].Field)
+	}
+}
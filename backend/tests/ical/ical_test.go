@@ -0,0 +1,58 @@
+package ical_test
+
+import (
+	"bytes"
+	"pianpianino/ical"
+	"pianpianino/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityMapping(t *testing.T) {
+	assert.Equal(t, 1, ical.Priority(models.High))
+	assert.Equal(t, 5, ical.Priority(models.Medium))
+	assert.Equal(t, 9, ical.Priority(models.Low))
+	assert.Equal(t, 0, ical.Priority(models.NotSet))
+}
+
+func TestWriteCalendarCompletedTask(t *testing.T) {
+	updated := time.Date(2025, 3, 4, 10, 30, 0, 0, time.UTC)
+	tasks := []models.Task{{
+		ID:          7,
+		Description: "Call mum, then dad; done",
+		Priority:    models.Medium,
+		Completed:   true,
+		CreatedAt:   updated.Add(-time.Hour),
+		UpdatedAt:   updated,
+	}}
+
+	var buf bytes.Buffer
+	err := ical.WriteCalendar(&buf, "Test", tasks)
+	assert.NoError(t, err)
+
+	body := buf.String()
+	assert.True(t, strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(body, "END:VCALENDAR\r\n"))
+	assert.Contains(t, body, "UID:task-7@pianpianino\r\n")
+	assert.Contains(t, body, `SUMMARY:Call mum\, then dad\; done`)
+	assert.Contains(t, body, "STATUS:COMPLETED\r\n")
+	assert.Contains(t, body, "COMPLETED:20250304T103000Z\r\n")
+	assert.Contains(t, body, "CREATED:20250304T093000Z\r\n")
+}
+
+func TestWriteCalendarFoldsLongLines(t *testing.T) {
+	tasks := []models.Task{{ID: 1, Description: strings.Repeat("à", 100)}}
+
+	var buf bytes.Buffer
+	err := ical.WriteCalendar(&buf, "", tasks)
+	assert.NoError(t, err)
+
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+	unfolded := strings.ReplaceAll(buf.String(), "\r\n ", "")
+	assert.Contains(t, unfolded, "SUMMARY:"+strings.Repeat("à", 100)+"\r\n")
+}
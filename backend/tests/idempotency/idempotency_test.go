@@ -0,0 +1,235 @@
+package idempotency_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/idempotency"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func setUpTestDB(t *testing.T) *bun.DB {
+	sqlDB, err := sql.Open(sqliteshim.ShimName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	DB := bun.NewDB(sqlDB, sqlitedialect.New())
+
+	_, err = DB.NewCreateTable().Model((*models.IdempotencyKey)(nil)).Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return DB
+}
+
+// setUpEcho serves a handler that counts its calls and answers with the
+// status it is given, behind a fake authentication.
+func setUpEcho(DB *bun.DB, ttl time.Duration, calls *int, status int) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID := c.Request().Header.Get("X-User")
+			if userID == "" {
+				userID = "1"
+			}
+			claims := jwt.MapClaims{"user_id": float64(userID[0] - '0')}
+			c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, claims))
+			return next(c)
+		}
+	}
+	e.Use(middleware.RequestID())
+	g := e.Group("/api", authenticate, idempotency.Middleware(DB, ttl))
+	handler := func(c echo.Context) error {
+		*calls++
+		c.Response().Header().Set("ETag", `"`+strconv.Itoa(*calls)+`"`)
+		return c.JSON(status, echo.Map{"call": *calls})
+	}
+	g.POST("/tasks", handler)
+	g.GET("/tasks", handler)
+	return e
+}
+
+func send(e *echo.Echo, method, key, user, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/tasks", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(idempotency.HeaderKey, key)
+	}
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func problemCode(t *testing.T, rec *httptest.ResponseRecorder) problem.Code {
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	return p.Code
+}
+
+func TestReplayStoredResponse(t *testing.T) {
+	calls := 0
+	e := setUpEcho(setUpTestDB(t), idempotency.DefaultTTL, &calls, http.StatusCreated)
+
+	first := send(e, http.MethodPost, "abc", "", `{"description": "a"}`)
+	retry := send(e, http.MethodPost, "abc", "", `{"description": "a"}`)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, first.Header().Get(echo.HeaderContentType), retry.Header().Get(echo.HeaderContentType))
+	// the headers of the handler are replayed, not those of the middleware
+	assert.Equal(t, `"1"`, retry.Header().Get("ETag"))
+	assert.NotEqual(t, first.Header().Get(echo.HeaderXRequestID), retry.Header().Get(echo.HeaderXRequestID))
+	assert.Len(t, retry.Header().Values(echo.HeaderXRequestID), 1)
+	assert.Empty(t, first.Header().Get(idempotency.HeaderReplayed))
+	assert.Equal(t, "true", retry.Header().Get(idempotency.HeaderReplayed))
+}
+
+func TestKeyReusedWithDifferentPayload(t *testing.T) {
+	calls := 0
+	e := setUpEcho(setUpTestDB(t), idempotency.DefaultTTL, &calls, http.StatusCreated)
+
+	send(e, http.MethodPost, "abc", "", `{"description": "a"}`)
+	rec := send(e, http.MethodPost, "abc", "", `{"description": "b"}`)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, problem.CodeKeyReused, problemCode(t, rec))
+}
+
+func TestKeyInUse(t *testing.T) {
+	DB := setUpTestDB(t)
+	calls := 0
+	e := setUpEcho(DB, idempotency.DefaultTTL, &calls, http.StatusCreated)
+
+	// the same request is first sent and then reserved by hand, as if it
+	// were still being processed
+	send(e, http.MethodPost, "first", "", `{}`)
+	var stored models.IdempotencyKey
+	err := DB.NewSelect().Model(&stored).Where("key = ?", "first").Scan(context.Background())
+	assert.NoError(t, err)
+	pending := &models.IdempotencyKey{UserID: 1, Key: "pending", Fingerprint: stored.Fingerprint, ExpiresAt: time.Now().Add(time.Hour)}
+	_, err = DB.NewInsert().Model(pending).Exec(context.Background())
+	assert.NoError(t, err)
+
+	rec := send(e, http.MethodPost, "pending", "", `{}`)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, problem.CodeKeyInUse, problemCode(t, rec))
+}
+
+func TestServerErrorsAreNotStored(t *testing.T) {
+	calls := 0
+	e := setUpEcho(setUpTestDB(t), idempotency.DefaultTTL, &calls, http.StatusInternalServerError)
+
+	send(e, http.MethodPost, "abc", "", `{}`)
+	rec := send(e, http.MethodPost, "abc", "", `{}`)
+
+	assert.Equal(t, 2, calls)
+	assert.Empty(t, rec.Header().Get(idempotency.HeaderReplayed))
+}
+
+func TestKeysArePerUser(t *testing.T) {
+	calls := 0
+	e := setUpEcho(setUpTestDB(t), idempotency.DefaultTTL, &calls, http.StatusCreated)
+
+	send(e, http.MethodPost, "abc", "1", `{}`)
+	rec := send(e, http.MethodPost, "abc", "2", `{}`)
+
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestExpiredKeysAreApplied(t *testing.T) {
+	calls := 0
+	e := setUpEcho(setUpTestDB(t), -time.Second, &calls, http.StatusCreated)
+
+	send(e, http.MethodPost, "abc", "", `{}`)
+	send(e, http.MethodPost, "abc", "", `{}`)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestRequestsWithoutKey(t *testing.T) {
+	calls := 0
+	e := setUpEcho(setUpTestDB(t), idempotency.DefaultTTL, &calls, http.StatusOK)
+
+	send(e, http.MethodPost, "", "", `{}`)
+	send(e, http.MethodPost, "", "", `{}`)
+	// reads are not affected by the header
+	send(e, http.MethodGet, "abc", "", "")
+	send(e, http.MethodGet, "abc", "", "")
+	assert.Equal(t, 4, calls)
+
+	rec := send(e, http.MethodPost, strings.Repeat("k", 256), "", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, problem.CodeInvalidKey, problemCode(t, rec))
+}
+
+func TestStaleReservationsExpire(t *testing.T) {
+	DB := setUpTestDB(t)
+	calls := 0
+	e := setUpEcho(DB, idempotency.DefaultTTL, &calls, http.StatusCreated)
+
+	// left by a server that died while processing the request
+	send(e, http.MethodPost, "first", "", `{}`)
+	var stored models.IdempotencyKey
+	err := DB.NewSelect().Model(&stored).Where("key = ?", "first").Scan(context.Background())
+	assert.NoError(t, err)
+	stale := &models.IdempotencyKey{UserID: 1, Key: "stale", Fingerprint: stored.Fingerprint, ExpiresAt: time.Now().Add(-time.Second)}
+	_, err = DB.NewInsert().Model(stale).Exec(context.Background())
+	assert.NoError(t, err)
+
+	rec := send(e, http.MethodPost, "stale", "", `{}`)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestPanicReleasesKey(t *testing.T) {
+	DB := setUpTestDB(t)
+	e := echo.New()
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": float64(1)}))
+			return next(c)
+		}
+	}
+	calls := 0
+	e.POST("/api/tasks", func(c echo.Context) error {
+		calls++
+		if calls == 1 {
+			panic("bug")
+		}
+		return c.NoContent(http.StatusCreated)
+	}, authenticate, idempotency.Middleware(DB, idempotency.DefaultTTL))
+
+	assert.Panics(t, func() { send(e, http.MethodPost, "abc", "", `{}`) })
+	count, err := DB.NewSelect().Model((*models.IdempotencyKey)(nil)).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	rec := send(e, http.MethodPost, "abc", "", `{}`)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
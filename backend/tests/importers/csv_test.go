@@ -0,0 +1,125 @@
+package importers_test
+
+import (
+	"pianpianino/importers"
+	"pianpianino/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSVWithMapping(t *testing.T) {
+	file := "Title,Prio,Done,Opened\n" +
+		"Write the report,high,yes,2025-02-01\n" +
+		"\"Call mum, then dad\",Low,,\n"
+	mapping := importers.CSVMapping{
+		Description: "Title",
+		Priority:    "prio",
+		Completed:   "Done",
+		CreatedAt:   "Opened",
+	}
+
+	report, err := importers.ParseCSV(strings.NewReader(file), mapping)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Rejected)
+	assert.Len(t, report.Accepted, 2)
+
+	first := report.Accepted[0]
+	assert.Equal(t, 2, first.Item)
+	assert.Equal(t, "Write the report", first.Task.Description)
+	assert.Equal(t, models.High, first.Task.Priority)
+	assert.True(t, first.Task.Completed)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), first.Task.CreatedAt)
+
+	second := report.Accepted[1]
+	assert.Equal(t, "Call mum, then dad", second.Task.Description)
+	assert.Equal(t, models.Low, second.Task.Priority)
+	assert.False(t, second.Task.Completed)
+	assert.True(t, second.Task.CreatedAt.IsZero())
+}
+
+func TestParseCSVRejectsInvalidRows(t *testing.T) {
+	file := "description,priority,completed,created_at,updated_at\n" +
+		"Fine,normal,false,,\n" +
+		",urgent,maybe,yesterday,\n" +
+		"Time travel,,,2025-02-02,2025-02-01\n"
+
+	report, err := importers.ParseCSV(strings.NewReader(file), importers.DefaultCSVMapping)
+	assert.NoError(t, err)
+	assert.Len(t, report.Accepted, 1)
+	assert.Len(t, report.Rejected, 2)
+
+	assert.Equal(t, 3, report.Rejected[0].Item)
+	assert.Equal(t, []string{
+		"description is required",
+		"invalid priority value: urgent",
+		"invalid completed value: maybe",
+		"created_at: invalid date: yesterday",
+	}, report.Rejected[0].Reasons)
+
+	assert.Equal(t, 4, report.Rejected[1].Item)
+	assert.Equal(t, []string{"updated_at is before created_at"}, report.Rejected[1].Reasons)
+}
+
+func TestParseCSVDefaultMappingOnlyNeedsDescription(t *testing.T) {
+	report, err := importers.ParseCSV(strings.NewReader("Description\nBuy milk\n"), importers.DefaultCSVMapping)
+	assert.NoError(t, err)
+	assert.Len(t, report.Accepted, 1)
+}
+
+func TestParseCSVUnknownColumn(t *testing.T) {
+	_, err := importers.ParseCSV(strings.NewReader("Title\nBuy milk\n"), importers.CSVMapping{Description: "Name"})
+	assert.EqualError(t, err, `column "Name" not found`)
+}
+
+func TestParseCSVNumbersItemsByLine(t *testing.T) {
+	file := "description,priority\n" +
+		"\"Write the report,\nthen send it\",high\n" +
+		"\n" +
+		"Buy milk,urgent\n" +
+		"Call \"mum\",low\n"
+
+	report, err := importers.ParseCSV(strings.NewReader(file), importers.DefaultCSVMapping)
+	assert.NoError(t, err)
+	if assert.Len(t, report.Accepted, 1) {
+		assert.Equal(t, 2, report.Accepted[0].Item)
+	}
+	if assert.Len(t, report.Rejected, 2) {
+		assert.Equal(t, 5, report.Rejected[0].Item)
+		assert.Equal(t, 6, report.Rejected[1].Item)
+	}
+}
+
+func TestParseCSVRejectsLongDescriptions(t *testing.T) {
+	file := "description\n" + strings.Repeat("a", models.MaxDescription+1) + "\nBuy milk\n"
+
+	report, err := importers.ParseCSV(strings.NewReader(file), importers.DefaultCSVMapping)
+	assert.NoError(t, err)
+	assert.Len(t, report.Accepted, 1)
+	if assert.Len(t, report.Rejected, 1) {
+		assert.Equal(t, 2, report.Rejected[0].Item)
+		assert.Equal(t, []string{"description is longer than 1000 characters"}, report.Rejected[0].Reasons)
+	}
+}
+
+func TestParseCSVCompletionTime(t *testing.T) {
+	file := "description,completed,updated_at,completed_at\n" +
+		"Done on a date,yes,2025-02-01,2025-01-31\n" +
+		"Done when updated,yes,2025-02-01,\n" +
+		"Done some time,yes,,\n" +
+		"Not done,no,,2025-01-31\n"
+
+	before := time.Now()
+	report, err := importers.ParseCSV(strings.NewReader(file), importers.DefaultCSVMapping)
+	assert.NoError(t, err)
+	if assert.Len(t, report.Accepted, 3) {
+		assert.Equal(t, time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), report.Accepted[0].Task.CompletedAt)
+		assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), report.Accepted[1].Task.CompletedAt)
+		assert.False(t, report.Accepted[2].Task.CompletedAt.Before(before))
+	}
+	if assert.Len(t, report.Rejected, 1) {
+		assert.Equal(t, []string{"completed_at is set on a task that is not completed"}, report.Rejected[0].Reasons)
+	}
+}
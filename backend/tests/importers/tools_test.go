@@ -0,0 +1,141 @@
+package importers_test
+
+import (
+	"pianpianino/importers"
+	"pianpianino/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTodoistCSV(t *testing.T) {
+	file := "TYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE\n" +
+		"section,Errands,,,,,,,,\n" +
+		"task,Buy milk,,1,1,Ann (1),,every friday,en,Europe/Rome\n" +
+		"task,Check the receipt,From the shop,4,2,Ann (1),,,en,Europe/Rome\n" +
+		"note,Remember the bag,,,,,,,,\n"
+
+	report, err := importers.ParseTodoist(strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Len(t, report.Accepted, 2)
+	assert.Len(t, report.Rejected, 2)
+
+	milk := report.Accepted[0]
+	assert.Equal(t, 3, milk.Item)
+	assert.Equal(t, "Buy milk", milk.Task.Description)
+	assert.Equal(t, models.High, milk.Task.Priority)
+	assert.Equal(t, []string{"due date every friday dropped"}, milk.Warnings)
+
+	receipt := report.Accepted[1]
+	assert.Equal(t, models.NotSet, receipt.Task.Priority)
+	assert.Equal(t, []string{"description dropped", "sub-task imported as a top level task"}, receipt.Warnings)
+
+	assert.Equal(t, []string{"rows of type section have no counterpart"}, report.Rejected[0].Reasons)
+}
+
+func TestParseTodoistJSON(t *testing.T) {
+	file := `{
+		"projects": [{"id": "1", "name": "Inbox"}, {"id": "2", "name": "Home"}],
+		"items": [
+			{"content": "Fix the tap", "priority": 4, "checked": true, "project_id": "2",
+			 "labels": ["diy"], "added_at": "2025-01-02T10:00:00Z", "completed_at": "2025-01-03T10:00:00Z"},
+			{"content": "Call mum", "priority": 2, "project_id": "1", "due": {"date": "2025-01-10"}},
+			{"content": "  "}
+		]
+	}`
+
+	report, err := importers.ParseTodoist(strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Len(t, report.Accepted, 2)
+	assert.Len(t, report.Rejected, 1)
+
+	tap := report.Accepted[0]
+	assert.Equal(t, models.High, tap.Task.Priority)
+	assert.True(t, tap.Task.Completed)
+	assert.Equal(t, 2025, tap.Task.CreatedAt.Year())
+	assert.Equal(t, 3, tap.Task.UpdatedAt.Day())
+	assert.Equal(t, time.Date(2025, 1, 3, 10, 0, 0, 0, time.UTC), tap.Task.CompletedAt)
+	assert.Equal(t, []string{"Home"}, tap.Task.Projects)
+	assert.Equal(t, []string{"diy"}, tap.Task.Contexts)
+	assert.Empty(t, tap.Warnings)
+
+	mum := report.Accepted[1]
+	assert.Equal(t, models.Low, mum.Task.Priority)
+	assert.Empty(t, mum.Task.Projects)
+	assert.Equal(t, []string{"due date 2025-01-10 dropped"}, mum.Warnings)
+
+	assert.Equal(t, 3, report.Rejected[0].Item)
+}
+
+func TestParseMicrosoftToDo(t *testing.T) {
+	file := `{"lists": [{"displayName": "Weekly groceries", "tasks": [
+		{"title": "Apples", "status": "notStarted", "importance": "high",
+		 "createdDateTime": "2025-01-02T10:00:00.0000000Z", "body": {"content": "Green ones"}},
+		{"title": "Pears", "status": "completed", "importance": "normal",
+		 "dueDateTime": {"dateTime": "2025-01-05T00:00:00.0000000", "timeZone": "UTC"},
+		 "completedDateTime": {"dateTime": "2025-01-04T00:00:00.0000000", "timeZone": "UTC"}}
+	]}]}`
+
+	report, err := importers.ParseMicrosoftToDo(strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Len(t, report.Accepted, 2)
+
+	apples := report.Accepted[0]
+	assert.Equal(t, models.High, apples.Task.Priority)
+	assert.False(t, apples.Task.Completed)
+	assert.Equal(t, 2025, apples.Task.CreatedAt.Year())
+	assert.True(t, apples.Task.CompletedAt.IsZero())
+	assert.Equal(t, []string{"Weekly-groceries"}, apples.Task.Projects)
+	assert.Equal(t, []string{"notes dropped"}, apples.Warnings)
+
+	pears := report.Accepted[1]
+	assert.Equal(t, models.Medium, pears.Task.Priority)
+	assert.True(t, pears.Task.Completed)
+	assert.Equal(t, time.Date(2025, 1, 4, 0, 0, 0, 0, time.UTC), pears.Task.CompletedAt)
+	assert.Contains(t, pears.Warnings, "due date 2025-01-05T00:00:00.0000000 dropped")
+}
+
+func TestParseGoogleTasks(t *testing.T) {
+	file := `{"kind": "tasks#taskLists", "items": [{"kind": "tasks#taskList", "title": "My Tasks", "items": [
+		{"title": "Book flights", "status": "needsAction", "due": "2025-03-01T00:00:00.000Z", "updated": "2025-01-02T10:00:00.000Z"},
+		{"title": "Old task", "status": "completed", "deleted": true},
+		{"title": "Pack", "status": "completed", "completed": "2025-01-04T10:00:00.000Z", "parent": "abc"}
+	]}]}`
+
+	report, err := importers.ParseGoogleTasks(strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Len(t, report.Accepted, 2)
+	assert.Len(t, report.Rejected, 1)
+
+	flights := report.Accepted[0]
+	assert.Equal(t, models.NotSet, flights.Task.Priority)
+	assert.False(t, flights.Task.Completed)
+	assert.Equal(t, []string{"due date 2025-03-01T00:00:00.000Z dropped"}, flights.Warnings)
+
+	pack := report.Accepted[1]
+	assert.True(t, pack.Task.Completed)
+	assert.Equal(t, 4, pack.Task.UpdatedAt.Day())
+	assert.Equal(t, time.Date(2025, 1, 4, 10, 0, 0, 0, time.UTC), pack.Task.CompletedAt)
+	assert.Empty(t, pack.Task.Projects)
+	assert.Equal(t, []string{"sub-task imported as a top level task"}, pack.Warnings)
+
+	assert.Equal(t, []string{"task was deleted"}, report.Rejected[0].Reasons)
+}
+
+func TestParseTodoistRejectsLongContent(t *testing.T) {
+	file := `{"items": [{"content": "` + strings.Repeat("a", models.MaxDescription+1) + `"}, {"content": "Call mum"}]}`
+
+	report, err := importers.ParseTodoist(strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Len(t, report.Accepted, 1)
+	if assert.Len(t, report.Rejected, 1) {
+		assert.Equal(t, 1, report.Rejected[0].Item)
+	}
+}
+
+func TestParseMicrosoftToDoInvalidJSON(t *testing.T) {
+	_, err := importers.ParseMicrosoftToDo(strings.NewReader("not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package models_test
+
+import (
+	"context"
+	"database/sql"
+	"pianpianino/models"
+	"pianpianino/tests/testdb"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+func TestRecordChangeFollowsCommits(t *testing.T) {
+	DB := testdb.Open(t, (*models.User)(nil), (*models.TaskChange)(nil))
+	if DB.Dialect().Name() == dialect.SQLite {
+		t.Skip("SQLite has a single writer, set " + testdb.EnvDSN + " to run against another database")
+	}
+	ctx := context.Background()
+	user := &models.User{Username: "alice", Password: "hash"}
+	_, err := DB.NewInsert().Model(user).Exec(ctx)
+	assert.NoError(t, err)
+
+	first, err := DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, models.RecordChange(ctx, first, user.ID, false, 1))
+
+	// a second change waits for the first one to be committed
+	recorded := make(chan error, 1)
+	go func() {
+		recorded <- DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+			return models.RecordChange(ctx, tx, user.ID, false, 2)
+		})
+	}()
+	select {
+	case err := <-recorded:
+		t.Fatalf("the second change did not wait: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.NoError(t, first.Commit())
+	assert.NoError(t, <-recorded)
+
+	var changes []models.TaskChange
+	assert.NoError(t, DB.NewSelect().Model(&changes).Order("id ASC").Scan(ctx))
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, []int64{1, 2}, []int64{changes[0].TaskID, changes[1].TaskID})
+	}
+}
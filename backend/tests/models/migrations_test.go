@@ -0,0 +1,93 @@
+package models_test
+
+import (
+	"context"
+	"pianpianino/models"
+	"pianpianino/tests/testdb"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+// firstReleaseTask is the tasks table before uid and version were added.
+type firstReleaseTask struct {
+	bun.BaseModel `bun:"table:tasks"`
+
+	ID          int64     `bun:"id,pk,autoincrement"`
+	UserID      int64     `bun:"user_id,notnull"`
+	Description string    `bun:"description,type:varchar(1000)"`
+	Priority    int       `bun:"importance,notnull,default:0"`
+	Completed   bool      `bun:"completed,notnull,default:false"`
+	CreatedAt   time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	UpdatedAt   time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+func TestMigrateDBCanRunTwice(t *testing.T) {
+	DB := testdb.Open(t)
+	ctx := context.Background()
+
+	assert.NoError(t, models.MigrateDB(ctx, DB))
+	assert.NoError(t, models.MigrateDB(ctx, DB))
+
+	user := &models.User{Username: "alice", Password: "hash"}
+	_, err := DB.NewInsert().Model(user).Exec(ctx)
+	assert.NoError(t, err)
+	task := &models.Task{UserID: user.ID, Description: "Buy milk"}
+	_, err = DB.NewInsert().Model(task).Exec(ctx)
+	assert.NoError(t, err)
+}
+
+func TestMigrateDBUpgradesTheFirstRelease(t *testing.T) {
+	DB := testdb.Open(t, (*models.User)(nil), (*firstReleaseTask)(nil))
+	ctx := context.Background()
+
+	user := &models.User{Username: "alice", Password: "hash"}
+	_, err := DB.NewInsert().Model(user).Exec(ctx)
+	assert.NoError(t, err)
+	old := &firstReleaseTask{UserID: user.ID, Description: "Buy milk"}
+	_, err = DB.NewInsert().Model(old).Exec(ctx)
+	assert.NoError(t, err)
+
+	assert.NoError(t, models.MigrateDB(ctx, DB))
+
+	task := new(models.Task)
+	err = DB.NewSelect().Model(task).Where("id = ?", old.ID).Scan(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Buy milk", task.Description)
+		assert.Equal(t, int64(1), task.Version)
+		assert.Empty(t, task.UID)
+	}
+
+	// the existing task is part of the change sequence
+	var changes []models.TaskChange
+	err = DB.NewSelect().Model(&changes).Scan(ctx)
+	if assert.NoError(t, err) && assert.Len(t, changes, 1) {
+		assert.Equal(t, old.ID, changes[0].TaskID)
+		assert.Equal(t, user.ID, changes[0].UserID)
+	}
+
+	// the existing tasks are only recorded once, not on every start
+	_, err = DB.NewInsert().Model(&firstReleaseTask{UserID: user.ID, Description: "Unrecorded"}).Exec(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, models.MigrateDB(ctx, DB))
+	count, err := DB.NewSelect().Model((*models.TaskChange)(nil)).Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestPending(t *testing.T) {
+	DB := testdb.Open(t, (*models.User)(nil), (*firstReleaseTask)(nil))
+	ctx := context.Background()
+
+	pending, err := models.Pending(ctx, DB)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tasks.completed_at", "tasks.projects", "tasks.contexts", "tasks.uid", "tasks.dav_name",
+		"tasks.todotxt_priority", "tasks.todotxt_undated", "tasks.version", "idempotency_keys", "task_changes", "sync_mutations"}, pending)
+
+	assert.NoError(t, models.MigrateDB(ctx, DB))
+	pending, err = models.Pending(ctx, DB)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
@@ -0,0 +1,127 @@
+package problem_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/problem"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) problem.Problem {
+	var p problem.Problem
+	assert.Equal(t, problem.MIMEProblemJSON, rec.Header().Get(echo.HeaderContentType))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	return p
+}
+
+func TestWriteProblem(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tasks/7", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := problem.Write(c, problem.New(http.StatusNotFound, problem.CodeTaskNotFound, "Task not found"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	p := decode(t, rec)
+	assert.Equal(t, "urn:pianpianino:problem:task_not_found", p.Type)
+	assert.Equal(t, "Not Found", p.Title)
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, "Task not found", p.Detail)
+	assert.Equal(t, problem.CodeTaskNotFound, p.Code)
+	assert.Equal(t, "/api/v1/tasks/7", p.Instance)
+	assert.Equal(t, "req-1", p.RequestID)
+}
+
+func TestWriteValidationProblem(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/register", nil), rec)
+
+	err := problem.Write(c, problem.Validation().
+		Field("username", problem.FieldRequired, "Username is required").
+		Field("password", problem.FieldRequired, "Password is required"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	p := decode(t, rec)
+	assert.Equal(t, problem.CodeValidation, p.Code)
+	if assert.Len(t, p.Errors, 2) {
+		assert.Equal(t, "username", p.Errors[0].Field)
+		assert.Equal(t, problem.FieldRequired, p.Errors[0].Code)
+		assert.Equal(t, "password", p.Errors[1].Field)
+	}
+}
+
+func TestInternalProblemHidesCause(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	cause := errors.New("database is locked")
+	err := problem.Internal("Failed to fetch tasks", cause)
+	assert.ErrorIs(t, err, cause)
+
+	assert.NoError(t, problem.Write(c, err))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "database is locked")
+	assert.Equal(t, problem.CodeInternal, decode(t, rec).Code)
+}
+
+func TestInvalidBodyNamesTheField(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"description": 3}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	var body struct {
+		Description string `json:"description"`
+	}
+	p := problem.InvalidBody(c.Bind(&body))
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, problem.CodeInvalidBody, p.Code)
+	if assert.Len(t, p.Errors, 1) {
+		assert.Equal(t, "description", p.Errors[0].Field)
+		assert.Equal(t, problem.FieldInvalid, p.Errors[0].Code)
+	}
+}
+
+func TestHandlerConvertsEchoErrors(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	e.Use(middleware.RequestID())
+	e.GET("/tasks", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return errors.New("unexpected")
+	})
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		code         problem.Code
+	}{
+		{http.MethodGet, "/missing", http.StatusNotFound, problem.CodeNotFound},
+		{http.MethodPost, "/tasks", http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed},
+		{http.MethodGet, "/fail", http.StatusInternalServerError, problem.CodeInternal},
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		assert.Equal(t, tc.status, rec.Code, tc.path)
+
+		p := decode(t, rec)
+		assert.Equal(t, tc.code, p.Code, tc.path)
+		assert.NotEmpty(t, p.RequestID, tc.path)
+		assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), p.RequestID, tc.path)
+	}
+}
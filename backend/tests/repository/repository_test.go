@@ -0,0 +1,143 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"pianpianino/models"
+	"pianpianino/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func setUpTestDB(t *testing.T) *bun.DB {
+	ctx := context.Background()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	DB := bun.NewDB(sqlDB, sqlitedialect.New())
+	for _, model := range []interface{}{(*models.User)(nil), (*models.Task)(nil), (*models.TaskChange)(nil)} {
+		if _, err := DB.NewCreateTable().Model(model).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return DB
+}
+
+// Both implementations must behave the same, the services are tested with
+// the in-memory one.
+func implementations(t *testing.T) map[string]func() (repository.Tasks, repository.Users) {
+	return map[string]func() (repository.Tasks, repository.Users){
+		"bun": func() (repository.Tasks, repository.Users) {
+			DB := setUpTestDB(t)
+			return repository.NewBunTasks(DB), repository.NewBunUsers(DB)
+		},
+		"memory": func() (repository.Tasks, repository.Users) {
+			return repository.NewMemoryTasks(), repository.NewMemoryUsers()
+		},
+	}
+}
+
+func TestTasks(t *testing.T) {
+	ctx := context.Background()
+	for name, open := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			tasks, _ := open()
+
+			first := &models.Task{UserID: 1, Description: "First"}
+			assert.NoError(t, tasks.Create(ctx, first))
+			assert.NoError(t, tasks.Create(ctx, &models.Task{UserID: 2, Description: "Other user"}))
+			assert.NotZero(t, first.ID)
+			assert.Equal(t, int64(1), first.Version)
+
+			list, err := tasks.List(ctx, 1)
+			assert.NoError(t, err)
+			assert.Len(t, list, 1)
+			list, err = tasks.ListByUsers(ctx, []int64{1, 2})
+			assert.NoError(t, err)
+			assert.Len(t, list, 2)
+
+			_, err = tasks.Get(ctx, 2, first.ID)
+			assert.ErrorIs(t, err, repository.ErrNotFound)
+
+			stale := *first
+			first.Completed = true
+			assert.NoError(t, tasks.Update(ctx, first))
+			assert.Equal(t, int64(2), first.Version)
+			stored, err := tasks.Get(ctx, 1, first.ID)
+			if assert.NoError(t, err) {
+				assert.True(t, stored.Completed)
+				assert.Equal(t, int64(2), stored.Version)
+			}
+
+			assert.ErrorIs(t, tasks.Update(ctx, &stale), repository.ErrConflict)
+			assert.Equal(t, int64(1), stale.Version)
+			assert.ErrorIs(t, tasks.Delete(ctx, &stale), repository.ErrConflict)
+			assert.NoError(t, tasks.Delete(ctx, first))
+			_, err = tasks.Get(ctx, 1, first.ID)
+			assert.ErrorIs(t, err, repository.ErrNotFound)
+		})
+	}
+}
+
+func TestTasksAtomic(t *testing.T) {
+	ctx := context.Background()
+	failure := errors.New("failure")
+	for name, open := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			tasks, _ := open()
+
+			err := tasks.Atomic(ctx, func(ctx context.Context, tasks repository.Tasks) error {
+				assert.NoError(t, tasks.Create(ctx, &models.Task{UserID: 1, Description: "Discarded"}))
+				return failure
+			})
+			assert.ErrorIs(t, err, failure)
+			list, _ := tasks.List(ctx, 1)
+			assert.Empty(t, list)
+
+			err = tasks.Atomic(ctx, func(ctx context.Context, tasks repository.Tasks) error {
+				for _, description := range []string{"Kept", "Kept too"} {
+					if err := tasks.Create(ctx, &models.Task{UserID: 1, Description: description}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			assert.NoError(t, err)
+			list, _ = tasks.List(ctx, 1)
+			assert.Len(t, list, 2)
+		})
+	}
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	for name, open := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			_, users := open()
+
+			ada := &models.User{Username: "ada", Password: "hash"}
+			assert.NoError(t, users.Create(ctx, ada))
+			assert.NotZero(t, ada.ID)
+			assert.ErrorIs(t, users.Create(ctx, &models.User{Username: "ada", Password: "hash"}), repository.ErrDuplicate)
+
+			found, err := users.FindByUsername(ctx, "ada")
+			if assert.NoError(t, err) {
+				assert.Equal(t, ada.ID, found.ID)
+			}
+			_, err = users.FindByUsername(ctx, "bob")
+			assert.ErrorIs(t, err, repository.ErrNotFound)
+
+			list, err := users.Get(ctx, []int64{ada.ID, ada.ID + 1})
+			assert.NoError(t, err)
+			assert.Len(t, list, 1)
+		})
+	}
+}
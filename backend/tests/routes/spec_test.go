@@ -0,0 +1,135 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/config"
+	"pianpianino/handlers"
+	"pianpianino/openapi"
+	"pianpianino/routes"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// setUpRoutes registers the routes without a database, only the route table
+// is needed here.
+func setUpRoutes(t *testing.T) *echo.Echo {
+	cfg := config.Default()
+	cfg.JWTSecret = "test-secret-key"
+
+	e := echo.New()
+	routes.SetupRoutes(e, cfg, routes.Handlers{
+		Auth:     &handlers.AuthHandler{},
+		Task:     &handlers.TaskHandler{},
+		Calendar: &handlers.CalendarHandler{},
+		CalDAV:   &handlers.CalDAVHandler{},
+		TodoTxt:  &handlers.TodoTxtHandler{},
+		Backup:   &handlers.BackupHandler{},
+		Import:   &handlers.ImportHandler{},
+	})
+	return e
+}
+
+// specPath drops the trailing slash of the routes registered both with and
+// without it, the spec documents them once.
+func specPath(path string) string {
+	if path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+func TestSpecDescribesEveryRoute(t *testing.T) {
+	e := setUpRoutes(t)
+	spec := routes.Spec()
+
+	for _, route := range e.Routes() {
+		// added by echo for groups with middleware
+		if route.Method == echo.RouteNotFound {
+			continue
+		}
+		assert.True(t, spec.Has(route.Method, specPath(route.Path)),
+			"route %s %s has no entry in routes.Spec", route.Method, route.Path)
+	}
+}
+
+func TestSpecHasNoStaleEntries(t *testing.T) {
+	e := setUpRoutes(t)
+	registered := make(map[string]bool)
+	for _, route := range e.Routes() {
+		path, _ := openapi.PathTemplate(specPath(route.Path))
+		registered[openapi.MethodKey(route.Method)+" "+path] = true
+	}
+
+	for path, item := range routes.Spec().Paths {
+		for method := range item {
+			assert.True(t, registered[method+" "+path], "spec entry %s %s has no route", method, path)
+		}
+	}
+}
+
+func TestSpecSchemas(t *testing.T) {
+	spec := routes.Spec()
+	task := spec.Components.Schemas["Task"]
+	if assert.NotNil(t, task) {
+		priority := task.Properties["priority"]
+		assert.Equal(t, "string", priority.Type)
+		assert.Equal(t, []string{"notset", "low", "normal", "high"}, priority.Enum)
+		assert.Equal(t, "date-time", task.Properties["created_at"].Format)
+		assert.Equal(t, "int64", task.Properties["id"].Format)
+		assert.NotContains(t, task.Properties, "user")
+		assert.NotContains(t, task.Required, "uid")
+	}
+
+	request := spec.Components.Schemas["NewTask"]
+	if assert.NotNil(t, request) {
+		assert.Contains(t, request.Properties, "description")
+		assert.Contains(t, request.Properties, "priority")
+	}
+	assert.Contains(t, spec.Components.Schemas, "Credentials")
+	// backup.Task has the same name as models.Task
+	assert.Contains(t, spec.Components.Schemas, "BackupTask")
+
+	update := spec.Paths["/api/tasks/{id}"]["patch"]
+	if assert.NotNil(t, update) && assert.Len(t, update.Parameters, 3) {
+		assert.Equal(t, "id", update.Parameters[0].Name)
+		assert.Equal(t, "path", update.Parameters[0].In)
+		assert.True(t, update.Parameters[0].Required)
+		assert.Equal(t, "If-Match", update.Parameters[1].Name)
+		assert.Equal(t, "Idempotency-Key", update.Parameters[2].Name)
+		assert.Equal(t, "header", update.Parameters[2].In)
+		assert.Contains(t, update.Responses, "412")
+		assert.Contains(t, update.Responses, "422")
+	}
+	list := spec.Paths["/api/v1/tasks"]["get"]
+	if assert.NotNil(t, list) && assert.Len(t, list.Parameters, 1) {
+		assert.Equal(t, "If-None-Match", list.Parameters[0].Name)
+		assert.Contains(t, list.Responses, "304")
+	}
+	assert.Contains(t, spec.Paths["/caldav/tasks"], "x-propfind")
+}
+
+func TestServeSpecAndDocs(t *testing.T) {
+	e := setUpRoutes(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, openapi.Version, doc["openapi"])
+	assert.Contains(t, doc["paths"], "/api/tasks")
+
+	req = httptest.NewRequest(http.MethodGet, "/docs", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMETextHTML)
+	assert.Contains(t, rec.Body.String(), "/openapi.json")
+}
@@ -0,0 +1,65 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pianpianino/routes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrentVersionIsNotDeprecated(t *testing.T) {
+	e := setUpRoutes(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tasks", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// the token is still checked
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Header().Get("Deprecation"))
+	assert.Empty(t, rec.Header().Get("Sunset"))
+}
+
+func TestUnversionedAliasIsDeprecated(t *testing.T) {
+	e := setUpRoutes(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Regexp(t, `^@\d+$`, rec.Header().Get("Deprecation"))
+	sunset, err := http.ParseTime(rec.Header().Get("Sunset"))
+	assert.NoError(t, err)
+	assert.True(t, sunset.After(time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, `</api/v1>; rel="successor-version"`, rec.Header().Get("Link"))
+}
+
+func TestAliasServesTheSameRoutes(t *testing.T) {
+	e := setUpRoutes(t)
+
+	for _, path := range []string{"/api/tasks/1/toggle", "/api/v1/tasks/1/toggle"} {
+		req := httptest.NewRequest(http.MethodPatch, path, nil)
+		req.Header.Set("Authorization", "Bearer invalid")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		// reaches the JWT middleware instead of answering 404
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/tasks", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.NotEqual(t, http.StatusOK, rec.Code)
+}
+
+func TestSpecMarksAliasDeprecated(t *testing.T) {
+	spec := routes.Spec()
+	assert.True(t, spec.Paths["/api/tasks"]["get"].Deprecated)
+	assert.False(t, spec.Paths["/api/v1/tasks"]["get"].Deprecated)
+}
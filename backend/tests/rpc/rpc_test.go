@@ -0,0 +1,228 @@
+package rpc_test
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"pianpianino/config"
+	"pianpianino/models"
+	"pianpianino/rpc"
+	"pianpianino/rpc/pb"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func setUpTestDB(t *testing.T) *bun.DB {
+	ctx := context.Background()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	DB := bun.NewDB(sqlDB, sqlitedialect.New())
+	for _, model := range []interface{}{(*models.User)(nil), (*models.Task)(nil), (*models.TaskChange)(nil)} {
+		if _, err := DB.NewCreateTable().Model(model).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return DB
+}
+
+// dial serves the services on an in-memory listener.
+func dial(t *testing.T) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	server := rpc.NewServer(setUpTestDB(t), &config.Config{JWTSecret: "test-secret"})
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// login registers a user and returns a context carrying its token.
+func login(t *testing.T, conn *grpc.ClientConn, username string) context.Context {
+	ctx := context.Background()
+	auth := pb.NewAuthServiceClient(conn)
+	_, err := auth.Register(ctx, &pb.RegisterRequest{Username: username, Password: "secret"})
+	assert.NoError(t, err)
+	resp, err := auth.Login(ctx, &pb.LoginRequest{Username: username, Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+resp.GetToken())
+}
+
+func reason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
+
+func TestAuthService(t *testing.T) {
+	conn := dial(t)
+	auth := pb.NewAuthServiceClient(conn)
+	login(t, conn, "ada")
+
+	_, err := auth.Register(context.Background(), &pb.RegisterRequest{Username: "ada", Password: "other"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	assert.Equal(t, "username_taken", reason(err))
+
+	_, err = auth.Login(context.Background(), &pb.LoginRequest{Username: "ada", Password: "wrong"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "invalid_credentials", reason(err))
+
+	_, err = auth.Register(context.Background(), &pb.RegisterRequest{Username: "a", Password: "secret"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			violations = badRequest.GetFieldViolations()
+		}
+	}
+	if assert.Len(t, violations, 1) {
+		assert.Equal(t, "username", violations[0].GetField())
+	}
+}
+
+func TestTaskServiceNeedsToken(t *testing.T) {
+	tasks := pb.NewTaskServiceClient(dial(t))
+
+	_, err := tasks.ListTasks(context.Background(), &pb.ListTasksRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nope")
+	_, err = tasks.ListTasks(ctx, &pb.ListTasksRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "invalid_token", reason(err))
+}
+
+func TestTaskServerWithoutAuthenticator(t *testing.T) {
+	// a server registered without the interceptor refuses the calls rather than panic
+	server := &rpc.TaskServer{}
+	_, err := server.ListTasks(context.Background(), &pb.ListTasksRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "invalid_token", reason(err))
+}
+
+func TestTaskService(t *testing.T) {
+	conn := dial(t)
+	ctx := login(t, conn, "ada")
+	tasks := pb.NewTaskServiceClient(conn)
+
+	created, err := tasks.CreateTask(ctx, &pb.CreateTaskRequest{Description: "Write docs", Priority: pb.Priority_PRIORITY_HIGH})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(1), created.GetVersion())
+	assert.Equal(t, pb.Priority_PRIORITY_HIGH, created.GetPriority())
+
+	_, err = tasks.CreateTask(ctx, &pb.CreateTaskRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "validation_failed", reason(err))
+
+	// only the fields of the mask change
+	updated, err := tasks.UpdateTask(ctx, &pb.UpdateTaskRequest{
+		Id:         created.GetId(),
+		Priority:   pb.Priority_PRIORITY_LOW,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"priority"}},
+		Version:    1,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Write docs", updated.GetDescription())
+		assert.Equal(t, pb.Priority_PRIORITY_LOW, updated.GetPriority())
+		assert.Equal(t, int64(2), updated.GetVersion())
+	}
+
+	_, err = tasks.ToggleTask(ctx, &pb.ToggleTaskRequest{Id: created.GetId(), Version: 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, "task_modified", reason(err))
+
+	toggled, err := tasks.ToggleTask(ctx, &pb.ToggleTaskRequest{Id: created.GetId()})
+	if assert.NoError(t, err) {
+		assert.True(t, toggled.GetCompleted())
+	}
+
+	list, err := tasks.ListTasks(ctx, &pb.ListTasksRequest{})
+	if assert.NoError(t, err) {
+		assert.Len(t, list.GetTasks(), 1)
+	}
+
+	// the tasks of other users do not exist for this one
+	other := login(t, conn, "bob")
+	_, err = tasks.GetTask(other, &pb.GetTaskRequest{Id: created.GetId()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = tasks.DeleteTask(ctx, &pb.DeleteTaskRequest{Id: created.GetId(), Version: 3})
+	assert.NoError(t, err)
+	_, err = tasks.GetTask(ctx, &pb.GetTaskRequest{Id: created.GetId()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestReflection(t *testing.T) {
+	stream, err := reflectionpb.NewServerReflectionClient(dial(t)).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var services []string
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	assert.Contains(t, services, "pianpianino.v1.AuthService")
+	assert.Contains(t, services, "pianpianino.v1.TaskService")
+}
+
+func TestServiceShutdown(t *testing.T) {
+	service := &rpc.Service{
+		Server:   rpc.NewServer(setUpTestDB(t), &config.Config{JWTSecret: "test-secret"}),
+		Listener: bufconn.Listen(1 << 20),
+	}
+	served := make(chan error, 1)
+	go func() { served <- service.Serve() }()
+
+	assert.NoError(t, service.Shutdown(context.Background()))
+	assert.NoError(t, <-served)
+}
+
+func TestServiceShutdownBeforeServe(t *testing.T) {
+	service := &rpc.Service{
+		Server:   rpc.NewServer(setUpTestDB(t), &config.Config{JWTSecret: "test-secret"}),
+		Listener: bufconn.Listen(1 << 20),
+	}
+
+	assert.NoError(t, service.Shutdown(context.Background()))
+	assert.NoError(t, service.Serve())
+}
@@ -0,0 +1,344 @@
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"pianpianino/config"
+	"pianpianino/server"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var hello = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, r.Proto)
+})
+
+// start serves hello on a free port of the loopback interface.
+func start(t *testing.T, cfg *config.Config) (*http.Server, net.Listener) {
+	srv, err := server.New(cfg, hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := server.Listen(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(srv, ln)
+	t.Cleanup(func() { srv.Close() })
+	return srv, ln
+}
+
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 0
+	return cfg
+}
+
+func get(t *testing.T, client *http.Client, url string) string {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return string(body)
+}
+
+func TestServeHTTP1(t *testing.T) {
+	cfg := testConfig()
+	srv, ln := start(t, cfg)
+
+	assert.Equal(t, 30*time.Second, srv.ReadTimeout)
+	assert.Equal(t, time.Minute, srv.WriteTimeout)
+	assert.Equal(t, 2*time.Minute, srv.IdleTimeout)
+	assert.True(t, strings.HasPrefix(server.URL(cfg, ln), "http://127.0.0.1:"))
+	assert.Equal(t, "HTTP/1.1", get(t, http.DefaultClient, server.URL(cfg, ln)))
+}
+
+func TestServeUnencryptedHTTP2(t *testing.T) {
+	cfg := testConfig()
+	_, ln := start(t, cfg)
+
+	// clients like reverse proxies know in advance that HTTP/2 is spoken
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	assert.Equal(t, "HTTP/2.0", get(t, &http.Client{Transport: transport}, server.URL(cfg, ln)))
+}
+
+func TestServeSelfSignedHTTP2(t *testing.T) {
+	cfg := testConfig()
+	cfg.TLSSelfSigned = true
+	_, ln := start(t, cfg)
+
+	url := server.URL(cfg, ln)
+	assert.True(t, strings.HasPrefix(url, "https://127.0.0.1:"))
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}
+	assert.Equal(t, "HTTP/2.0", get(t, &http.Client{Transport: transport}, url))
+
+	cfg.HTTP2 = false
+	_, ln = start(t, cfg)
+	assert.Equal(t, "HTTP/1.1", get(t, &http.Client{Transport: transport}, server.URL(cfg, ln)))
+}
+
+func TestSelfSignedCoversHost(t *testing.T) {
+	cert, err := server.SelfSigned("todo.local")
+	if !assert.NoError(t, err) {
+		return
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if assert.NoError(t, err) {
+		assert.NoError(t, leaf.VerifyHostname("localhost"))
+		assert.NoError(t, leaf.VerifyHostname("127.0.0.1"))
+		assert.NoError(t, leaf.VerifyHostname("todo.local"))
+		assert.Error(t, leaf.VerifyHostname("example.com"))
+	}
+}
+
+func TestNewWithMissingCertificate(t *testing.T) {
+	cfg := testConfig()
+	cfg.TLSCert = filepath.Join(t.TempDir(), "cert.pem")
+	cfg.TLSKey = filepath.Join(t.TempDir(), "key.pem")
+
+	_, err := server.New(cfg, hello)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	cfg := testConfig()
+	cfg.Socket = filepath.Join(t.TempDir(), "pianpianino.sock")
+	// left behind by a previous run
+	stale, err := net.Listen("unix", cfg.Socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	_, ln := start(t, cfg)
+	assert.Equal(t, "unix:"+cfg.Socket, server.URL(cfg, ln))
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", cfg.Socket)
+		},
+	}
+	assert.Equal(t, "HTTP/1.1", get(t, &http.Client{Transport: transport}, "http://pianpianino/"))
+}
+
+func TestListenRefusesToReplaceFiles(t *testing.T) {
+	cfg := testConfig()
+	cfg.Socket = filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(cfg.Socket, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := server.Listen(cfg)
+	assert.Error(t, err)
+	content, _ := os.ReadFile(cfg.Socket)
+	assert.Equal(t, "keep me", string(content))
+}
+
+// worker stands for the gRPC server, failing at once when failure is set.
+type worker struct {
+	failure error
+	done    chan struct{}
+	stopped bool
+}
+
+func newWorker(failure error) *worker {
+	return &worker{failure: failure, done: make(chan struct{})}
+}
+
+func (w *worker) Serve() error {
+	if w.failure != nil {
+		return w.failure
+	}
+	<-w.done
+	return nil
+}
+
+func (w *worker) Shutdown(ctx context.Context) error {
+	w.stopped = true
+	close(w.done)
+	return nil
+}
+
+// slowHandler answers once release is closed, telling started about the
+// requests it received.
+func slowHandler(started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		io.WriteString(w, "done")
+	})
+}
+
+func run(cfg *config.Config, handler http.Handler, workers ...server.Worker) (context.CancelFunc, net.Listener, <-chan error, error) {
+	srv, err := server.New(cfg, handler)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ln, err := server.Listen(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- server.Run(ctx, srv, ln, cfg.ShutdownTimeout, workers...) }()
+	return cancel, ln, result, nil
+}
+
+func TestRunDrainsRequestsInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	w := newWorker(nil)
+	cancel, ln, result, err := run(testConfig(), slowHandler(started, release), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{string(body), err}
+	}()
+	<-started
+
+	cancel()
+	// new connections are refused while the request is running
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case err := <-result:
+		t.Fatalf("Run returned before the request finished: %v", err)
+	default:
+	}
+
+	close(release)
+	resp := <-responses
+	assert.NoError(t, resp.err)
+	assert.Equal(t, "done", resp.body)
+	assert.NoError(t, <-result)
+	assert.True(t, w.stopped)
+}
+
+func TestRunInterruptsSlowRequests(t *testing.T) {
+	cfg := testConfig()
+	cfg.ShutdownTimeout = 50 * time.Millisecond
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	cancel, ln, result, err := run(cfg, slowHandler(started, release))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		failed <- err
+	}()
+	<-started
+
+	cancel()
+	err = <-result
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "requests still running after 50ms were interrupted")
+	assert.Error(t, <-failed)
+}
+
+func TestRunStopsWhenAWorkerFails(t *testing.T) {
+	failure := errors.New("address already in use")
+	w := newWorker(nil)
+	cancel, ln, result, err := run(testConfig(), hello, newWorker(failure), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	assert.Equal(t, failure, <-result)
+	assert.True(t, w.stopped)
+	_, err = net.Dial("tcp", ln.Addr().String())
+	assert.Error(t, err)
+}
+
+// failingWorker fails once fail is closed.
+type failingWorker struct {
+	fail chan struct{}
+	err  error
+}
+
+func (w *failingWorker) Serve() error {
+	<-w.fail
+	return w.err
+}
+
+func (w *failingWorker) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestRunInterruptsSlowRequestsAfterAFailure(t *testing.T) {
+	cfg := testConfig()
+	cfg.ShutdownTimeout = 50 * time.Millisecond
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	failure := &failingWorker{fail: make(chan struct{}), err: errors.New("address already in use")}
+	cancel, ln, result, err := run(cfg, slowHandler(started, release), failure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	failed := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		failed <- err
+	}()
+	<-started
+
+	close(failure.fail)
+	assert.Equal(t, failure.err, <-result)
+	select {
+	case err := <-failed:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the request still running was not interrupted")
+	}
+}
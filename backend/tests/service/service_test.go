@@ -0,0 +1,133 @@
+package service_test
+
+import (
+	"context"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/repository"
+	"pianpianino/service"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTaskService() *service.TaskService {
+	return service.NewTaskService(repository.NewMemoryTasks())
+}
+
+func code(err error) problem.Code {
+	return problem.From(err).Code
+}
+
+func TestCreateTaskValidates(t *testing.T) {
+	tasks := newTaskService()
+	ctx := context.Background()
+
+	_, err := tasks.Create(ctx, 1, service.NewTask{})
+	assert.Equal(t, problem.CodeValidation, code(err))
+	_, err = tasks.Create(ctx, 1, service.NewTask{Description: "Task", Priority: models.Importance(9)})
+	assert.Equal(t, problem.CodeValidation, code(err))
+
+	task, err := tasks.Create(ctx, 1, service.NewTask{Description: "Task", Priority: models.High})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), task.Version)
+		assert.Equal(t, models.High, task.Priority)
+	}
+}
+
+func TestTaskPreconditions(t *testing.T) {
+	tasks := newTaskService()
+	ctx := context.Background()
+	task, _ := tasks.Create(ctx, 1, service.NewTask{Description: "Task"})
+
+	description := "Edited"
+	updated, err := tasks.Update(ctx, 1, task.ID, service.TaskPatch{Description: &description}, service.Version(1))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Edited", updated.Description)
+		assert.Equal(t, int64(2), updated.Version)
+	}
+
+	_, err = tasks.Toggle(ctx, 1, task.ID, service.Version(1))
+	assert.Equal(t, problem.CodeTaskModified, code(err))
+	toggled, err := tasks.Toggle(ctx, 1, task.ID, nil)
+	if assert.NoError(t, err) {
+		assert.True(t, toggled.Completed)
+	}
+
+	// the tasks of other users are not found
+	_, err = tasks.Toggle(ctx, 2, task.ID, nil)
+	assert.Equal(t, problem.CodeTaskNotFound, code(err))
+
+	assert.NoError(t, tasks.Delete(ctx, 1, task.ID, service.Version(3)))
+	assert.Equal(t, problem.CodeTaskNotFound, code(tasks.Delete(ctx, 1, task.ID, nil)))
+	// no version matches a task that is gone
+	assert.Equal(t, problem.CodeTaskModified, code(tasks.Delete(ctx, 1, task.ID, service.Version(3))))
+}
+
+func TestTaskAtomic(t *testing.T) {
+	tasks := newTaskService()
+	ctx := context.Background()
+
+	err := tasks.Atomic(ctx, func(ctx context.Context, tasks *service.TaskService) error {
+		if _, err := tasks.Create(ctx, 1, service.NewTask{Description: "Discarded"}); err != nil {
+			return err
+		}
+		_, err := tasks.Toggle(ctx, 1, 42, nil)
+		return err
+	})
+	assert.Equal(t, problem.CodeTaskNotFound, code(err))
+
+	list, err := tasks.List(ctx, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	users := service.NewUserService(repository.NewMemoryUsers(), "test-secret")
+	ctx := context.Background()
+
+	user, err := users.Register(ctx, service.Registration{Username: "ada", Password: "secret"})
+	assert.NoError(t, err)
+	_, err = users.Register(ctx, service.Registration{Username: "ada", Password: "other"})
+	assert.Equal(t, problem.CodeUsernameTaken, code(err))
+	_, err = users.Register(ctx, service.Registration{Username: "a", Password: "secret"})
+	assert.Equal(t, problem.CodeValidation, code(err))
+
+	_, err = users.Login(ctx, service.Credentials{Username: "ada", Password: "wrong"})
+	assert.Equal(t, problem.CodeInvalidCredentials, code(err))
+	_, err = users.Login(ctx, service.Credentials{Username: "bob", Password: "secret"})
+	assert.Equal(t, problem.CodeInvalidCredentials, code(err))
+
+	token, err := users.Login(ctx, service.Credentials{Username: "ada", Password: "secret"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+		return []byte("test-secret"), nil
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, float64(user.ID), parsed.Claims.(jwt.MapClaims)["user_id"])
+	}
+}
+
+func TestLoginTokenTTL(t *testing.T) {
+	users := service.NewUserService(repository.NewMemoryUsers(), "test-secret")
+	users.TokenTTL = 15 * time.Minute
+	ctx := context.Background()
+
+	_, err := users.Register(ctx, service.Registration{Username: "ada", Password: "secret"})
+	assert.NoError(t, err)
+	token, err := users.Login(ctx, service.Credentials{Username: "ada", Password: "secret"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+		return []byte("test-secret"), nil
+	})
+	if assert.NoError(t, err) {
+		expires, _ := parsed.Claims.GetExpirationTime()
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), expires.Time, 5*time.Second)
+	}
+}
@@ -0,0 +1,217 @@
+package tasksync_test
+
+import (
+	"context"
+	"database/sql"
+	"pianpianino/models"
+	"pianpianino/tasksync"
+	"pianpianino/tests/testdb"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func setUpTestDB(t *testing.T) *bun.DB {
+	ctx := context.Background()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	DB := bun.NewDB(sqlDB, sqlitedialect.New())
+	for _, model := range []interface{}{(*models.User)(nil), (*models.Task)(nil), (*models.TaskChange)(nil), (*models.SyncMutation)(nil)} {
+		if _, err := DB.NewCreateTable().Model(model).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return DB
+}
+
+func push(t *testing.T, DB *bun.DB, userID int64, mutations ...tasksync.Mutation) []tasksync.Outcome {
+	outcomes, err := tasksync.Push(context.Background(), DB, userID, mutations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outcomes
+}
+
+func pull(t *testing.T, DB *bun.DB, userID, since int64, limit int) *tasksync.Delta {
+	delta, err := tasksync.Pull(context.Background(), DB, userID, since, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return delta
+}
+
+func TestPullFollowsChanges(t *testing.T) {
+	DB := setUpTestDB(t)
+
+	created := push(t, DB, 1,
+		tasksync.Mutation{Op: tasksync.OpPut, Description: "First"},
+		tasksync.Mutation{Op: tasksync.OpPut, Description: "Second"},
+	)
+	first, second := created[0].Task, created[1].Task
+
+	full := pull(t, DB, 1, 0, 0)
+	assert.False(t, full.More)
+	assert.Len(t, full.Tasks, 2)
+	assert.Empty(t, full.Deleted)
+	assert.Empty(t, pull(t, DB, 1, full.Cursor, 0).Tasks)
+
+	push(t, DB, 1,
+		tasksync.Mutation{Op: tasksync.OpPut, ID: first.ID, BaseVersion: 1, Description: "First", Completed: true},
+		tasksync.Mutation{Op: tasksync.OpDelete, ID: second.ID, BaseVersion: 1},
+	)
+	delta := pull(t, DB, 1, full.Cursor, 0)
+	if assert.Len(t, delta.Tasks, 1) {
+		assert.True(t, delta.Tasks[0].Completed)
+		assert.Equal(t, int64(2), delta.Tasks[0].Version)
+	}
+	assert.Equal(t, []int64{second.ID}, delta.Deleted)
+	assert.Greater(t, delta.Cursor, full.Cursor)
+
+	// a full sync only sees the last change of every task
+	full = pull(t, DB, 1, 0, 0)
+	assert.Len(t, full.Tasks, 1)
+	assert.Equal(t, []int64{second.ID}, full.Deleted)
+}
+
+func TestPullPages(t *testing.T) {
+	DB := setUpTestDB(t)
+	for i := 0; i < 3; i++ {
+		push(t, DB, 1, tasksync.Mutation{Op: tasksync.OpPut, Description: "Task"})
+	}
+
+	page := pull(t, DB, 1, 0, 2)
+	assert.True(t, page.More)
+	assert.Len(t, page.Tasks, 2)
+
+	page = pull(t, DB, 1, page.Cursor, 2)
+	assert.False(t, page.More)
+	assert.Len(t, page.Tasks, 1)
+}
+
+func TestPullIsPerUser(t *testing.T) {
+	DB := setUpTestDB(t)
+	push(t, DB, 1, tasksync.Mutation{Op: tasksync.OpPut, Description: "Mine"})
+	push(t, DB, 2, tasksync.Mutation{Op: tasksync.OpPut, Description: "Theirs"})
+
+	delta := pull(t, DB, 1, 0, 0)
+	if assert.Len(t, delta.Tasks, 1) {
+		assert.Equal(t, "Mine", delta.Tasks[0].Description)
+	}
+}
+
+func TestPushConflicts(t *testing.T) {
+	DB := setUpTestDB(t)
+	task := push(t, DB, 1, tasksync.Mutation{Op: tasksync.OpPut, ClientID: "local-1", Description: "Task"})[0]
+	assert.Equal(t, tasksync.StatusApplied, task.Status)
+	assert.Equal(t, "local-1", task.ClientID)
+
+	// two devices edit the first version, the second one loses
+	outcomes := push(t, DB, 1,
+		tasksync.Mutation{Op: tasksync.OpPut, ID: task.ID, BaseVersion: 1, Description: "Phone"},
+		tasksync.Mutation{Op: tasksync.OpPut, ID: task.ID, BaseVersion: 1, Description: "Laptop"},
+		tasksync.Mutation{Op: tasksync.OpDelete, ID: task.ID, BaseVersion: 1},
+	)
+	assert.Equal(t, tasksync.StatusApplied, outcomes[0].Status)
+	assert.Equal(t, tasksync.StatusConflict, outcomes[1].Status)
+	assert.Equal(t, "Phone", outcomes[1].Task.Description)
+	assert.Equal(t, int64(2), outcomes[1].Task.Version)
+	assert.Equal(t, tasksync.StatusConflict, outcomes[2].Status)
+
+	outcomes = push(t, DB, 1,
+		tasksync.Mutation{Op: tasksync.OpDelete, ID: task.ID, BaseVersion: 2},
+		tasksync.Mutation{Op: tasksync.OpDelete, ID: task.ID, BaseVersion: 2},
+		tasksync.Mutation{Op: tasksync.OpPut, ID: task.ID, BaseVersion: 2, Description: "Edited offline"},
+	)
+	assert.Equal(t, tasksync.StatusApplied, outcomes[0].Status)
+	// the task is already gone, deleting it again is fine but editing it is not
+	assert.Equal(t, tasksync.StatusApplied, outcomes[1].Status)
+	assert.True(t, outcomes[1].Deleted)
+	assert.Equal(t, tasksync.StatusConflict, outcomes[2].Status)
+	assert.True(t, outcomes[2].Deleted)
+}
+
+func TestPushReplaysClientIDs(t *testing.T) {
+	DB := setUpTestDB(t)
+	create := tasksync.Mutation{Op: tasksync.OpPut, ClientID: "local-1", Description: "Created offline"}
+
+	first := push(t, DB, 1, create)[0]
+	// the client lost the response and pushes its queue again
+	outcomes := push(t, DB, 1, tasksync.Mutation{Op: tasksync.OpPut, Description: "Other"}, create)
+	assert.Equal(t, 1, outcomes[1].Index)
+	assert.Equal(t, "local-1", outcomes[1].ClientID)
+	assert.Equal(t, tasksync.StatusApplied, outcomes[1].Status)
+	assert.Equal(t, first.ID, outcomes[1].ID)
+	assert.Equal(t, first.Task.Version, outcomes[1].Task.Version)
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Where("description = ?", "Created offline").Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// client IDs are per user
+	other := push(t, DB, 2, create)[0]
+	assert.NotEqual(t, first.ID, other.ID)
+}
+
+// TestConcurrentPushesApplyOnce races pushes of the same mutation, which
+// only run concurrently on the database named by testdb.EnvDSN: SQLite in
+// memory has a single connection.
+func TestConcurrentPushesApplyOnce(t *testing.T) {
+	DB := testdb.Open(t, (*models.User)(nil), (*models.Task)(nil), (*models.TaskChange)(nil), (*models.SyncMutation)(nil))
+	if DB.Dialect().Name() == dialect.SQLite {
+		// every connection to :memory: opens another database
+		DB.SetMaxOpenConns(1)
+	}
+	create := tasksync.Mutation{Op: tasksync.OpPut, ClientID: "local-1", Description: "Created offline"}
+
+	const pushes = 8
+	outcomes := make([]tasksync.Outcome, pushes)
+	errs := make([]error, pushes)
+	var wg sync.WaitGroup
+	for i := range pushes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var pushed []tasksync.Outcome
+			pushed, errs[i] = tasksync.Push(context.Background(), DB, 1, []tasksync.Mutation{create})
+			if errs[i] == nil {
+				outcomes[i] = pushed[0]
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range pushes {
+		if assert.NoError(t, errs[i]) {
+			assert.Equal(t, tasksync.StatusApplied, outcomes[i].Status)
+			assert.Equal(t, outcomes[0].ID, outcomes[i].ID)
+		}
+	}
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestRecordChangeKeepsLastChange(t *testing.T) {
+	DB := setUpTestDB(t)
+	ctx := context.Background()
+
+	for _, deleted := range []bool{false, false, true} {
+		assert.NoError(t, models.RecordChange(ctx, DB, 1, deleted, 7))
+	}
+
+	var changes []models.TaskChange
+	assert.NoError(t, DB.NewSelect().Model(&changes).Scan(ctx))
+	if assert.Len(t, changes, 1) {
+		assert.True(t, changes[0].Deleted)
+		assert.Equal(t, int64(3), changes[0].ID)
+	}
+}
@@ -0,0 +1,143 @@
+package todotxt_test
+
+import (
+	"bytes"
+	"context"
+	"pianpianino/models"
+	"pianpianino/tests/testdb"
+	"pianpianino/todotxt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLineOpenTask(t *testing.T) {
+	item := todotxt.ParseLine("(A) 2025-01-02 Call mum +family @phone")
+
+	assert.False(t, item.Completed)
+	assert.Equal(t, byte('A'), item.Priority)
+	assert.Equal(t, time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), item.CreationDate)
+	assert.True(t, item.CompletionDate.IsZero())
+	assert.Equal(t, "Call mum +family @phone", item.Description)
+	assert.Equal(t, []string{"family"}, item.Projects)
+	assert.Equal(t, []string{"phone"}, item.Contexts)
+}
+
+func TestParseLineCompletedTask(t *testing.T) {
+	item := todotxt.ParseLine("x 2025-01-05 2025-01-02 Pay the rent pri:B")
+
+	assert.True(t, item.Completed)
+	assert.Equal(t, byte('B'), item.Priority)
+	assert.Equal(t, time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC), item.CompletionDate)
+	assert.Equal(t, time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), item.CreationDate)
+	assert.Equal(t, "Pay the rent", item.Description)
+}
+
+func TestParseLineIsNotConfusedByLookalikes(t *testing.T) {
+	item := todotxt.ParseLine("xylophone lessons (B) later")
+
+	assert.False(t, item.Completed)
+	assert.Equal(t, byte(0), item.Priority)
+	assert.Equal(t, "xylophone lessons (B) later", item.Description)
+}
+
+func TestImportanceMapping(t *testing.T) {
+	assert.Equal(t, models.High, todotxt.Importance('A'))
+	assert.Equal(t, models.Medium, todotxt.Importance('B'))
+	assert.Equal(t, models.Low, todotxt.Importance('C'))
+	assert.Equal(t, models.Low, todotxt.Importance('F'))
+	assert.Equal(t, models.NotSet, todotxt.Importance(0))
+}
+
+func TestRoundTrip(t *testing.T) {
+	lines := []string{
+		"(A) 2025-01-02 Call mum +family @phone",
+		"x 2025-01-05 2025-01-02 Pay the rent pri:B",
+		"2025-01-03 Water the plants",
+		"x 2025-01-04 2025-01-04 Buy milk @shop",
+		"(D) 2025-01-06 Plan the trip +holidays @home",
+		"(B) Book the dentist",
+		"x 2025-01-08 Return the books @library",
+		"x Undated and done",
+	}
+
+	items, err := todotxt.Parse(strings.NewReader(strings.Join(lines, "\n") + "\n\n"))
+	assert.NoError(t, err)
+	assert.Len(t, items, 8)
+
+	tasks := make([]models.Task, 0, len(items))
+	for _, item := range items {
+		tasks = append(tasks, todotxt.ToTask(item, 1))
+	}
+
+	var out strings.Builder
+	assert.NoError(t, todotxt.Write(&out, tasks))
+	assert.Equal(t, strings.Join(lines, "\n")+"\n", out.String())
+}
+
+func TestImportExportRoundTrip(t *testing.T) {
+	DB := testdb.Open(t, (*models.User)(nil), (*models.Task)(nil), (*models.TaskChange)(nil))
+	ctx := context.Background()
+	user := &models.User{Username: "alice", Password: "hash"}
+	_, err := DB.NewInsert().Model(user).Exec(ctx)
+	assert.NoError(t, err)
+
+	file := "(D) 2025-01-06 Plan the trip +holidays @home\n" +
+		"x 2025-01-05 2025-01-02 Pay the rent +flat pri:B\n" +
+		"(A) 2025-01-07 Call mum @phone\n" +
+		"Water the plants\n" +
+		"x 2024-01-02 Renew the passport pri:C\n"
+	imported, err := todotxt.Import(ctx, DB, user.ID, strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, imported)
+
+	task := new(models.Task)
+	err = DB.NewSelect().Model(task).Where("importance = ?", models.Low).Scan(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"holidays"}, task.Projects)
+		assert.Equal(t, []string{"home"}, task.Contexts)
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, todotxt.Export(ctx, DB, user.ID, &out))
+	assert.Equal(t, file, out.String())
+}
+
+func TestImportRejectsInvalidLines(t *testing.T) {
+	DB := testdb.Open(t, (*models.User)(nil), (*models.Task)(nil), (*models.TaskChange)(nil))
+	ctx := context.Background()
+	user := &models.User{Username: "alice", Password: "hash"}
+	_, err := DB.NewInsert().Model(user).Exec(ctx)
+	assert.NoError(t, err)
+
+	file := "Call mum\n\nx 2025-01-05\n" + strings.Repeat("a", models.MaxDescription+1) + "\n"
+	_, err = todotxt.Import(ctx, DB, user.ID, strings.NewReader(file))
+	var invalid todotxt.InvalidLines
+	if assert.ErrorAs(t, err, &invalid) && assert.Len(t, invalid, 2) {
+		assert.Equal(t, 3, invalid[0].Line)
+		assert.Equal(t, 4, invalid[1].Line)
+	}
+
+	_, err = todotxt.Import(ctx, DB, user.ID, strings.NewReader("Call mum\n"+strings.Repeat("a", 70000)+"\n"))
+	if assert.ErrorAs(t, err, &invalid) && assert.Len(t, invalid, 1) {
+		assert.Equal(t, 2, invalid[0].Line)
+	}
+
+	count, err := DB.NewSelect().Model((*models.Task)(nil)).Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestFromTaskAfterEdits(t *testing.T) {
+	task := todotxt.ToTask(todotxt.ParseLine("x 2025-01-05 2025-01-02 Pay the rent +flat pri:D"), 1)
+	// edited later, through the API
+	task.Description = "Pay the rent"
+	task.UpdatedAt = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "x 2025-01-05 2025-01-02 Pay the rent +flat pri:D", todotxt.FromTask(task).String())
+
+	task.Priority = models.High
+	task.SetCompleted(false, time.Now())
+	assert.Equal(t, "(A) 2025-01-02 Pay the rent +flat", todotxt.FromTask(task).String())
+}
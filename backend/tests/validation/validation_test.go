@@ -0,0 +1,93 @@
+package validation_test
+
+import (
+	"errors"
+	"pianpianino/backup"
+	"pianpianino/handlers"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"pianpianino/service"
+	"pianpianino/validation"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fieldErrors(t *testing.T, err error) map[string]string {
+	var p *problem.Problem
+	if !assert.True(t, errors.As(err, &p), "expected a problem, got %v", err) {
+		return nil
+	}
+	assert.Equal(t, problem.CodeValidation, p.Code)
+	fields := make(map[string]string)
+	for _, fe := range p.Errors {
+		fields[fe.Field] = fe.Code
+	}
+	return fields
+}
+
+func TestValidTaskRequest(t *testing.T) {
+	v := validation.New()
+	err := v.Validate(&service.NewTask{Description: "Buy milk", Priority: models.High})
+	assert.NoError(t, err)
+}
+
+func TestTaskRequestRules(t *testing.T) {
+	v := validation.New()
+
+	fields := fieldErrors(t, v.Validate(&service.NewTask{Priority: models.Importance(7)}))
+	assert.Equal(t, map[string]string{
+		"description": problem.FieldRequired,
+		"priority":    problem.FieldNotAllowed,
+	}, fields)
+
+	fields = fieldErrors(t, v.Validate(&service.NewTask{Description: strings.Repeat("a", 1001)}))
+	assert.Equal(t, map[string]string{"description": problem.FieldTooLong}, fields)
+}
+
+func TestTaskUpdateRequestOnlyChecksPresentFields(t *testing.T) {
+	v := validation.New()
+	assert.NoError(t, v.Validate(&handlers.TaskUpdateRequest{}))
+
+	empty := ""
+	fields := fieldErrors(t, v.Validate(&handlers.TaskUpdateRequest{Description: &empty}))
+	assert.Equal(t, map[string]string{"description": problem.FieldTooShort}, fields)
+}
+
+func TestRegisterRequestUsername(t *testing.T) {
+	v := validation.New()
+	for _, username := range []string{"bob", "mario.rossi", "user_1-a"} {
+		assert.NoError(t, v.Validate(&service.Registration{Username: username, Password: "secret"}), username)
+	}
+	for _, username := range []string{"ab", "has space", "semi;colon", strings.Repeat("a", 33)} {
+		fields := fieldErrors(t, v.Validate(&service.Registration{Username: username, Password: "secret"}))
+		assert.Equal(t, problem.FieldInvalid, fields["username"], username)
+	}
+
+	fields := fieldErrors(t, v.Validate(&service.Registration{Username: "bob", Password: strings.Repeat("a", 73)}))
+	assert.Equal(t, map[string]string{"password": problem.FieldTooLong}, fields)
+}
+
+func TestLoginDoesNotCheckTheUsernameFormat(t *testing.T) {
+	// users registered before the rules must still be able to log in
+	v := validation.New()
+	assert.NoError(t, v.Validate(&service.Credentials{Username: "a b", Password: "x"}))
+}
+
+func TestBackupDateOrdering(t *testing.T) {
+	v := validation.New()
+	created := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	doc := &backup.Document{Version: backup.Version, Tasks: []backup.Task{
+		{Description: "in order", CreatedAt: created, UpdatedAt: created.Add(time.Hour)},
+		{Description: "no update date", CreatedAt: created},
+		{Description: "out of order", CreatedAt: created, UpdatedAt: created.Add(-time.Hour)},
+	}}
+	fields := fieldErrors(t, v.Validate(doc))
+	assert.Equal(t, map[string]string{"tasks[2].updated_at": problem.FieldOutOfOrder}, fields)
+
+	doc.Tasks = doc.Tasks[:2]
+	assert.NoError(t, v.Validate(doc))
+}
@@ -0,0 +1,104 @@
+package todotxt
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"pianpianino/models"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/uptrace/bun"
+)
+
+// InvalidLines lists the lines of a todo.txt file that cannot be imported.
+type InvalidLines []*LineError
+
+func (e InvalidLines) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, line := range e {
+		messages = append(messages, line.Error())
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Import parses a todo.txt file and stores every item as a task of the user.
+// Either all the items are imported or none of them is, the lines that
+// cannot be read or stored are reported as InvalidLines.
+func Import(ctx context.Context, DB *bun.DB, userID int64, r io.Reader) (int, error) {
+	items, err := Parse(r)
+	var lineErr *LineError
+	if errors.As(err, &lineErr) {
+		return 0, InvalidLines{lineErr}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := check(items); err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	tasks := make([]models.Task, 0, len(items))
+	for _, item := range items {
+		tasks = append(tasks, ToTask(item, userID))
+	}
+
+	// bun picks the inserted columns from the first row of a bulk insert,
+	// which drops defaulted columns that are zero there but set elsewhere
+	err = DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		for i := range tasks {
+			_, err := tx.NewInsert().
+				Model(&tasks[i]).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			if err := models.RecordChange(ctx, tx, userID, false, tasks[i].ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(tasks), nil
+}
+
+// Export writes every task of the user as a todo.txt file, in the order they
+// were added, which gives back the lines of an imported file in their order.
+func Export(ctx context.Context, DB bun.IDB, userID int64, w io.Writer) error {
+	tasks := make([]models.Task, 0)
+	err := DB.NewSelect().
+		Model(&tasks).
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	return Write(w, tasks)
+}
+
+// check applies the rules of the description of a task to every item.
+func check(items []Item) error {
+	var invalid InvalidLines
+	for _, item := range items {
+		switch length := utf8.RuneCountInString(item.Description); {
+		case length == 0:
+			invalid = append(invalid, &LineError{Line: item.Line, Reason: "the description is empty"})
+		case length > models.MaxDescription:
+			invalid = append(invalid, &LineError{Line: item.Line,
+				Reason: "the description is longer than " + strconv.Itoa(models.MaxDescription) + " characters"})
+		}
+	}
+	if len(invalid) > 0 {
+		return invalid
+	}
+	return nil
+}
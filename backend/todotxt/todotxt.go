@@ -0,0 +1,263 @@
+package todotxt
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"pianpianino/models"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Item is a single line of a todo.txt file, see
+// https://github.com/todotxt/todo.txt for the format.
+type Item struct {
+	// Line is the number of the line in the file, from 1
+	Line           int
+	Completed      bool
+	Priority       byte // 'A' to 'Z', 0 when the item has no priority
+	CompletionDate time.Time
+	CreationDate   time.Time
+	// Description keeps +project and @context tokens inline, as in the file
+	Description string
+	Projects    []string
+	Contexts    []string
+}
+
+// LineError tells why a line of a todo.txt file cannot be imported.
+type LineError struct {
+	Line   int
+	Reason string
+}
+
+func (e *LineError) Error() string {
+	return "line " + strconv.Itoa(e.Line) + ": " + e.Reason
+}
+
+// Parse reads every non blank line of a todo.txt file. A line too long to be
+// read is reported as a *LineError.
+func Parse(r io.Reader) ([]Item, error) {
+	items := make([]Item, 0)
+	scanner := bufio.NewScanner(r)
+	number := 0
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		item := ParseLine(line)
+		item.Line = number
+		items = append(items, item)
+	}
+	if err := scanner.Err(); errors.Is(err, bufio.ErrTooLong) {
+		return nil, &LineError{Line: number + 1, Reason: "longer than " + strconv.Itoa(bufio.MaxScanTokenSize) + " bytes"}
+	} else if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func ParseLine(line string) Item {
+	var item Item
+	rest := line
+
+	if strings.HasPrefix(rest, "x ") {
+		item.Completed = true
+		rest = strings.TrimLeft(rest[2:], " ")
+	}
+	if len(rest) >= 4 && rest[0] == '(' && rest[2] == ')' && rest[3] == ' ' && isPriority(rest[1]) {
+		item.Priority = rest[1]
+		rest = strings.TrimLeft(rest[4:], " ")
+	}
+
+	// a completed item may carry a completion date followed by a creation
+	// date, an open one only a creation date
+	first, ok := cutDate(&rest)
+	if ok {
+		second, ok := cutDate(&rest)
+		switch {
+		case ok && item.Completed:
+			item.CompletionDate, item.CreationDate = first, second
+		case item.Completed:
+			item.CompletionDate = first
+		default:
+			item.CreationDate = first
+			if ok {
+				// not a valid layout, keep the second date as text
+				rest = second.Format(dateLayout) + " " + rest
+			}
+		}
+	}
+
+	// completed items conventionally move their priority to a pri: tag
+	var words []string
+	for _, word := range strings.Fields(rest) {
+		if p, found := strings.CutPrefix(word, "pri:"); found && item.Completed && item.Priority == 0 &&
+			len(p) == 1 && isPriority(p[0]) {
+			item.Priority = p[0]
+			continue
+		}
+		words = append(words, word)
+	}
+	item.Description = strings.Join(words, " ")
+	item.Projects, item.Contexts = tags(item.Description)
+
+	return item
+}
+
+func tags(description string) (projects, contexts []string) {
+	for _, word := range strings.Fields(description) {
+		switch {
+		case len(word) > 1 && word[0] == '+':
+			projects = append(projects, word[1:])
+		case len(word) > 1 && word[0] == '@':
+			contexts = append(contexts, word[1:])
+		}
+	}
+	return projects, contexts
+}
+
+func (item Item) String() string {
+	var b strings.Builder
+	if item.Completed {
+		b.WriteString("x ")
+	}
+	if item.Priority != 0 && !item.Completed {
+		b.WriteString("(" + string(item.Priority) + ") ")
+	}
+	if item.Completed && !item.CompletionDate.IsZero() {
+		b.WriteString(item.CompletionDate.Format(dateLayout) + " ")
+	}
+	if !item.CreationDate.IsZero() {
+		b.WriteString(item.CreationDate.Format(dateLayout) + " ")
+	}
+	b.WriteString(item.Description)
+	if item.Priority != 0 && item.Completed {
+		b.WriteString(" pri:" + string(item.Priority))
+	}
+	return b.String()
+}
+
+// Importance maps (A), (B) and (C) onto High, Medium and Low. The priorities
+// below (C) have no counterpart and are treated as Low, ToTask keeps their
+// letter for the export.
+func Importance(priority byte) models.Importance {
+	switch {
+	case priority == 'A':
+		return models.High
+	case priority == 'B':
+		return models.Medium
+	case isPriority(priority):
+		return models.Low
+	default:
+		return models.NotSet
+	}
+}
+
+func Priority(i models.Importance) byte {
+	switch i {
+	case models.High:
+		return 'A'
+	case models.Medium:
+		return 'B'
+	case models.Low:
+		return 'C'
+	default:
+		return 0
+	}
+}
+
+// ToTask converts an item into a task, keeping what FromTask needs to give
+// back the same line: the priority letter, the dates and the tags.
+func ToTask(item Item, userID int64) models.Task {
+	task := models.Task{
+		UserID:         userID,
+		Description:    item.Description,
+		Priority:       Importance(item.Priority),
+		Completed:      item.Completed,
+		CompletedAt:    item.CompletionDate,
+		Projects:       item.Projects,
+		Contexts:       item.Contexts,
+		TodoTxtUndated: item.CreationDate.IsZero(),
+		CreatedAt:      item.CreationDate,
+		UpdatedAt:      item.CompletionDate,
+	}
+	if item.Priority != 0 {
+		task.TodoTxtPriority = string(item.Priority)
+	}
+	if task.UpdatedAt.IsZero() {
+		task.UpdatedAt = task.CreatedAt
+	}
+	return task
+}
+
+// FromTask converts a task into an item. The imported priority letter is
+// kept unless the priority was changed since, a task imported without a
+// creation date is given none, and the tags missing from the description are
+// appended to it.
+func FromTask(task models.Task) Item {
+	item := Item{
+		Completed:   task.Completed,
+		Priority:    Priority(task.Priority),
+		Description: task.Description,
+	}
+	if !task.TodoTxtUndated {
+		item.CreationDate = dateOnly(task.CreatedAt)
+	}
+	if letter := task.TodoTxtPriority; len(letter) == 1 && Importance(letter[0]) == task.Priority {
+		item.Priority = letter[0]
+	}
+	if task.Completed {
+		item.CompletionDate = dateOnly(task.CompletedAt)
+	}
+
+	projects, contexts := tags(task.Description)
+	for _, project := range task.Projects {
+		if !slices.Contains(projects, project) {
+			item.Description += " +" + project
+		}
+	}
+	for _, context := range task.Contexts {
+		if !slices.Contains(contexts, context) {
+			item.Description += " @" + context
+		}
+	}
+	item.Projects, item.Contexts = tags(item.Description)
+	return item
+}
+
+func Write(w io.Writer, tasks []models.Task) error {
+	bw := bufio.NewWriter(w)
+	for _, task := range tasks {
+		if _, err := bw.WriteString(FromTask(task).String() + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func isPriority(b byte) bool {
+	return b >= 'A' && b <= 'Z'
+}
+
+func cutDate(s *string) (time.Time, bool) {
+	word, rest, _ := strings.Cut(*s, " ")
+	date, err := time.Parse(dateLayout, word)
+	if err != nil {
+		return time.Time{}, false
+	}
+	*s = strings.TrimLeft(rest, " ")
+	return date, true
+}
+
+func dateOnly(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
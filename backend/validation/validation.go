@@ -0,0 +1,135 @@
+// Package validation checks requests against their `validate` struct tags,
+// see github.com/go-playground/validator for the built-in rules. Besides
+// those it knows:
+//   - importance: a models.Importance between NotSet and High
+//   - username: 3 to 32 letters, digits, dots, dashes or underscores
+//   - not_before=name: a time not before the field with that JSON name,
+//     zero times pass
+package validation
+
+import (
+	"errors"
+	"pianpianino/models"
+	"pianpianino/problem"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,32}$`)
+
+// Validator implements echo.Validator, failures are reported as a
+// problem.Problem with one error per field.
+type Validator struct {
+	validate *validator.Validate
+}
+
+// Default is used by the handlers when echo has no validator, as in tests.
+var Default = New()
+
+func New() *Validator {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// fields are reported by the name clients send
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	v.RegisterValidation("importance", func(fl validator.FieldLevel) bool {
+		i, ok := fl.Field().Interface().(models.Importance)
+		return ok && i >= models.NotSet && i <= models.High
+	})
+	v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernamePattern.MatchString(fl.Field().String())
+	})
+	v.RegisterValidation("not_before", func(fl validator.FieldLevel) bool {
+		t, ok := fl.Field().Interface().(time.Time)
+		other, found := fieldByJSONName(fl.Parent(), fl.Param())
+		if !ok || !found {
+			return false
+		}
+		start, ok := other.Interface().(time.Time)
+		return !ok || t.IsZero() || start.IsZero() || !t.Before(start)
+	})
+	return &Validator{validate: v}
+}
+
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	for i := 0; i < v.NumField(); i++ {
+		tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func (v *Validator) Validate(i interface{}) error {
+	err := v.validate.Struct(i)
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return err
+	}
+
+	p := problem.Validation()
+	for _, fe := range fieldErrors {
+		code, message := describe(fe)
+		p.Field(fieldPath(fe), code, message)
+	}
+	return p
+}
+
+// fieldPath drops the name of the top level struct, tasks[0].updated_at
+// rather than Document.tasks[0].updated_at.
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func describe(fe validator.FieldError) (code, message string) {
+	field := fe.Field()
+	switch fe.Tag() {
+	case "required", "required_if", "required_unless", "required_with":
+		return problem.FieldRequired, field + " is required"
+	case "min":
+		if fe.Param() == "1" {
+			return problem.FieldTooShort, field + " cannot be empty"
+		}
+		return problem.FieldTooShort, field + " must have at least " + fe.Param() + " " + unit(fe)
+	case "max":
+		return problem.FieldTooLong, field + " must have at most " + fe.Param() + " " + unit(fe)
+	case "oneof":
+		return problem.FieldNotAllowed, field + " must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "importance":
+		return problem.FieldNotAllowed, field + " must be one of notset, low, normal or high"
+	case "username":
+		return problem.FieldInvalid, field + " must be 3 to 32 letters, digits, dots, dashes or underscores"
+	case "not_before":
+		return problem.FieldOutOfOrder, field + " cannot be before " + fe.Param()
+	default:
+		return problem.FieldInvalid, field + " is invalid"
+	}
+}
+
+func unit(fe validator.FieldError) string {
+	switch fe.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return "items"
+	default:
+		return "characters"
+	}
+}
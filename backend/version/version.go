@@ -0,0 +1,52 @@
+// Package version tells which build of the server is running. The commit and
+// the build time are set when linking:
+//
+//	go build -ldflags "-X pianpianino/version.Commit=$(git rev-parse HEAD) -X pianpianino/version.BuildTime=$(date -u +%FT%TZ)" ./cmd
+//
+// Without them the commit comes from the version control information go build
+// stamps into binaries built from a checkout.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags -X, see the package documentation.
+var (
+	Commit    string
+	BuildTime string
+)
+
+// Info describes the build, the fields that are not known are empty.
+type Info struct {
+	Commit string `json:"commit,omitempty"`
+	// CommitTime is the time of the commit, known without ldflags
+	CommitTime string `json:"commit_time,omitempty"`
+	BuildTime  string `json:"build_time,omitempty"`
+	// Modified is set when the checkout had uncommitted changes
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the information of the running binary.
+func Get() Info {
+	info := Info{Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			info.CommitTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}